@@ -0,0 +1,28 @@
+// Package api holds the OpenAPI document describing the HTTP API. The
+// server serves it at /api/openapi.json and the Go client in package
+// client is generated from it.
+package api
+
+import (
+	_ "embed"
+	"encoding/json"
+
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed openapi.yaml
+var spec []byte
+
+// YAML returns the OpenAPI document as written
+func YAML() []byte {
+	return spec
+}
+
+// JSON returns the OpenAPI document converted to JSON
+func JSON() ([]byte, error) {
+	var doc map[string]any
+	if err := yaml.Unmarshal(spec, &doc); err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
@@ -0,0 +1,30 @@
+package client_test
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/supercakecrumb/chordik/client"
+)
+
+func Example() {
+	c, err := client.NewClientWithResponses("https://chordik.example.com", client.WithBearerToken(os.Getenv("CHORDIK_TOKEN")))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	search, limit := "wonderwall", 10
+	resp, err := c.ListSongsWithResponse(context.Background(), &client.ListSongsParams{Search: &search, Limit: &limit})
+	if err != nil {
+		log.Fatal(err)
+	}
+	if resp.JSON200 == nil {
+		log.Fatalf("listing songs failed: %s", resp.Status())
+	}
+
+	for _, song := range resp.JSON200.Songs {
+		fmt.Println(song.Title, "by", song.Artist)
+	}
+}
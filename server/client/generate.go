@@ -0,0 +1,6 @@
+// Package client is a typed Go client for the Chordik API, generated from
+// the OpenAPI document in package api. Run go generate after changing the
+// document.
+package client
+
+//go:generate go run github.com/oapi-codegen/oapi-codegen/v2/cmd/oapi-codegen@v2.5.0 -config oapi-codegen.yaml ../api/openapi.yaml
@@ -1,44 +1,223 @@
 package main
 
 import (
-	"fmt"
+	"context"
+	"flag"
 	"log"
+	"log/slog"
+	"math"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"github.com/supercakecrumb/chordik/internal/apitokens"
+	"github.com/supercakecrumb/chordik/internal/auth"
 	"github.com/supercakecrumb/chordik/internal/badges"
+	"github.com/supercakecrumb/chordik/internal/config"
 	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/health"
 	"github.com/supercakecrumb/chordik/internal/http"
+	"github.com/supercakecrumb/chordik/internal/jobs"
+	"github.com/supercakecrumb/chordik/internal/leaderboards"
+	"github.com/supercakecrumb/chordik/internal/logging"
+	"github.com/supercakecrumb/chordik/internal/metrics"
+	"github.com/supercakecrumb/chordik/internal/ratelimit"
+	"github.com/supercakecrumb/chordik/internal/sessions"
+	"github.com/supercakecrumb/chordik/internal/songs"
+	"github.com/supercakecrumb/chordik/internal/store"
+	"github.com/supercakecrumb/chordik/internal/tracing"
 )
 
 func main() {
+	flags := config.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+
+	// SIGTERM is how Docker stops containers; in-flight requests get to
+	// finish before the process exits
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	cfg, err := flags.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
+	// Everything, including the standard logger, logs through slog from here
+	logger, err := logging.New(os.Stdout, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		log.Fatalf("Failed to set up logging: %v", err)
+	}
+	slog.SetDefault(logger)
+	slog.Info("effective configuration", "config", cfg)
+
+	shutdownTracing, err := tracing.Setup(ctx, cfg.Tracing.Config())
+	if err != nil {
+		log.Fatalf("Failed to set up tracing: %v", err)
+	}
+
 	// Initialize database connection
-	database, err := db.NewPostgresConnection(
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-		os.Getenv("DB_PORT"),
-	)
+	dbConfig := cfg.Database.DB()
+	dbConfig.Logger = logging.NewGormLogger(logger, cfg.Log.SlowQuery)
+	database, err := db.NewConnection(dbConfig)
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
+	// SQLite instances have no separate migration step, so they migrate on
+	// startup by default
+	if cfg.Database.ShouldAutoMigrate() {
+		if err := db.Migrate(database.DB); err != nil {
+			log.Fatalf("Failed to run migrations: %v", err)
+		}
+	}
+	st := store.New(database.DB)
+
+	if cfg.Tracing.Exporter != tracing.ExporterNone {
+		if err := tracing.InstrumentGorm(database.DB); err != nil {
+			log.Fatalf("Failed to set up tracing: %v", err)
+		}
+	}
+
+	if cfg.Metrics.Enabled {
+		registerMetrics(database, st)
+	}
+
 	// Initialize badges
-	badgeService := badges.NewBadgeService(database.DB)
-	if err := badgeService.InitializeBadges(); err != nil {
+	badgeService := badges.NewBadgeService(st)
+	if err := badgeService.InitializeBadges(ctx); err != nil {
 		log.Fatalf("Failed to initialize badges: %v", err)
 	}
 
+	sessionConfig := cfg.Sessions.Config()
+
+	// Start background jobs
+	runner := jobs.NewRunner()
+	runner.Add(jobs.Job{
+		Name:     "leaderboards",
+		Interval: cfg.Jobs.LeaderboardRefresh,
+		Run:      leaderboards.NewLeaderboardService(st).Refresh,
+	})
+	songService := songs.NewSongService(st)
+	runner.Add(jobs.Job{
+		Name:     "trash-purge",
+		Interval: time.Hour,
+		Run: func(ctx context.Context) error {
+			return songService.PurgeExpired(ctx, cfg.Jobs.TrashRetention)
+		},
+	})
+	runner.Add(jobs.Job{
+		Name:     "session-cleanup",
+		Interval: time.Hour,
+		Run:      sessions.NewSessionService(st, sessionConfig).CleanupExpired,
+	})
+	runner.Add(jobs.Job{
+		Name:     "api-token-cleanup",
+		Interval: time.Hour,
+		Run:      apitokens.NewAPITokenService(st).CleanupExpired,
+	})
+	limitStore := ratelimit.NewMemoryStore()
+	runner.Add(jobs.Job{
+		Name:     "rate-limit-cleanup",
+		Interval: 10 * time.Minute,
+		Run:      limitStore.Cleanup,
+	})
+	runner.Start(ctx)
+
 	// Initialize HTTP server
-	server := http.NewServer(database.DB)
+	server, err := http.NewServer(database.DB, http.Config{
+		AllowedOrigins: cfg.Server.AllowedOrigins,
+		Sessions:       sessionConfig,
+		Auth:           cfg.AuthConfig(),
+		OIDC:           loadOIDCProvider(cfg.OIDCConfig()),
+		RateLimits:     cfg.RateLimits.Config(),
+		RateLimitStore: limitStore,
+		TrustedProxies: cfg.Server.TrustedProxies,
+		Limits:         cfg.Server.Limits(),
+		Metrics:        cfg.Metrics.Enabled && cfg.Metrics.Addr == "",
+		APITokens:      cfg.Features.APITokens,
+		HealthChecks: []health.Check{
+			{Name: "workers", Run: runner.Check},
+		},
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up the server: %v", err)
+	}
 
-	port := "8080"
-	if p := os.Getenv("PORT"); p != "" {
-		port = p
+	if cfg.Metrics.Enabled && cfg.Metrics.Addr != "" {
+		go func() {
+			slog.Info("serving metrics", "addr", cfg.Metrics.Addr)
+			if err := http.ServeMetrics(ctx, cfg.Metrics.Addr, cfg.Server.Limits()); err != nil {
+				slog.Error("metrics server failed", "error", err)
+			}
+		}()
 	}
 
-	fmt.Printf("Starting server on :%s\n", port)
-	if err := server.Run(":" + port); err != nil {
-		log.Fatalf("Server failed: %v", err)
+	slog.Info("starting server", "port", cfg.Server.Port)
+	serveErr := server.Run(ctx, ":"+cfg.Server.Port)
+
+	// Stop the jobs and wait for them before the database goes away
+	stop()
+	runner.Wait()
+	if err := database.Close(); err != nil {
+		slog.Error("failed to close database", "error", err)
+	}
+	flushCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := shutdownTracing(flushCtx); err != nil {
+		slog.Error("failed to flush traces", "error", err)
+	}
+	cancel()
+
+	if serveErr != nil {
+		log.Fatalf("Server failed: %v", serveErr)
+	}
+	slog.Info("server stopped")
+}
+
+// registerMetrics exports the database pool and query metrics and the
+// number of active sessions
+func registerMetrics(database *db.Connection, st store.Store) {
+	sqlDB, err := database.DB.DB()
+	if err != nil {
+		log.Fatalf("Failed to set up metrics: %v", err)
+	}
+	if err := metrics.RegisterDB(sqlDB); err != nil {
+		log.Fatalf("Failed to set up metrics: %v", err)
+	}
+	if err := metrics.InstrumentGorm(database.DB); err != nil {
+		log.Fatalf("Failed to set up metrics: %v", err)
+	}
+
+	sessionService := sessions.NewSessionService(st, sessions.DefaultConfig())
+	err = metrics.RegisterGauge("active_sessions", "Sessions that have not expired.", func() float64 {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		count, err := sessionService.CountActive(ctx)
+		if err != nil {
+			slog.Error("failed to count active sessions", "error", err)
+			return math.NaN()
+		}
+		return float64(count)
+	})
+	if err != nil {
+		log.Fatalf("Failed to set up metrics: %v", err)
+	}
+}
+
+// loadOIDCProvider sets up OpenID Connect login when an issuer is
+// configured
+func loadOIDCProvider(config auth.OIDCConfig) *auth.OIDCProvider {
+	if !config.Enabled() {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	provider, err := auth.NewOIDCProvider(ctx, config)
+	if err != nil {
+		log.Fatalf("Failed to set up OpenID Connect: %v", err)
 	}
+	return provider
 }
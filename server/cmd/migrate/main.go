@@ -1,30 +1,123 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"os"
+	"strconv"
 
+	"github.com/supercakecrumb/chordik/internal/config"
 	"github.com/supercakecrumb/chordik/internal/db"
 )
 
+const usage = `Usage: migrate [command]
+
+Commands:
+  up            apply all pending migrations (default)
+  down [n]      roll back the last n migrations (default 1)
+  status        list migrations and whether they are applied
+  create <name> add empty up and down files for every driver to the
+                migrations directory
+
+Flags:
+`
+
 func main() {
+	dir := flag.String("dir", "internal/db/migrations", "migrations source directory, used by create")
+	flags := config.RegisterFlags(flag.CommandLine)
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	command := flag.Arg(0)
+	if command == "" {
+		command = "up"
+	}
+
+	// create only touches source files and needs no database
+	if command == "create" {
+		if flag.NArg() != 2 {
+			flag.Usage()
+			os.Exit(2)
+		}
+		paths, err := db.CreateMigration(*dir, flag.Arg(1))
+		if err != nil {
+			log.Fatalf("Failed to create migration: %v", err)
+		}
+		for _, path := range paths {
+			fmt.Println("Created", path)
+		}
+		return
+	}
+
+	cfg, err := flags.Load()
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+
 	// Initialize database connection
-	database, err := db.NewPostgresConnection(
-		os.Getenv("DB_HOST"),
-		os.Getenv("DB_USER"),
-		os.Getenv("DB_PASSWORD"),
-		os.Getenv("DB_NAME"),
-		os.Getenv("DB_PORT"),
-	)
+	database, err := db.NewConnection(cfg.Database.DB())
 	if err != nil {
 		log.Fatalf("Failed to connect to database: %v", err)
 	}
 
-	// Run migrations
-	if err := db.Migrate(database.DB); err != nil {
-		log.Fatalf("Failed to run migrations: %v", err)
+	migrator, err := db.NewMigrator(database.DB)
+	if err != nil {
+		log.Fatalf("Failed to load migrations: %v", err)
 	}
 
-	fmt.Println("Migrations completed successfully")
+	switch command {
+	case "up":
+		ran, err := migrator.Up()
+		for _, migration := range ran {
+			fmt.Printf("Applied %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("Failed to run migrations: %v", err)
+		}
+		if len(ran) == 0 {
+			fmt.Println("Database is up to date")
+			return
+		}
+		fmt.Println("Migrations completed successfully")
+
+	case "down":
+		steps := 1
+		if flag.NArg() > 1 {
+			steps, err = strconv.Atoi(flag.Arg(1))
+			if err != nil || steps < 1 {
+				log.Fatalf("Invalid number of steps: %s", flag.Arg(1))
+			}
+		}
+		reverted, err := migrator.Down(steps)
+		for _, migration := range reverted {
+			fmt.Printf("Rolled back %04d_%s\n", migration.Version, migration.Name)
+		}
+		if err != nil {
+			log.Fatalf("Failed to roll back migrations: %v", err)
+		}
+		if len(reverted) == 0 {
+			fmt.Println("Nothing to roll back")
+		}
+
+	case "status":
+		status, err := migrator.Status()
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		for _, migration := range status {
+			applied := "pending"
+			if migration.AppliedAt != nil {
+				applied = "applied " + migration.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%04d_%-40s %s\n", migration.Version, migration.Name, applied)
+		}
+
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
 }
@@ -0,0 +1,159 @@
+package apitokens
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/apperr"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/store"
+)
+
+var (
+	ErrTokenNotFound = apperr.NotFound("token_not_found", "Token not found")
+	ErrInvalidScope  = apperr.Invalid("invalid_scope", "Invalid scope").WithDetails(map[string]any{"scopes": Scopes})
+	ErrInvalidExpiry = apperr.Invalid("invalid_expiry", "Invalid expiry")
+)
+
+// Scopes limit what a token can do
+const (
+	ScopeSongsRead  = "songs:read"
+	ScopeSongsWrite = "songs:write"
+	ScopeVotesWrite = "votes:write"
+)
+
+// Scopes lists every scope a token can be granted
+var Scopes = []string{ScopeSongsRead, ScopeSongsWrite, ScopeVotesWrite}
+
+// tokenPrefix marks Chordik tokens so leaked ones are easy to spot
+const tokenPrefix = "chk_"
+
+// MaxLifetime bounds how long a token can be valid
+const MaxLifetime = 365 * 24 * time.Hour
+
+// touchInterval limits how often last use is written
+const touchInterval = time.Minute
+
+type APITokenService struct {
+	store store.Store
+}
+
+func NewAPITokenService(st store.Store) *APITokenService {
+	return &APITokenService{store: st}
+}
+
+// Create issues a token and returns it along with its raw value, which is
+// shown to the user once. Only a hash is stored.
+func (s *APITokenService) Create(ctx context.Context, userID uuid.UUID, name string, scopes []string, lifetime time.Duration) (*db.APIToken, string, error) {
+	if len(scopes) == 0 {
+		return nil, "", ErrInvalidScope
+	}
+	for _, scope := range scopes {
+		if !validScope(scope) {
+			return nil, "", ErrInvalidScope
+		}
+	}
+	if lifetime <= 0 || lifetime > MaxLifetime {
+		return nil, "", ErrInvalidExpiry
+	}
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+	raw := tokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	token := db.APIToken{
+		UserID:    userID,
+		Name:      name,
+		Prefix:    raw[:len(tokenPrefix)+6],
+		TokenHash: hashToken(raw),
+		Scopes:    strings.Join(scopes, " "),
+		ExpiresAt: time.Now().Add(lifetime),
+	}
+
+	if err := s.store.APITokens().Create(ctx, &token); err != nil {
+		return nil, "", err
+	}
+
+	return &token, raw, nil
+}
+
+// List returns a user's tokens, newest first
+func (s *APITokenService) List(ctx context.Context, userID uuid.UUID) ([]db.APIToken, error) {
+	return s.store.APITokens().ListByUser(ctx, userID)
+}
+
+// Revoke deletes one of a user's tokens
+func (s *APITokenService) Revoke(ctx context.Context, userID, tokenID uuid.UUID) error {
+	deleted, err := s.store.APITokens().Delete(ctx, userID, tokenID)
+	if err != nil {
+		return err
+	}
+	if !deleted {
+		return ErrTokenNotFound
+	}
+	return nil
+}
+
+// Authenticate returns the unexpired token for a raw value with its user
+// preloaded, recording its use
+func (s *APITokenService) Authenticate(ctx context.Context, raw string) (*db.APIToken, error) {
+	if !strings.HasPrefix(raw, tokenPrefix) {
+		return nil, ErrTokenNotFound
+	}
+
+	now := time.Now()
+	token, err := s.store.APITokens().GetActive(ctx, hashToken(raw), now)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrTokenNotFound
+		}
+		return nil, err
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= touchInterval {
+		if err := s.store.APITokens().Touch(ctx, token.ID, now); err != nil {
+			return nil, err
+		}
+		token.LastUsedAt = &now
+	}
+
+	return token, nil
+}
+
+// CleanupExpired deletes expired tokens
+func (s *APITokenService) CleanupExpired(ctx context.Context) error {
+	return s.store.APITokens().DeleteExpired(ctx, time.Now())
+}
+
+// HasScope reports whether a token was granted a scope
+func HasScope(token *db.APIToken, scope string) bool {
+	for _, granted := range strings.Fields(token.Scopes) {
+		if granted == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func validScope(scope string) bool {
+	for _, known := range Scopes {
+		if scope == known {
+			return true
+		}
+	}
+	return false
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
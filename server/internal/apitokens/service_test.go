@@ -0,0 +1,129 @@
+package apitokens
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/store"
+)
+
+var ctx = context.Background()
+
+// newTestStore returns a store on a fresh in-memory SQLite database
+func newTestStore(t *testing.T) store.Store {
+	t.Helper()
+
+	conn, err := db.NewSQLiteConnection(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if err := db.Migrate(conn.DB); err != nil {
+		t.Fatal(err)
+	}
+	return store.New(conn.DB)
+}
+
+func createUser(t *testing.T, st store.Store, name string) *db.User {
+	t.Helper()
+
+	user := db.User{Email: name + "@example.com", PasswordHash: "x", DisplayName: name, Role: "user"}
+	if err := st.Users().Create(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+func TestAuthenticate(t *testing.T) {
+	st := newTestStore(t)
+	user := createUser(t, st, "ana")
+	other := createUser(t, st, "bob")
+	service := NewAPITokenService(st)
+
+	if _, _, err := service.Create(ctx, user.ID, "script", []string{"songs:admin"}, time.Hour); !errors.Is(err, ErrInvalidScope) {
+		t.Errorf("an unknown scope: got %v, want %v", err, ErrInvalidScope)
+	}
+	if _, _, err := service.Create(ctx, user.ID, "script", []string{ScopeSongsRead}, 2*MaxLifetime); !errors.Is(err, ErrInvalidExpiry) {
+		t.Errorf("a too long lifetime: got %v, want %v", err, ErrInvalidExpiry)
+	}
+
+	token, raw, err := service.Create(ctx, user.ID, "script", []string{ScopeSongsRead, ScopeVotesWrite}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticated, err := service.Authenticate(ctx, raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if authenticated.ID != token.ID || authenticated.User.DisplayName != "ana" {
+		t.Errorf("authenticated token %s of %q", authenticated.ID, authenticated.User.DisplayName)
+	}
+	if !HasScope(authenticated, ScopeVotesWrite) || HasScope(authenticated, ScopeSongsWrite) {
+		t.Errorf("token has scopes %q", authenticated.Scopes)
+	}
+
+	tokens, err := service.List(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].LastUsedAt == nil {
+		t.Errorf("listed %d tokens, want the one used", len(tokens))
+	}
+
+	for _, raw := range []string{"", "chk_forged", raw[len(tokenPrefix):]} {
+		if _, err := service.Authenticate(ctx, raw); !errors.Is(err, ErrTokenNotFound) {
+			t.Errorf("authenticating %q: got %v, want %v", raw, err, ErrTokenNotFound)
+		}
+	}
+
+	if err := service.Revoke(ctx, other.ID, token.ID); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("revoking another user's token: got %v, want %v", err, ErrTokenNotFound)
+	}
+	if err := service.Revoke(ctx, user.ID, token.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.Authenticate(ctx, raw); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("authenticating a revoked token: got %v, want %v", err, ErrTokenNotFound)
+	}
+}
+
+func TestCleanupExpired(t *testing.T) {
+	st := newTestStore(t)
+	user := createUser(t, st, "ana")
+	service := NewAPITokenService(st)
+
+	if _, _, err := service.Create(ctx, user.ID, "current", []string{ScopeSongsRead}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	expired := db.APIToken{
+		UserID:    user.ID,
+		Name:      "expired",
+		Prefix:    "chk_old",
+		TokenHash: hashToken("chk_old"),
+		Scopes:    ScopeSongsRead,
+		ExpiresAt: time.Now().Add(-time.Minute),
+	}
+	if err := st.APITokens().Create(ctx, &expired); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.Authenticate(ctx, "chk_old"); !errors.Is(err, ErrTokenNotFound) {
+		t.Errorf("authenticating an expired token: got %v, want %v", err, ErrTokenNotFound)
+	}
+
+	if err := service.CleanupExpired(ctx); err != nil {
+		t.Fatal(err)
+	}
+	tokens, err := service.List(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tokens) != 1 || tokens[0].Name != "current" {
+		t.Errorf("kept %d tokens, want only the current one", len(tokens))
+	}
+}
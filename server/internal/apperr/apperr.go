@@ -0,0 +1,126 @@
+// Package apperr defines the errors services return for problems the
+// caller can act on. Each carries a stable machine-readable code, the HTTP
+// status it maps to and a message that is safe to show to users. Any other
+// error is treated as internal and its details are never shown.
+package apperr
+
+import (
+	"errors"
+	"net/http"
+)
+
+// Error is a domain error. Services declare them as sentinels and callers
+// match them with errors.Is, which compares codes, so copies made with
+// WithDetails or Wrap still match.
+type Error struct {
+	// Code identifies the error, e.g. "song_not_found"
+	Code string
+	// Status is the HTTP status the error maps to
+	Status int
+	// Message explains the error to users
+	Message string
+	// Details holds extra data for clients, e.g. the invalid fields
+	Details map[string]any
+	// Err is the underlying cause. It is logged but never shown.
+	Err error
+}
+
+// New returns an error with the given status
+func New(status int, code, message string) *Error {
+	return &Error{Code: code, Status: status, Message: message}
+}
+
+// Invalid is for requests that are malformed or fail validation
+func Invalid(code, message string) *Error {
+	return New(http.StatusBadRequest, code, message)
+}
+
+// Unauthorized is for requests without valid credentials
+func Unauthorized(code, message string) *Error {
+	return New(http.StatusUnauthorized, code, message)
+}
+
+// Forbidden is for callers that may not do what they asked
+func Forbidden(code, message string) *Error {
+	return New(http.StatusForbidden, code, message)
+}
+
+// NotFound is for resources that do not exist or are hidden from the caller
+func NotFound(code, message string) *Error {
+	return New(http.StatusNotFound, code, message)
+}
+
+// Conflict is for requests that clash with the current state
+func Conflict(code, message string) *Error {
+	return New(http.StatusConflict, code, message)
+}
+
+// TooManyRequests is for callers that have to wait before trying again
+func TooManyRequests(code, message string) *Error {
+	return New(http.StatusTooManyRequests, code, message)
+}
+
+// Unavailable is for features that are switched off or not configured
+func Unavailable(code, message string) *Error {
+	return New(http.StatusServiceUnavailable, code, message)
+}
+
+// Internal is the error shown for every failure that is not a domain
+// error
+var Internal = New(http.StatusInternalServerError, "internal", "Internal server error")
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is matches errors with the same code
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// WithDetails returns a copy of the error carrying details
+func (e *Error) WithDetails(details map[string]any) *Error {
+	clone := *e
+	clone.Details = details
+	return &clone
+}
+
+// WithMessage returns a copy of the error with another message
+func (e *Error) WithMessage(message string) *Error {
+	clone := *e
+	clone.Message = message
+	return &clone
+}
+
+// WithStatus returns a copy of the error with another HTTP status, for
+// callers where the error means something else
+func (e *Error) WithStatus(status int) *Error {
+	clone := *e
+	clone.Status = status
+	return &clone
+}
+
+// Wrap returns a copy of the error caused by err
+func (e *Error) Wrap(err error) *Error {
+	clone := *e
+	clone.Err = err
+	return &clone
+}
+
+// From returns the domain error in err's chain, or Internal wrapping err
+// when there is none
+func From(err error) *Error {
+	var e *Error
+	if errors.As(err, &e) {
+		return e
+	}
+	return Internal.Wrap(err)
+}
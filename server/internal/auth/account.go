@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/apperr"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/mail"
+	"github.com/supercakecrumb/chordik/internal/songs"
+	"github.com/supercakecrumb/chordik/internal/store"
+)
+
+var (
+	ErrInvalidDeletionMode = apperr.Invalid("invalid_deletion_mode", "Contributions must be anonymize or delete")
+	// ErrPasswordIncorrect is returned when confirming a sensitive change
+	// with the wrong password. Unlike ErrInvalidCredentials it does not
+	// mean the session is invalid.
+	ErrPasswordIncorrect = apperr.Forbidden("password_incorrect", "Password is incorrect")
+)
+
+// Account deletion modes
+const (
+	// DeleteModeAnonymize scrubs the user's identity but keeps their songs,
+	// votes and badges attached to an anonymous account
+	DeleteModeAnonymize = "anonymize"
+	// DeleteModeDelete removes the user together with everything they contributed
+	DeleteModeDelete = "delete"
+)
+
+// checkPassword loads a user and verifies their current password
+func (s *AuthService) checkPassword(ctx context.Context, userID uuid.UUID, password string) (*db.User, error) {
+	user, err := s.store.Users().Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if !verifyPassword(user.PasswordHash, password) {
+		return nil, ErrPasswordIncorrect
+	}
+
+	return user, nil
+}
+
+// ChangePassword replaces the user's password, signs out every other
+// session and revokes the user's API tokens
+func (s *AuthService) ChangePassword(ctx context.Context, userID, currentSessionID uuid.UUID, currentPassword, newPassword string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.ChangePassword")
+	defer span.End()
+
+	user, err := s.checkPassword(ctx, userID, currentPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := s.checkNewPassword(newPassword, user.Email, user.DisplayName); err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.config.Hash.hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	return s.store.Transaction(ctx, func(tx store.Store) error {
+		if err := tx.Users().Update(ctx, userID, map[string]interface{}{"password_hash": hashedPassword}); err != nil {
+			return err
+		}
+
+		if err := tx.Sessions().DeleteForUser(ctx, userID, &currentSessionID); err != nil {
+			return err
+		}
+
+		// A reset link asked for earlier must not overwrite the new password
+		if err := tx.UserTokens().UseAll(ctx, userID, PurposePasswordReset, time.Now()); err != nil {
+			return err
+		}
+
+		return tx.APITokens().DeleteForUser(ctx, userID)
+	})
+}
+
+// ChangeEmail moves the account to a new address, which has to be verified
+// again. The old address is told about the change.
+func (s *AuthService) ChangeEmail(ctx context.Context, userID uuid.UUID, password, newEmail string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.ChangeEmail")
+	defer span.End()
+
+	user, err := s.checkPassword(ctx, userID, password)
+	if err != nil {
+		return err
+	}
+
+	if existing, err := s.store.Users().GetByEmail(ctx, newEmail); err == nil && existing.ID != userID {
+		return ErrEmailTaken
+	} else if err != nil && !errors.Is(err, store.ErrNotFound) {
+		return err
+	}
+
+	err = s.store.Transaction(ctx, func(tx store.Store) error {
+		if err := tx.Users().Update(ctx, userID, map[string]interface{}{
+			"email":             newEmail,
+			"email_verified_at": nil,
+		}); err != nil {
+			return err
+		}
+
+		// Links already sent to the old address must not verify the new one
+		// or reset the password, and a pending two-factor login belongs to
+		// the account as it was. They are used up rather than deleted so
+		// they still count towards the email rate limit.
+		now := time.Now()
+		for _, purpose := range []string{PurposeVerifyEmail, PurposePasswordReset, PurposeTwoFactorLogin} {
+			if err := tx.UserTokens().UseAll(ctx, userID, purpose, now); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := s.config.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Your Chordik email was changed",
+		Body: fmt.Sprintf("Hi %s,\n\nThe email address of your Chordik account was changed to %s. "+
+			"If you did not do this, reset your password right away.\n", user.DisplayName, newEmail),
+	}); err != nil {
+		slog.ErrorContext(ctx, "failed to send email change notice", "error", err)
+	}
+
+	return s.RequestEmailVerification(ctx, userID)
+}
+
+// DeleteAccount removes the user's account. In anonymize mode the user row
+// is scrubbed and kept so their songs still have a creator; in delete mode
+// their songs, votes, badges and other contributions are removed first.
+func (s *AuthService) DeleteAccount(ctx context.Context, userID uuid.UUID, password, mode string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.DeleteAccount")
+	defer span.End()
+
+	if mode != DeleteModeAnonymize && mode != DeleteModeDelete {
+		return ErrInvalidDeletionMode
+	}
+
+	if _, err := s.checkPassword(ctx, userID, password); err != nil {
+		return err
+	}
+
+	if mode == DeleteModeAnonymize {
+		return s.anonymize(ctx, userID)
+	}
+
+	// Votes are about to disappear, so the owners of the songs they were
+	// cast on may lose the popular badge
+	votedOwners, err := s.store.Votes().VotedCreators(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	err = s.store.Transaction(ctx, func(tx store.Store) error {
+		if err := songs.NewSongService(tx).PurgeUserSongs(ctx, userID); err != nil {
+			return err
+		}
+
+		return tx.Users().Purge(ctx, userID)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, ownerID := range votedOwners {
+		if err := s.badgeService.EvaluateUserBadges(ctx, ownerID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// anonymize scrubs everything that identifies the user and signs them out.
+// The emptied password hash can never match, so the account cannot be
+// logged into again.
+func (s *AuthService) anonymize(ctx context.Context, userID uuid.UUID) error {
+	return s.store.Transaction(ctx, func(tx store.Store) error {
+		if err := tx.Users().Update(ctx, userID, map[string]interface{}{
+			"email":             fmt.Sprintf("deleted-%s@deleted.invalid", userID),
+			"display_name":      fmt.Sprintf("Deleted user %s", userID),
+			"password_hash":     "",
+			"role":              RoleUser,
+			"email_verified_at": nil,
+			"totp_secret":       "",
+			"totp_enabled_at":   nil,
+			"anonymized_at":     time.Now(),
+		}); err != nil {
+			return err
+		}
+
+		if err := tx.Sessions().DeleteForUser(ctx, userID, nil); err != nil {
+			return err
+		}
+		if err := tx.UserTokens().DeleteForUser(ctx, userID); err != nil {
+			return err
+		}
+		if err := tx.Identities().DeleteForUser(ctx, userID); err != nil {
+			return err
+		}
+		if err := tx.APITokens().DeleteForUser(ctx, userID); err != nil {
+			return err
+		}
+		return tx.RecoveryCodes().DeleteForUser(ctx, userID)
+	})
+}
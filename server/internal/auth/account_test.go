@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/db"
+)
+
+const testPassword = "correct horse battery"
+
+func registerTestUser(t *testing.T, service *AuthService, email string) *db.User {
+	t.Helper()
+
+	user, err := service.Register(context.Background(), email, testPassword, "Ana")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+func createAPIToken(t *testing.T, service *AuthService, userID uuid.UUID) {
+	t.Helper()
+
+	if err := service.store.APITokens().Create(context.Background(), &db.APIToken{
+		UserID:    userID,
+		Name:      "script",
+		Prefix:    "chk_test",
+		TokenHash: uuid.NewString(),
+		Scopes:    "songs:read",
+		ExpiresAt: time.Now().Add(time.Hour),
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func countAPITokens(t *testing.T, service *AuthService, userID uuid.UUID) int {
+	t.Helper()
+
+	tokens, err := service.store.APITokens().ListByUser(context.Background(), userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return len(tokens)
+}
+
+// TestChangeEmailInvalidatesVerification checks that a link sent to the
+// old address can't verify the new one, even when no new link is sent
+func TestChangeEmailInvalidatesVerification(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+	service.config.EmailsPerHour = 1
+
+	user := registerTestUser(t, service, "ana@example.com")
+	token, err := service.issueToken(ctx, user.ID, user.Email, PurposeVerifyEmail, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The rate limit stops the new link
+	if err := service.ChangeEmail(ctx, user.ID, testPassword, "ana@example.org"); !errors.Is(err, ErrTooManyRequests) {
+		t.Fatalf("ChangeEmail() = %v, want %v", err, ErrTooManyRequests)
+	}
+
+	if err := service.VerifyEmail(ctx, token); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("VerifyEmail() with the old link = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+// TestPasswordChangesRevokeAPITokens checks that changing or resetting the
+// password revokes the API tokens a thief may have created
+func TestPasswordChangesRevokeAPITokens(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	user := registerTestUser(t, service, "ana@example.com")
+
+	createAPIToken(t, service, user.ID)
+	if err := service.ChangePassword(ctx, user.ID, uuid.New(), testPassword, "battery staple horse"); err != nil {
+		t.Fatal(err)
+	}
+	if count := countAPITokens(t, service, user.ID); count != 0 {
+		t.Errorf("%d API tokens left after changing the password", count)
+	}
+
+	createAPIToken(t, service, user.ID)
+	token, err := service.issueToken(ctx, user.ID, user.Email, PurposePasswordReset, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.ResetPassword(ctx, token, testPassword); err != nil {
+		t.Fatal(err)
+	}
+	if count := countAPITokens(t, service, user.ID); count != 0 {
+		t.Errorf("%d API tokens left after resetting the password", count)
+	}
+}
+
+// TestChangeEmailInvalidatesPasswordReset checks that a reset link sent to
+// the old address can't take over the account after the email changed
+func TestChangeEmailInvalidatesPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	user := registerTestUser(t, service, "ana@example.com")
+	token, err := service.issueToken(ctx, user.ID, user.Email, PurposePasswordReset, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.ChangeEmail(ctx, user.ID, testPassword, "ana@example.org"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.ResetPassword(ctx, token, "battery staple horse"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("ResetPassword() with the old link = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+// TestChangePasswordInvalidatesPasswordReset checks that a reset link asked
+// for before a password change can't overwrite the new password
+func TestChangePasswordInvalidatesPasswordReset(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	user := registerTestUser(t, service, "ana@example.com")
+	token, err := service.issueToken(ctx, user.ID, user.Email, PurposePasswordReset, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.ChangePassword(ctx, user.ID, uuid.New(), testPassword, "battery staple horse"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := service.ResetPassword(ctx, token, "staple horse battery"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("ResetPassword() with the old link = %v, want %v", err, ErrInvalidToken)
+	}
+}
+
+// TestResetPasswordVerifiesOnlyTheLinkedAddress checks that a reset only
+// marks the email verified when the link went to the current address
+func TestResetPasswordVerifiesOnlyTheLinkedAddress(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	user := registerTestUser(t, service, "ana@example.com")
+	token, err := service.issueToken(ctx, user.ID, "someone@example.com", PurposePasswordReset, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.ResetPassword(ctx, token, "battery staple horse"); err != nil {
+		t.Fatal(err)
+	}
+	stored, err := service.store.Users().Get(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.EmailVerifiedAt != nil {
+		t.Error("a link sent elsewhere verified the account's address")
+	}
+
+	token, err = service.issueToken(ctx, user.ID, user.Email, PurposePasswordReset, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := service.ResetPassword(ctx, token, "staple horse battery"); err != nil {
+		t.Fatal(err)
+	}
+	if stored, err = service.store.Users().Get(ctx, user.ID); err != nil {
+		t.Fatal(err)
+	}
+	if stored.EmailVerifiedAt == nil {
+		t.Error("a link sent to the account's address did not verify it")
+	}
+}
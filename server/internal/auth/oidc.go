@@ -0,0 +1,272 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/supercakecrumb/chordik/internal/apperr"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/store"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrOIDCFailed       = apperr.Unauthorized("oidc_failed", "OpenID Connect login failed")
+	ErrEmailNotVerified = apperr.Forbidden("email_not_verified", "The provider did not verify the email")
+	// ErrAccountNotVerified is returned when the account with the provider's
+	// email never verified it, so it can't be told apart from an account
+	// someone registered in advance to take over the address
+	ErrAccountNotVerified = apperr.Conflict("account_not_verified", "An account with this email exists but has not verified it; sign in with the password and verify the email first")
+)
+
+// OIDCConfig describes an OpenID Connect provider
+type OIDCConfig struct {
+	// Name is shown on the login button, e.g. "Google"
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	// RedirectURL is the callback registered with the provider
+	RedirectURL string
+	Scopes      []string
+}
+
+// Enabled reports whether a provider is configured
+func (c OIDCConfig) Enabled() bool {
+	return c.Issuer != "" && c.ClientID != ""
+}
+
+// OIDCProvider runs the authorization code flow with PKCE against one
+// provider
+type OIDCProvider struct {
+	name     string
+	issuer   string
+	oauth2   oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCProvider fetches the provider's discovery document
+func NewOIDCProvider(ctx context.Context, config OIDCConfig) (*OIDCProvider, error) {
+	provider, err := oidc.NewProvider(ctx, config.Issuer)
+	if err != nil {
+		return nil, fmt.Errorf("failed to discover provider %s: %w", config.Issuer, err)
+	}
+
+	scopes := config.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{"profile", "email"}
+	}
+
+	name := config.Name
+	if name == "" {
+		name = "OpenID Connect"
+	}
+
+	return &OIDCProvider{
+		name:   name,
+		issuer: config.Issuer,
+		oauth2: oauth2.Config{
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+			RedirectURL:  config.RedirectURL,
+			Endpoint:     provider.Endpoint(),
+			Scopes:       append([]string{oidc.ScopeOpenID}, scopes...),
+		},
+		verifier: provider.Verifier(&oidc.Config{ClientID: config.ClientID}),
+	}, nil
+}
+
+// Name returns the display name of the provider
+func (p *OIDCProvider) Name() string {
+	return p.name
+}
+
+// OIDCRequest holds the values that must survive the redirect to the
+// provider and back. The caller keeps them, e.g. in a short-lived cookie.
+type OIDCRequest struct {
+	State    string
+	Nonce    string
+	Verifier string
+	// URL is where the browser is sent to log in
+	URL string
+}
+
+// Begin starts a login and returns the provider URL to redirect to
+func (p *OIDCProvider) Begin() (*OIDCRequest, error) {
+	state, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	nonce, err := randomString()
+	if err != nil {
+		return nil, err
+	}
+	verifier := oauth2.GenerateVerifier()
+
+	return &OIDCRequest{
+		State:    state,
+		Nonce:    nonce,
+		Verifier: verifier,
+		URL:      p.oauth2.AuthCodeURL(state, oidc.Nonce(nonce), oauth2.S256ChallengeOption(verifier)),
+	}, nil
+}
+
+// OIDCIdentity is the user as described by the provider's ID token
+type OIDCIdentity struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Exchange redeems an authorization code and verifies the returned ID
+// token against the nonce of the request
+func (p *OIDCProvider) Exchange(ctx context.Context, code string, request OIDCRequest) (*OIDCIdentity, error) {
+	token, err := p.oauth2.Exchange(ctx, code, oauth2.VerifierOption(request.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCFailed, err)
+	}
+
+	rawIDToken, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, fmt.Errorf("%w: no id_token in token response", ErrOIDCFailed)
+	}
+
+	idToken, err := p.verifier.Verify(ctx, rawIDToken)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCFailed, err)
+	}
+	if idToken.Nonce != request.Nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrOIDCFailed)
+	}
+
+	var claims struct {
+		Email         string `json:"email"`
+		EmailVerified bool   `json:"email_verified"`
+		Name          string `json:"name"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCFailed, err)
+	}
+
+	return &OIDCIdentity{
+		Issuer:        p.issuer,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: claims.EmailVerified,
+		Name:          claims.Name,
+	}, nil
+}
+
+// LoginWithOIDC finds or creates the user for a provider identity. A known
+// identity logs in directly; otherwise the identity is linked to the
+// account with the same email, which requires both the provider and the
+// account to have verified it. New accounts have no password and can set one through
+// password reset; they are refused while registration is closed.
+func (s *AuthService) LoginWithOIDC(ctx context.Context, identity *OIDCIdentity) (*db.User, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.LoginWithOIDC")
+	defer span.End()
+
+	var user *db.User
+
+	linked, err := s.store.Identities().Get(ctx, identity.Issuer, identity.Subject)
+	switch {
+	case err == nil:
+		if user, err = s.store.Users().Get(ctx, linked.UserID); err != nil {
+			return nil, err
+		}
+	case errors.Is(err, store.ErrNotFound):
+		if identity.Email == "" || !identity.EmailVerified {
+			return nil, ErrEmailNotVerified
+		}
+
+		err := s.store.Transaction(ctx, func(tx store.Store) error {
+			var err error
+			if user, err = tx.Users().GetByEmail(ctx, identity.Email); errors.Is(err, store.ErrNotFound) {
+				if !s.config.Registration {
+					return ErrRegistrationClosed
+				}
+				displayName, err := uniqueDisplayName(ctx, tx, identity)
+				if err != nil {
+					return err
+				}
+				// The provider vouched for the address
+				now := time.Now()
+				user = &db.User{
+					Email:           identity.Email,
+					DisplayName:     displayName,
+					Role:            RoleUser,
+					EmailVerifiedAt: &now,
+				}
+				if err := tx.Users().Create(ctx, user); err != nil {
+					return err
+				}
+			} else if err != nil {
+				return err
+			} else if user.EmailVerifiedAt == nil {
+				return ErrAccountNotVerified
+			}
+
+			return tx.Identities().Create(ctx, &db.UserIdentity{
+				UserID:  user.ID,
+				Issuer:  identity.Issuer,
+				Subject: identity.Subject,
+				Email:   identity.Email,
+			})
+		})
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, err
+	}
+
+	// Award newcomer badge on first login
+	if err := s.badgeService.EvaluateNewcomerBadge(ctx, user.ID); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+var displayNameCleaner = regexp.MustCompile(`[^\p{L}\p{N}_.\- ]+`)
+
+// uniqueDisplayName derives a display name from the identity, adding a
+// number when the name is taken
+func uniqueDisplayName(ctx context.Context, st store.Store, identity *OIDCIdentity) (string, error) {
+	base := strings.TrimSpace(displayNameCleaner.ReplaceAllString(identity.Name, ""))
+	if len([]rune(base)) < 3 {
+		base, _, _ = strings.Cut(identity.Email, "@")
+	}
+	if len([]rune(base)) < 3 {
+		base = "member"
+	}
+
+	name := base
+	for i := 2; ; i++ {
+		taken, err := st.Users().DisplayNameTaken(ctx, name)
+		if err != nil {
+			return "", err
+		}
+		if !taken {
+			return name, nil
+		}
+		name = fmt.Sprintf("%s %d", base, i)
+	}
+}
+
+func randomString() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,320 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/go-jose/go-jose/v4/jwt"
+	"github.com/supercakecrumb/chordik/internal/badges"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/store"
+)
+
+// mockProvider is a minimal OpenID Connect provider. It issues one code per
+// authorization request and checks the PKCE verifier when it is redeemed.
+type mockProvider struct {
+	server   *httptest.Server
+	key      *rsa.PrivateKey
+	clientID string
+	claims   map[string]interface{}
+
+	mu    sync.Mutex
+	codes map[string]authorization
+}
+
+type authorization struct {
+	challenge string
+	nonce     string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := &mockProvider{
+		key:      key,
+		clientID: "chordik",
+		claims: map[string]interface{}{
+			"sub":            "user-1",
+			"email":          "ana@example.com",
+			"email_verified": true,
+			"name":           "Ana",
+		},
+		codes: make(map[string]authorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", p.discovery)
+	mux.HandleFunc("/keys", p.keys)
+	mux.HandleFunc("/token", p.token)
+	p.server = httptest.NewServer(mux)
+	t.Cleanup(p.server.Close)
+
+	return p
+}
+
+func (p *mockProvider) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                p.server.URL,
+		"authorization_endpoint":                p.server.URL + "/authorize",
+		"token_endpoint":                        p.server.URL + "/token",
+		"jwks_uri":                              p.server.URL + "/keys",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (p *mockProvider) keys(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{{
+		Key:       &p.key.PublicKey,
+		KeyID:     "test",
+		Algorithm: "RS256",
+		Use:       "sig",
+	}}})
+}
+
+// authorize plays the user approving the login and returns the code the
+// provider would redirect back with
+func (p *mockProvider) authorize(t *testing.T, loginURL string) (code, state string) {
+	t.Helper()
+
+	u, err := url.Parse(loginURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	query := u.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("login URL has no S256 PKCE challenge: %s", loginURL)
+	}
+	if query.Get("client_id") != p.clientID {
+		t.Fatalf("client_id = %q, want %q", query.Get("client_id"), p.clientID)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	code = "code-" + query.Get("state")
+	p.codes[code] = authorization{challenge: query.Get("code_challenge"), nonce: query.Get("nonce")}
+	return code, query.Get("state")
+}
+
+func (p *mockProvider) token(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	p.mu.Lock()
+	auth, ok := p.codes[r.PostForm.Get("code")]
+	delete(p.codes, r.PostForm.Get("code"))
+	p.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || base64.RawURLEncoding.EncodeToString(sum[:]) != auth.challenge {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: p.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	now := time.Now()
+	claims := map[string]interface{}{
+		"iss":   p.server.URL,
+		"aud":   p.clientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": auth.nonce,
+	}
+	for k, v := range p.claims {
+		claims[k] = v
+	}
+
+	idToken, err := jwt.Signed(signer).Claims(claims).Serialize()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func newTestOIDCProvider(t *testing.T, mock *mockProvider) *OIDCProvider {
+	t.Helper()
+
+	provider, err := NewOIDCProvider(context.Background(), OIDCConfig{
+		Issuer:       mock.server.URL,
+		ClientID:     mock.clientID,
+		ClientSecret: "secret",
+		RedirectURL:  "http://localhost/api/auth/oidc/callback",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return provider
+}
+
+func TestOIDCLogin(t *testing.T) {
+	mock := newMockProvider(t)
+	provider := newTestOIDCProvider(t, mock)
+
+	request, err := provider.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, state := mock.authorize(t, request.URL)
+	if state != request.State {
+		t.Fatalf("state = %q, want %q", state, request.State)
+	}
+
+	identity, err := provider.Exchange(context.Background(), code, *request)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	want := OIDCIdentity{
+		Issuer:        mock.server.URL,
+		Subject:       "user-1",
+		Email:         "ana@example.com",
+		EmailVerified: true,
+		Name:          "Ana",
+	}
+	if *identity != want {
+		t.Errorf("identity = %+v, want %+v", *identity, want)
+	}
+}
+
+func TestOIDCLoginRejectsWrongVerifier(t *testing.T) {
+	mock := newMockProvider(t)
+	provider := newTestOIDCProvider(t, mock)
+
+	request, err := provider.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := mock.authorize(t, request.URL)
+
+	// An attacker holding a stolen code does not have the verifier
+	forged := *request
+	forged.Verifier = "not-the-verifier-not-the-verifier-not-the-verifier"
+	if _, err := provider.Exchange(context.Background(), code, forged); err == nil {
+		t.Fatal("Exchange succeeded with the wrong PKCE verifier")
+	}
+}
+
+func TestOIDCLoginRejectsWrongNonce(t *testing.T) {
+	mock := newMockProvider(t)
+	provider := newTestOIDCProvider(t, mock)
+
+	request, err := provider.Begin()
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, _ := mock.authorize(t, request.URL)
+
+	replayed := *request
+	replayed.Nonce = "other"
+	if _, err := provider.Exchange(context.Background(), code, replayed); err == nil {
+		t.Fatal("Exchange accepted an ID token for another nonce")
+	}
+}
+
+func newTestService(t *testing.T) *AuthService {
+	t.Helper()
+
+	conn, err := db.NewSQLiteConnection(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if err := db.Migrate(conn.DB); err != nil {
+		t.Fatal(err)
+	}
+	if err := badges.NewBadgeService(store.New(conn.DB)).InitializeBadges(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	config := DefaultConfig()
+	config.Registration = true
+	return NewAuthService(store.New(conn.DB), config)
+}
+
+// TestLoginWithOIDCLinking checks that a provider identity only takes over
+// an existing account whose owner verified the email
+func TestLoginWithOIDCLinking(t *testing.T) {
+	ctx := context.Background()
+	service := newTestService(t)
+
+	now := time.Now()
+	verified := db.User{Email: "ana@example.com", DisplayName: "Ana", Role: RoleUser, EmailVerifiedAt: &now}
+	unverified := db.User{Email: "bob@example.com", DisplayName: "Bob", Role: RoleUser, PasswordHash: "hash"}
+	for _, user := range []*db.User{&verified, &unverified} {
+		if err := service.store.Users().Create(ctx, user); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	identity := func(subject, email string) *OIDCIdentity {
+		return &OIDCIdentity{Issuer: "https://issuer.example.com", Subject: subject, Email: email, EmailVerified: true}
+	}
+
+	user, err := service.LoginWithOIDC(ctx, identity("ana", verified.Email))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.ID != verified.ID {
+		t.Errorf("linked to user %s, want %s", user.ID, verified.ID)
+	}
+
+	// Someone may have registered the address to wait for its owner
+	if _, err := service.LoginWithOIDC(ctx, identity("bob", unverified.Email)); !errors.Is(err, ErrAccountNotVerified) {
+		t.Fatalf("LoginWithOIDC() = %v, want %v", err, ErrAccountNotVerified)
+	}
+	if _, err := service.store.Identities().Get(ctx, "https://issuer.example.com", "bob"); !errors.Is(err, store.ErrNotFound) {
+		t.Error("the identity was linked to an unverified account")
+	}
+	stored, err := service.store.Users().Get(ctx, unverified.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.EmailVerifiedAt != nil {
+		t.Error("the unverified account was marked verified")
+	}
+
+	// New accounts are verified by the provider
+	user, err = service.LoginWithOIDC(ctx, identity("cy", "cy@example.com"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if user.EmailVerifiedAt == nil {
+		t.Error("a new account was not marked verified")
+	}
+}
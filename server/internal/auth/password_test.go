@@ -0,0 +1,55 @@
+package auth
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// TestBcryptPasswordLength checks that passwords bcrypt can't hash are
+// refused as too long instead of failing when they are hashed
+func TestBcryptPasswordLength(t *testing.T) {
+	bcryptConfig := HashConfig{Algorithm: HashBcrypt, BcryptCost: bcrypt.MinCost}
+	argon2Config := DefaultHashConfig()
+	argon2Config.Algorithm = HashArgon2id
+
+	tests := []struct {
+		name     string
+		config   HashConfig
+		password string
+		wantErr  error
+	}{
+		{name: "72 bytes with bcrypt", config: bcryptConfig, password: strings.Repeat("a", 72)},
+		{name: "73 bytes with bcrypt", config: bcryptConfig, password: strings.Repeat("a", 73), wantErr: ErrPasswordTooLong},
+		// 30 characters, but 120 bytes
+		{name: "multibyte with bcrypt", config: bcryptConfig, password: strings.Repeat("🎸", 30), wantErr: ErrPasswordTooLong},
+		{name: "multibyte with argon2id", config: argon2Config, password: strings.Repeat("🎸", 30)},
+	}
+
+	policy := PasswordPolicy{MinLength: 8, MaxLength: 128}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := policy.Check(tt.password, "ana@example.com", "Ana"); err != nil {
+				t.Fatalf("the policy refused the password: %v", err)
+			}
+
+			err := tt.config.checkLength(tt.password)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("checkLength() = %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+
+			hash, err := tt.config.hashPassword(tt.password)
+			if err != nil {
+				t.Fatalf("hashPassword() = %v", err)
+			}
+			if !verifyPassword(hash, tt.password) {
+				t.Error("the password does not verify against its hash")
+			}
+		})
+	}
+}
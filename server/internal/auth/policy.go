@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/supercakecrumb/chordik/internal/apperr"
+)
+
+var (
+	ErrPasswordTooShort = apperr.Invalid("password_too_short", "Password is too short")
+	ErrPasswordTooLong  = apperr.Invalid("password_too_long", "Password is too long")
+	ErrPasswordBreached = apperr.Invalid("password_breached", "This password has appeared in a data breach, choose another one")
+	ErrPasswordPersonal = apperr.Invalid("password_personal", "Password must not contain your email or display name")
+)
+
+// PasswordPolicy decides which new passwords are accepted. Lengths are
+// counted in characters; with bcrypt, passwords are also limited to
+// BcryptMaxBytes bytes.
+type PasswordPolicy struct {
+	MinLength int
+	MaxLength int
+	// BreachedList is a directory of Have I Been Pwned style range files:
+	// one file per 5 character SHA-1 prefix, named <PREFIX>.txt, holding
+	// "<SUFFIX>:<COUNT>" lines. Empty disables the check.
+	BreachedList string
+}
+
+// DefaultPasswordPolicy returns the policy used when nothing is configured
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength: 8,
+		MaxLength: BcryptMaxBytes,
+	}
+}
+
+// minPersonalLength keeps short names like "Al" from ruling out half of
+// all passwords
+const minPersonalLength = 4
+
+// Check validates a new password for the account with the given email and
+// display name
+func (p PasswordPolicy) Check(password, email, displayName string) error {
+	length := utf8.RuneCountInString(password)
+	if length < p.MinLength {
+		return ErrPasswordTooShort
+	}
+	if p.MaxLength > 0 && length > p.MaxLength {
+		return ErrPasswordTooLong
+	}
+
+	lowered := strings.ToLower(password)
+	localPart, _, _ := strings.Cut(strings.ToLower(email), "@")
+	for _, personal := range []string{localPart, strings.ToLower(displayName)} {
+		if utf8.RuneCountInString(personal) >= minPersonalLength && strings.Contains(lowered, personal) {
+			return ErrPasswordPersonal
+		}
+	}
+
+	if p.BreachedList != "" {
+		breached, err := p.breached(password)
+		if err != nil {
+			return err
+		}
+		if breached {
+			return ErrPasswordBreached
+		}
+	}
+
+	return nil
+}
+
+// breached looks the password up in the local range files. Only the
+// range for the first five hex digits of its SHA-1 is read.
+func (p PasswordPolicy) breached(password string) (bool, error) {
+	sum := sha1.Sum([]byte(password))
+	digest := strings.ToUpper(hex.EncodeToString(sum[:]))
+	prefix, suffix := digest[:5], digest[5:]
+
+	file, err := os.Open(filepath.Join(p.BreachedList, prefix+".txt"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		entry, _, _ := strings.Cut(scanner.Text(), ":")
+		if strings.EqualFold(strings.TrimSpace(entry), suffix) {
+			return true, nil
+		}
+	}
+	return false, scanner.Err()
+}
@@ -0,0 +1,159 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/apperr"
+	"github.com/supercakecrumb/chordik/internal/mail"
+	"github.com/supercakecrumb/chordik/internal/store"
+)
+
+var (
+	ErrUserNotFound    = apperr.NotFound("user_not_found", "User not found")
+	ErrAlreadyVerified = apperr.Conflict("already_verified", "Email already verified")
+)
+
+// RequestPasswordReset emails a password reset link. Unknown addresses and
+// rate-limited requests are silently ignored so the response does not
+// reveal which emails have accounts.
+func (s *AuthService) RequestPasswordReset(ctx context.Context, email string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.RequestPasswordReset")
+	defer span.End()
+
+	user, err := s.store.Users().GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	if err := s.checkEmailRate(ctx, user.ID, PurposePasswordReset); err != nil {
+		if errors.Is(err, ErrTooManyRequests) {
+			return nil
+		}
+		return err
+	}
+
+	token, err := s.issueToken(ctx, user.ID, user.Email, PurposePasswordReset, s.config.ResetTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.config.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Reset your Chordik password",
+		Body: fmt.Sprintf("Hi %s,\n\nSomeone asked to reset the password for your Chordik account. "+
+			"If it was you, open this link within %s:\n\n%s\n\nOtherwise you can ignore this email.\n",
+			user.DisplayName, s.config.ResetTokenTTL, s.link("/reset-password", token)),
+	})
+}
+
+// ResetPassword sets a new password using a reset token, signs the user
+// out everywhere and revokes their API tokens. A password rejected by the policy leaves the token
+// usable for another try.
+func (s *AuthService) ResetPassword(ctx context.Context, token, newPassword string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.ResetPassword")
+	defer span.End()
+
+	pending, err := s.findToken(ctx, token, PurposePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	user, err := s.store.Users().Get(ctx, pending.UserID)
+	if err != nil {
+		return err
+	}
+	if err := s.checkNewPassword(newPassword, user.Email, user.DisplayName); err != nil {
+		return err
+	}
+
+	userToken, err := s.consumeToken(ctx, token, PurposePasswordReset)
+	if err != nil {
+		return err
+	}
+
+	hashedPassword, err := s.config.Hash.hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	fields := map[string]interface{}{"password_hash": hashedPassword}
+	// Receiving the email proves the address, so it counts as verified,
+	// but only if the account still has the address the link went to
+	if user.EmailVerifiedAt == nil && userToken.Email != "" && userToken.Email == user.Email {
+		fields["email_verified_at"] = time.Now()
+	}
+
+	return s.store.Transaction(ctx, func(tx store.Store) error {
+		if err := tx.Users().Update(ctx, userToken.UserID, fields); err != nil {
+			return err
+		}
+
+		if err := tx.Sessions().DeleteForUser(ctx, userToken.UserID, nil); err != nil {
+			return err
+		}
+
+		return tx.APITokens().DeleteForUser(ctx, userToken.UserID)
+	})
+}
+
+// RequestEmailVerification emails a link that confirms the user's address
+func (s *AuthService) RequestEmailVerification(ctx context.Context, userID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "AuthService.RequestEmailVerification")
+	defer span.End()
+
+	user, err := s.store.Users().Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return ErrAlreadyVerified
+	}
+
+	if err := s.checkEmailRate(ctx, user.ID, PurposeVerifyEmail); err != nil {
+		return err
+	}
+
+	token, err := s.issueToken(ctx, user.ID, user.Email, PurposeVerifyEmail, s.config.VerifyTokenTTL)
+	if err != nil {
+		return err
+	}
+
+	return s.config.Mailer.Send(mail.Message{
+		To:      user.Email,
+		Subject: "Confirm your email for Chordik",
+		Body: fmt.Sprintf("Hi %s,\n\nPlease confirm your email address by opening this link within %s:\n\n%s\n",
+			user.DisplayName, s.config.VerifyTokenTTL, s.link("/verify-email", token)),
+	})
+}
+
+// VerifyEmail marks the user's address as verified using a verification token
+func (s *AuthService) VerifyEmail(ctx context.Context, token string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.VerifyEmail")
+	defer span.End()
+
+	userToken, err := s.consumeToken(ctx, token, PurposeVerifyEmail)
+	if err != nil {
+		return err
+	}
+
+	return s.store.Users().Update(ctx, userToken.UserID, map[string]interface{}{
+		"email_verified_at": time.Now(),
+	})
+}
+
+// link builds a web app URL carrying a token
+func (s *AuthService) link(path, token string) string {
+	return s.config.AppURL + path + "?token=" + url.QueryEscape(token)
+}
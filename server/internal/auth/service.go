@@ -1,44 +1,109 @@
 package auth
 
 import (
+	"context"
 	"errors"
+	"log/slog"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/apperr"
 	"github.com/supercakecrumb/chordik/internal/badges"
 	"github.com/supercakecrumb/chordik/internal/db"
-	"golang.org/x/crypto/bcrypt"
-	"gorm.io/gorm"
+	"github.com/supercakecrumb/chordik/internal/mail"
+	"github.com/supercakecrumb/chordik/internal/store"
+	"go.opentelemetry.io/otel"
 )
 
 var (
-	ErrEmailTaken         = errors.New("email already taken")
-	ErrInvalidCredentials = errors.New("invalid credentials")
+	ErrEmailTaken         = apperr.Conflict("email_taken", "Email already in use")
+	ErrInvalidCredentials = apperr.Unauthorized("invalid_credentials", "Invalid credentials")
+	ErrRegistrationClosed = apperr.Forbidden("registration_closed", "Registration is closed")
 )
 
+// User roles
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+// IsModerator reports whether a role grants moderation rights
+func IsModerator(role string) bool {
+	return role == RoleModerator || role == RoleAdmin
+}
+
+// Config holds the settings for account recovery and verification emails
+type Config struct {
+	// AppURL is the public URL of the web app, used to build email links
+	AppURL string
+	Mailer mail.Mailer
+	// ResetTokenTTL and VerifyTokenTTL bound how long emailed links work
+	ResetTokenTTL  time.Duration
+	VerifyTokenTTL time.Duration
+	// EmailsPerHour limits how many emails of each kind go to one address
+	EmailsPerHour int64
+	// Password is the policy for new passwords
+	Password PasswordPolicy
+	// Hash selects how passwords are hashed
+	Hash HashConfig
+	// Registration lets new users create accounts, with a password or by
+	// logging in through OpenID Connect for the first time
+	Registration bool
+}
+
+// DefaultConfig returns the settings used when nothing is configured
+func DefaultConfig() Config {
+	return Config{
+		AppURL:         "http://localhost:5173",
+		Mailer:         mail.NewLogMailer(""),
+		ResetTokenTTL:  time.Hour,
+		VerifyTokenTTL: 48 * time.Hour,
+		EmailsPerHour:  3,
+		Password:       DefaultPasswordPolicy(),
+		Hash:           DefaultHashConfig(),
+		Registration:   true,
+	}
+}
+
+var tracer = otel.Tracer("github.com/supercakecrumb/chordik/internal/auth")
+
+// AuthService reads and writes users and their credentials through the
+// store
 type AuthService struct {
-	db           *gorm.DB
+	store        store.Store
+	config       Config
 	badgeService *badges.BadgeService
 }
 
-func NewAuthService(db *gorm.DB) *AuthService {
+func NewAuthService(st store.Store, config Config) *AuthService {
 	return &AuthService{
-		db:           db,
-		badgeService: badges.NewBadgeService(db),
+		store:        st,
+		config:       config,
+		badgeService: badges.NewBadgeService(st),
 	}
 }
 
-func (s *AuthService) Register(email, password, displayName string) (*db.User, error) {
+func (s *AuthService) Register(ctx context.Context, email, password, displayName string) (*db.User, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Register")
+	defer span.End()
+
+	if !s.config.Registration {
+		return nil, ErrRegistrationClosed
+	}
+
 	// Check if email exists
-	var existing db.User
-	if err := s.db.Where("email = ?", email).First(&existing).Error; err == nil {
+	if _, err := s.store.Users().GetByEmail(ctx, email); err == nil {
 		return nil, ErrEmailTaken
-	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+	} else if !errors.Is(err, store.ErrNotFound) {
+		return nil, err
+	}
+
+	if err := s.checkNewPassword(password, email, displayName); err != nil {
 		return nil, err
 	}
 
 	// Hash password
-	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	hashedPassword, err := s.config.Hash.hashPassword(password)
 	if err != nil {
 		return nil, err
 	}
@@ -46,59 +111,72 @@ func (s *AuthService) Register(email, password, displayName string) (*db.User, e
 	// Create user
 	user := db.User{
 		Email:        email,
-		PasswordHash: string(hashedPassword),
+		PasswordHash: hashedPassword,
 		DisplayName:  displayName,
+		Role:         RoleUser,
 	}
 
-	if err := s.db.Create(&user).Error; err != nil {
+	if err := s.store.Users().Create(ctx, &user); err != nil {
 		return nil, err
 	}
 
+	// A failed verification email must not fail the registration; the
+	// user can ask for another one
+	if err := s.RequestEmailVerification(ctx, user.ID); err != nil {
+		slog.ErrorContext(ctx, "failed to send verification email", "user_id", user.ID, "error", err)
+	}
+
 	return &user, nil
 }
 
-func (s *AuthService) Login(email, password string) (*db.User, error) {
-	var user db.User
-	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+func (s *AuthService) Login(ctx context.Context, email, password string) (*db.User, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.Login")
+	defer span.End()
+
+	user, err := s.store.Users().GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
 			return nil, ErrInvalidCredentials
 		}
 		return nil, err
 	}
 
-	if err := bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(password)); err != nil {
+	if !verifyPassword(user.PasswordHash, password) {
 		return nil, ErrInvalidCredentials
 	}
 
-	// Award newcomer badge on first login
-	if err := s.badgeService.EvaluateNewcomerBadge(user.ID); err != nil {
-		return nil, err
-	}
-
-	return &user, nil
-}
-
-func (s *AuthService) CreateSession(userID uuid.UUID) (*db.Session, error) {
-	session := db.Session{
-		UserID:    userID,
-		ExpiresAt: time.Now().Add(24 * time.Hour * 7), // 1 week
+	// The plain password is only available now, so this is the one chance
+	// to move the hash to the configured algorithm and cost
+	if s.config.Hash.needsRehash(user.PasswordHash) && s.config.Hash.checkLength(password) == nil {
+		if err := s.rehash(ctx, user, password); err != nil {
+			slog.ErrorContext(ctx, "failed to rehash password", "user_id", user.ID, "error", err)
+		}
 	}
 
-	if err := s.db.Create(&session).Error; err != nil {
+	// Award newcomer badge on first login
+	if err := s.badgeService.EvaluateNewcomerBadge(ctx, user.ID); err != nil {
 		return nil, err
 	}
 
-	return &session, nil
+	return user, nil
 }
 
-func (s *AuthService) DeleteSession(sessionID uuid.UUID) error {
-	return s.db.Where("id = ?", sessionID).Delete(&db.Session{}).Error
+// checkNewPassword applies the password policy and the limits of the hash
+// algorithm to a new password
+func (s *AuthService) checkNewPassword(password, email, displayName string) error {
+	if err := s.config.Password.Check(password, email, displayName); err != nil {
+		return err
+	}
+	return s.config.Hash.checkLength(password)
 }
 
-func (s *AuthService) GetUserFromSession(sessionID uuid.UUID) (*db.User, error) {
-	var session db.Session
-	if err := s.db.Preload("User").Where("id = ? AND expires_at > ?", sessionID, time.Now()).First(&session).Error; err != nil {
-		return nil, err
+// rehash replaces a user's password hash with one made using the current
+// settings. The update is skipped if the hash changed in the meantime.
+func (s *AuthService) rehash(ctx context.Context, user *db.User, password string) error {
+	hashedPassword, err := s.config.Hash.hashPassword(password)
+	if err != nil {
+		return err
 	}
-	return &session.User, nil
+
+	return s.store.Users().ReplacePasswordHash(ctx, user.ID, user.PasswordHash, hashedPassword)
 }
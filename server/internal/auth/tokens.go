@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/apperr"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/store"
+)
+
+var (
+	ErrInvalidToken    = apperr.Invalid("invalid_token", "Invalid or expired token")
+	ErrTooManyRequests = apperr.TooManyRequests("too_many_emails", "Too many emails, try again later")
+)
+
+// Token purposes
+const (
+	PurposePasswordReset = "password_reset"
+	PurposeVerifyEmail   = "verify_email"
+)
+
+// issueToken creates a single-use token for a user and returns its raw
+// value. Only a hash is stored, along with the address the token is sent
+// to, if any. Earlier unused tokens for the same purpose are invalidated.
+func (s *AuthService) issueToken(ctx context.Context, userID uuid.UUID, email, purpose string, ttl time.Duration) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	raw := base64.RawURLEncoding.EncodeToString(b)
+
+	now := time.Now()
+	err := s.store.Transaction(ctx, func(tx store.Store) error {
+		if err := tx.UserTokens().UseAll(ctx, userID, purpose, now); err != nil {
+			return err
+		}
+
+		return tx.UserTokens().Create(ctx, &db.UserToken{
+			UserID:    userID,
+			Purpose:   purpose,
+			TokenHash: hashToken(raw),
+			Email:     email,
+			ExpiresAt: now.Add(ttl),
+		})
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return raw, nil
+}
+
+// findToken returns an unused, unexpired token without redeeming it
+func (s *AuthService) findToken(ctx context.Context, raw, purpose string) (*db.UserToken, error) {
+	token, err := s.store.UserTokens().GetUnused(ctx, hashToken(raw), purpose, time.Now())
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+	return token, nil
+}
+
+// consumeToken redeems a token exactly once and returns it
+func (s *AuthService) consumeToken(ctx context.Context, raw, purpose string) (*db.UserToken, error) {
+	token, err := s.store.UserTokens().GetByHash(ctx, hashToken(raw), purpose)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrInvalidToken
+		}
+		return nil, err
+	}
+
+	// The conditional update makes redemption safe against concurrent use
+	used, err := s.store.UserTokens().Use(ctx, token.ID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if !used {
+		return nil, ErrInvalidToken
+	}
+
+	return token, nil
+}
+
+// checkEmailRate enforces the per-address limit on emails of one kind
+func (s *AuthService) checkEmailRate(ctx context.Context, userID uuid.UUID, purpose string) error {
+	count, err := s.store.UserTokens().CountSince(ctx, userID, purpose, time.Now().Add(-time.Hour))
+	if err != nil {
+		return err
+	}
+
+	if count >= s.config.EmailsPerHour {
+		return ErrTooManyRequests
+	}
+	return nil
+}
+
+func hashToken(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,273 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/apperr"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/store"
+)
+
+var (
+	ErrTwoFactorEnabled    = apperr.Conflict("two_factor_enabled", "Two-factor authentication is already enabled")
+	ErrTwoFactorNotEnabled = apperr.Conflict("two_factor_not_enabled", "Two-factor authentication is not enabled")
+	ErrTwoFactorNotStarted = apperr.Invalid("two_factor_not_started", "Start two-factor setup first")
+	ErrInvalidCode         = apperr.Invalid("invalid_code", "Invalid code")
+)
+
+// PurposeTwoFactorLogin marks the token that carries a half-finished login
+// between the password step and the code step
+const PurposeTwoFactorLogin = "two_factor_login"
+
+const (
+	totpIssuer = "Chordik"
+	// twoFactorLoginTTL bounds how long the user has to enter a code
+	// after their password
+	twoFactorLoginTTL = 5 * time.Minute
+	recoveryCodeCount = 10
+)
+
+// TwoFactorEnrollment is what an authenticator app needs to add the account
+type TwoFactorEnrollment struct {
+	Secret string
+	URI    string
+}
+
+// BeginTwoFactorEnrollment generates a new TOTP secret for the user. It
+// only takes effect once confirmed with a code from the app.
+func (s *AuthService) BeginTwoFactorEnrollment(ctx context.Context, userID uuid.UUID) (*TwoFactorEnrollment, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.BeginTwoFactorEnrollment")
+	defer span.End()
+
+	user, err := s.store.Users().Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.Users().Update(ctx, user.ID, map[string]interface{}{"totp_secret": secret}); err != nil {
+		return nil, err
+	}
+
+	return &TwoFactorEnrollment{
+		Secret: secret,
+		URI:    totpURI(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor enables two-factor authentication once the user proves
+// their app generates valid codes, and returns fresh recovery codes
+func (s *AuthService) ConfirmTwoFactor(ctx context.Context, userID uuid.UUID, code string) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.ConfirmTwoFactor")
+	defer span.End()
+
+	user, err := s.store.Users().Get(ctx, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrUserNotFound
+		}
+		return nil, err
+	}
+
+	if user.TOTPEnabledAt != nil {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotStarted
+	}
+
+	counter, ok := matchTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return nil, ErrInvalidCode
+	}
+
+	var codes []string
+	err = s.store.Transaction(ctx, func(tx store.Store) error {
+		if err := tx.Users().Update(ctx, user.ID, map[string]interface{}{
+			"totp_enabled_at":   time.Now(),
+			"totp_last_counter": counter,
+		}); err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(ctx, tx, userID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// DisableTwoFactor turns two-factor authentication off after checking the
+// user's password
+func (s *AuthService) DisableTwoFactor(ctx context.Context, userID uuid.UUID, password string) error {
+	ctx, span := tracer.Start(ctx, "AuthService.DisableTwoFactor")
+	defer span.End()
+
+	user, err := s.checkPassword(ctx, userID, password)
+	if err != nil {
+		return err
+	}
+
+	if user.TOTPEnabledAt == nil {
+		return ErrTwoFactorNotEnabled
+	}
+
+	return s.store.Transaction(ctx, func(tx store.Store) error {
+		if err := tx.Users().Update(ctx, user.ID, map[string]interface{}{
+			"totp_secret":       "",
+			"totp_enabled_at":   nil,
+			"totp_last_counter": 0,
+		}); err != nil {
+			return err
+		}
+
+		return tx.RecoveryCodes().DeleteForUser(ctx, userID)
+	})
+}
+
+// RegenerateRecoveryCodes replaces the user's recovery codes after checking
+// their password
+func (s *AuthService) RegenerateRecoveryCodes(ctx context.Context, userID uuid.UUID, password string) ([]string, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.RegenerateRecoveryCodes")
+	defer span.End()
+
+	user, err := s.checkPassword(ctx, userID, password)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabledAt == nil {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	return replaceRecoveryCodes(ctx, s.store, userID)
+}
+
+// StartTwoFactorLogin is called after a correct password for a user with
+// two-factor authentication. It returns a short-lived challenge to send
+// back along with the code.
+func (s *AuthService) StartTwoFactorLogin(ctx context.Context, userID uuid.UUID) (string, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.StartTwoFactorLogin")
+	defer span.End()
+
+	return s.issueToken(ctx, userID, "", PurposeTwoFactorLogin, twoFactorLoginTTL)
+}
+
+// TwoFactorLoginUser returns the user a pending login challenge was issued
+// to, so failed codes can be counted against the account rather than the
+// challenge
+func (s *AuthService) TwoFactorLoginUser(ctx context.Context, challenge string) (uuid.UUID, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.TwoFactorLoginUser")
+	defer span.End()
+
+	token, err := s.findToken(ctx, challenge, PurposeTwoFactorLogin)
+	if err != nil {
+		return uuid.Nil, err
+	}
+	return token.UserID, nil
+}
+
+// CompleteTwoFactorLogin finishes a login with a code from the
+// authenticator app or a recovery code. A wrong code leaves the challenge
+// usable so the user can retry until it expires.
+func (s *AuthService) CompleteTwoFactorLogin(ctx context.Context, challenge, code string) (*db.User, error) {
+	ctx, span := tracer.Start(ctx, "AuthService.CompleteTwoFactorLogin")
+	defer span.End()
+
+	token, err := s.findToken(ctx, challenge, PurposeTwoFactorLogin)
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := s.store.Users().Get(ctx, token.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if user.TOTPEnabledAt == nil {
+		return nil, ErrTwoFactorNotEnabled
+	}
+
+	if err := s.checkSecondFactor(ctx, user, code); err != nil {
+		return nil, err
+	}
+
+	if _, err := s.consumeToken(ctx, challenge, PurposeTwoFactorLogin); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// checkSecondFactor accepts a TOTP code, each at most once, or an unused
+// recovery code
+func (s *AuthService) checkSecondFactor(ctx context.Context, user *db.User, code string) error {
+	if counter, ok := matchTOTP(user.TOTPSecret, code, time.Now()); ok {
+		// Only moving the counter forward rejects replays of a seen code
+		advanced, err := s.store.Users().AdvanceTOTPCounter(ctx, user.ID, counter)
+		if err != nil {
+			return err
+		}
+		if !advanced {
+			return ErrInvalidCode
+		}
+		return nil
+	}
+
+	used, err := s.store.RecoveryCodes().Use(ctx, user.ID, hashToken(normalizeRecoveryCode(code)), time.Now())
+	if err != nil {
+		return err
+	}
+	if !used {
+		return ErrInvalidCode
+	}
+	return nil
+}
+
+// replaceRecoveryCodes deletes a user's recovery codes and stores hashes
+// of new ones, returning them in plain text to show once
+func replaceRecoveryCodes(ctx context.Context, st store.Store, userID uuid.UUID) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]db.RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 6)
+		if _, err := rand.Read(b); err != nil {
+			return nil, err
+		}
+		code := strings.ToLower(totpEncoding.EncodeToString(b)[:10])
+		codes[i] = code[:5] + "-" + code[5:]
+		rows[i] = db.RecoveryCode{UserID: userID, CodeHash: hashToken(code)}
+	}
+
+	if err := st.RecoveryCodes().Replace(ctx, userID, rows); err != nil {
+		return nil, err
+	}
+
+	return codes, nil
+}
+
+// normalizeRecoveryCode ignores case, spaces and dashes so codes can be
+// typed as printed or not
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
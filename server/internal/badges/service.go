@@ -1,23 +1,30 @@
 package badges
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/apperr"
 	"github.com/supercakecrumb/chordik/internal/db"
-	"gorm.io/gorm"
+	"github.com/supercakecrumb/chordik/internal/metrics"
+	"github.com/supercakecrumb/chordik/internal/store"
+	"go.opentelemetry.io/otel"
 )
 
 var (
-	ErrBadgeNotFound = errors.New("badge not found")
+	ErrBadgeNotFound = apperr.NotFound("badge_not_found", "Badge not found")
 )
 
+var tracer = otel.Tracer("github.com/supercakecrumb/chordik/internal/badges")
+
 type BadgeService struct {
-	db *gorm.DB
+	store store.Store
 }
 
-func NewBadgeService(db *gorm.DB) *BadgeService {
-	return &BadgeService{db: db}
+func NewBadgeService(store store.Store) *BadgeService {
+	return &BadgeService{store: store}
 }
 
 const (
@@ -25,18 +32,84 @@ const (
 	BadgeContributorI = "CONTRIBUTOR_I"
 	BadgeContributorV = "CONTRIBUTOR_V"
 	BadgePopular100   = "POPULAR_100"
+	BadgeEditorI      = "EDITOR_I"
+)
+
+// Badge history actions
+const (
+	ActionAwarded = "awarded"
+	ActionRevoked = "revoked"
 )
 
-func (s *BadgeService) InitializeBadges() error {
-	badges := []db.Badge{
-		{Code: BadgeNewcomer, Name: "Newcomer", Description: "Awarded on first login"},
-		{Code: BadgeContributorI, Name: "Contributor I", Description: "Awarded for 1 published song"},
-		{Code: BadgeContributorV, Name: "Contributor V", Description: "Awarded for 5 published songs"},
-		{Code: BadgePopular100, Name: "Popular", Description: "Awarded for a song with 100+ net votes"},
+// metricFunc computes the value a badge threshold is compared against
+type metricFunc func(ctx context.Context, s *BadgeService, userID uuid.UUID) (int64, error)
+
+// rule describes how a badge is earned. Badges without a metric are
+// awarded by an explicit event (e.g. first login) and never re-evaluated.
+type rule struct {
+	badge  db.Badge
+	metric metricFunc
+}
+
+var rules = []rule{
+	{
+		badge: db.Badge{Code: BadgeNewcomer, Name: "Newcomer", Description: "Awarded on first login", Threshold: 1},
+	},
+	{
+		badge:  db.Badge{Code: BadgeContributorI, Name: "Contributor I", Description: "Awarded for 1 published song", Threshold: 1, Revocable: true},
+		metric: publishedSongs,
+	},
+	{
+		badge:  db.Badge{Code: BadgeContributorV, Name: "Contributor V", Description: "Awarded for 5 published songs", Threshold: 5, Revocable: true},
+		metric: publishedSongs,
+	},
+	{
+		badge:  db.Badge{Code: BadgePopular100, Name: "Popular", Description: "Awarded for a song with 100+ net votes", Threshold: 100, Revocable: true},
+		metric: bestSongScore,
+	},
+	{
+		badge:  db.Badge{Code: BadgeEditorI, Name: "Editor I", Description: "Awarded for 1 accepted edit suggestion", Threshold: 1},
+		metric: acceptedSuggestions,
+	},
+}
+
+func findRule(code string) (rule, bool) {
+	for _, r := range rules {
+		if r.badge.Code == code {
+			return r, true
+		}
 	}
+	return rule{}, false
+}
+
+// Progress reports how close a user is to earning a badge
+type Progress struct {
+	Code        string     `json:"code"`
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Current     int64      `json:"current"`
+	Threshold   int64      `json:"threshold"`
+	Revocable   bool       `json:"revocable"`
+	Awarded     bool       `json:"awarded"`
+	AwardedAt   *time.Time `json:"awardedAt,omitempty"`
+}
+
+// HistoryEntry is a single award or revocation of a badge
+type HistoryEntry struct {
+	Code      string    `json:"code"`
+	Name      string    `json:"name"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"createdAt"`
+}
 
-	for _, badge := range badges {
-		if err := s.db.FirstOrCreate(&badge, db.Badge{Code: badge.Code}).Error; err != nil {
+func (s *BadgeService) InitializeBadges(ctx context.Context) error {
+	ctx, span := tracer.Start(ctx, "BadgeService.InitializeBadges")
+	defer span.End()
+
+	for _, r := range rules {
+		// Upserting keeps thresholds and flags in sync with the rule definitions
+		badge := r.badge
+		if err := s.store.Badges().Upsert(ctx, &badge); err != nil {
 			return err
 		}
 	}
@@ -44,77 +117,260 @@ func (s *BadgeService) InitializeBadges() error {
 	return nil
 }
 
-func (s *BadgeService) AwardBadge(userID uuid.UUID, badgeCode string) error {
-	var badge db.Badge
-	if err := s.db.First(&badge, "code = ?", badgeCode).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return ErrBadgeNotFound
+func (s *BadgeService) findBadge(ctx context.Context, badgeCode string) (*db.Badge, error) {
+	badge, err := s.store.Badges().GetByCode(ctx, badgeCode)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrBadgeNotFound
 		}
+		return nil, err
+	}
+	return badge, nil
+}
+
+func (s *BadgeService) AwardBadge(ctx context.Context, userID uuid.UUID, badgeCode string) error {
+	ctx, span := tracer.Start(ctx, "BadgeService.AwardBadge")
+	defer span.End()
+
+	badge, err := s.findBadge(ctx, badgeCode)
+	if err != nil {
 		return err
 	}
 
 	// Check if user already has this badge
-	var existing db.UserBadge
-	if err := s.db.First(&existing, "user_id = ? AND badge_id = ?", userID, badge.ID).Error; err == nil {
-		// Already has badge
-		return nil
-	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+	if owned, err := s.store.Badges().HasAward(ctx, userID, badge.ID); err != nil {
 		return err
+	} else if owned {
+		return nil
 	}
 
-	// Award badge
-	userBadge := db.UserBadge{
-		UserID:  userID,
-		BadgeID: badge.ID,
+	// Award badge and record it in the history
+	err = s.store.Transaction(ctx, func(tx store.Store) error {
+		userBadge := db.UserBadge{
+			UserID:  userID,
+			BadgeID: badge.ID,
+		}
+		if err := tx.Badges().CreateAward(ctx, &userBadge); err != nil {
+			return err
+		}
+
+		return tx.Badges().CreateEvent(ctx, &db.BadgeEvent{
+			UserID:  userID,
+			BadgeID: badge.ID,
+			Action:  ActionAwarded,
+		})
+	})
+	if err != nil {
+		return err
 	}
 
-	return s.db.Create(&userBadge).Error
+	metrics.BadgeChanges.WithLabelValues(badgeCode, ActionAwarded).Inc()
+	return nil
 }
 
-func (s *BadgeService) EvaluateNewcomerBadge(userID uuid.UUID) error {
-	// This badge is awarded on first login, so just award it
-	return s.AwardBadge(userID, BadgeNewcomer)
-}
+// RevokeBadge removes a badge from a user. Badges that are not revocable
+// are left untouched.
+func (s *BadgeService) RevokeBadge(ctx context.Context, userID uuid.UUID, badgeCode string) error {
+	ctx, span := tracer.Start(ctx, "BadgeService.RevokeBadge")
+	defer span.End()
 
-func (s *BadgeService) EvaluateContributorBadges(userID uuid.UUID) error {
-	var count int64
-	if err := s.db.Model(&db.Song{}).Where("created_by_id = ?", userID).Count(&count).Error; err != nil {
+	badge, err := s.findBadge(ctx, badgeCode)
+	if err != nil {
 		return err
 	}
 
-	if count >= 1 {
-		if err := s.AwardBadge(userID, BadgeContributorI); err != nil {
-			return err
-		}
+	if !badge.Revocable {
+		return nil
 	}
 
-	if count >= 5 {
-		if err := s.AwardBadge(userID, BadgeContributorV); err != nil {
+	var revoked bool
+	err = s.store.Transaction(ctx, func(tx store.Store) error {
+		var err error
+		revoked, err = tx.Badges().DeleteAward(ctx, userID, badge.ID)
+		if err != nil {
 			return err
 		}
+
+		// Nothing to revoke
+		if !revoked {
+			return nil
+		}
+
+		return tx.Badges().CreateEvent(ctx, &db.BadgeEvent{
+			UserID:  userID,
+			BadgeID: badge.ID,
+			Action:  ActionRevoked,
+		})
+	})
+	if err != nil {
+		return err
 	}
 
+	if revoked {
+		metrics.BadgeChanges.WithLabelValues(badgeCode, ActionRevoked).Inc()
+	}
 	return nil
 }
 
-func (s *BadgeService) EvaluatePopularBadge(songID uuid.UUID) error {
-	var song db.Song
-	if err := s.db.First(&song, "id = ?", songID).Error; err != nil {
+// evaluate awards the badge if the user meets its threshold and revokes it
+// if the user no longer does
+func (s *BadgeService) evaluate(ctx context.Context, userID uuid.UUID, badgeCode string) error {
+	r, ok := findRule(badgeCode)
+	if !ok {
+		return ErrBadgeNotFound
+	}
+
+	if r.metric == nil {
+		return nil
+	}
+
+	current, err := r.metric(ctx, s, userID)
+	if err != nil {
 		return err
 	}
 
-	// Calculate score (likes - dislikes)
-	var score int64
-	if err := s.db.Model(&db.SongLike{}).
-		Select("COALESCE(SUM(value), 0)").
-		Where("song_id = ?", songID).
-		Scan(&score).Error; err != nil {
+	if current >= r.badge.Threshold {
+		return s.AwardBadge(ctx, userID, badgeCode)
+	}
+
+	return s.RevokeBadge(ctx, userID, badgeCode)
+}
+
+func (s *BadgeService) EvaluateNewcomerBadge(ctx context.Context, userID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "BadgeService.EvaluateNewcomerBadge")
+	defer span.End()
+
+	// This badge is awarded on first login, so just award it
+	return s.AwardBadge(ctx, userID, BadgeNewcomer)
+}
+
+func (s *BadgeService) EvaluateContributorBadges(ctx context.Context, userID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "BadgeService.EvaluateContributorBadges")
+	defer span.End()
+
+	if err := s.evaluate(ctx, userID, BadgeContributorI); err != nil {
 		return err
 	}
 
-	if score >= 100 {
-		return s.AwardBadge(song.CreatedByID, BadgePopular100)
+	return s.evaluate(ctx, userID, BadgeContributorV)
+}
+
+// EvaluateEditorBadges re-evaluates badges earned through accepted edit suggestions
+func (s *BadgeService) EvaluateEditorBadges(ctx context.Context, userID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "BadgeService.EvaluateEditorBadges")
+	defer span.End()
+
+	return s.evaluate(ctx, userID, BadgeEditorI)
+}
+
+// EvaluatePopularBadge re-evaluates the popular badge for the creator of a song
+func (s *BadgeService) EvaluatePopularBadge(ctx context.Context, songID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "BadgeService.EvaluatePopularBadge")
+	defer span.End()
+
+	song, err := s.store.Songs().Get(ctx, songID)
+	if err != nil {
+		return err
 	}
 
+	return s.evaluate(ctx, song.CreatedByID, BadgePopular100)
+}
+
+// EvaluateUserBadges re-evaluates every metric-based badge for a user
+func (s *BadgeService) EvaluateUserBadges(ctx context.Context, userID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "BadgeService.EvaluateUserBadges")
+	defer span.End()
+
+	for _, r := range rules {
+		if err := s.evaluate(ctx, userID, r.badge.Code); err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// GetProgress reports the current metric and threshold for every badge
+func (s *BadgeService) GetProgress(ctx context.Context, userID uuid.UUID) ([]Progress, error) {
+	ctx, span := tracer.Start(ctx, "BadgeService.GetProgress")
+	defer span.End()
+
+	owned, err := s.store.Badges().ListAwards(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	awarded := make(map[uuid.UUID]time.Time, len(owned))
+	for _, ub := range owned {
+		awarded[ub.BadgeID] = ub.AwardedAt
+	}
+
+	progress := make([]Progress, 0, len(rules))
+	for _, r := range rules {
+		badge, err := s.findBadge(ctx, r.badge.Code)
+		if err != nil {
+			return nil, err
+		}
+
+		p := Progress{
+			Code:        badge.Code,
+			Name:        badge.Name,
+			Description: badge.Description,
+			Threshold:   badge.Threshold,
+			Revocable:   badge.Revocable,
+		}
+
+		if at, ok := awarded[badge.ID]; ok {
+			p.Awarded = true
+			p.AwardedAt = &at
+		}
+
+		if r.metric != nil {
+			if p.Current, err = r.metric(ctx, s, userID); err != nil {
+				return nil, err
+			}
+		} else if p.Awarded {
+			p.Current = p.Threshold
+		}
+
+		progress = append(progress, p)
+	}
+
+	return progress, nil
+}
+
+// GetHistory returns the award and revocation history of a user, newest first
+func (s *BadgeService) GetHistory(ctx context.Context, userID uuid.UUID) ([]HistoryEntry, error) {
+	ctx, span := tracer.Start(ctx, "BadgeService.GetHistory")
+	defer span.End()
+
+	events, err := s.store.Badges().History(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	history := make([]HistoryEntry, len(events))
+	for i, event := range events {
+		history[i] = HistoryEntry{
+			Code:      event.Code,
+			Name:      event.Name,
+			Action:    event.Action,
+			CreatedAt: event.CreatedAt,
+		}
+	}
+	return history, nil
+}
+
+// publishedSongs counts the songs created by a user
+func publishedSongs(ctx context.Context, s *BadgeService, userID uuid.UUID) (int64, error) {
+	return s.store.Songs().CountByCreator(ctx, userID)
+}
+
+// bestSongScore returns the highest net vote score among a user's songs
+func bestSongScore(ctx context.Context, s *BadgeService, userID uuid.UUID) (int64, error) {
+	return s.store.Votes().BestScoreByCreator(ctx, userID)
+}
+
+// acceptedSuggestions counts the edit suggestions by a user that song owners accepted
+func acceptedSuggestions(ctx context.Context, s *BadgeService, userID uuid.UUID) (int64, error) {
+	return s.store.Songs().CountAcceptedSuggestions(ctx, userID)
+}
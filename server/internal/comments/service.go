@@ -0,0 +1,203 @@
+package comments
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/apperr"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/songs"
+	"github.com/supercakecrumb/chordik/internal/store"
+)
+
+var (
+	ErrCommentNotFound  = apperr.NotFound("comment_not_found", "Comment not found")
+	ErrSongNotFound     = apperr.NotFound("song_not_found", "Song not found")
+	ErrPermissionDenied = apperr.Forbidden("permission_denied", "Permission denied")
+	ErrInvalidParent    = apperr.Invalid("invalid_parent", "Invalid parent comment")
+	ErrInvalidLine      = apperr.Invalid("invalid_line", "Line number out of range")
+	ErrCommentDeleted   = apperr.Conflict("comment_deleted", "Comment has been deleted")
+)
+
+type CommentService struct {
+	store       store.Store
+	songService *songs.SongService
+}
+
+func NewCommentService(st store.Store) *CommentService {
+	return &CommentService{
+		store:       st,
+		songService: songs.NewSongService(st),
+	}
+}
+
+// Thread is a comment together with its replies
+type Thread struct {
+	db.Comment
+	Replies []*Thread
+}
+
+// ListComments returns the comment threads of a song, oldest first.
+// Deleted comments are kept as placeholders so replies stay in context.
+// Hidden songs only have comments for those who can see the song.
+func (s *CommentService) ListComments(ctx context.Context, viewer songs.Viewer, songID uuid.UUID) ([]*Thread, error) {
+	if _, err := s.songService.GetSong(ctx, viewer, songID); err != nil {
+		return nil, err
+	}
+
+	comments, err := s.store.Comments().ListBySong(ctx, songID)
+	if err != nil {
+		return nil, err
+	}
+
+	threads := make(map[uuid.UUID]*Thread, len(comments))
+	for _, comment := range comments {
+		comment.Redact()
+		threads[comment.ID] = &Thread{Comment: comment, Replies: []*Thread{}}
+	}
+
+	roots := []*Thread{}
+	for _, comment := range comments {
+		thread := threads[comment.ID]
+		if comment.ParentID != nil {
+			if parent, ok := threads[*comment.ParentID]; ok {
+				parent.Replies = append(parent.Replies, thread)
+				continue
+			}
+		}
+		roots = append(roots, thread)
+	}
+
+	return roots, nil
+}
+
+// CreateComment comments on a song the viewer can see
+func (s *CommentService) CreateComment(ctx context.Context, viewer songs.Viewer, songID uuid.UUID, parentID *uuid.UUID, body string, lineNumber *int) (*db.Comment, error) {
+	song, err := s.songService.GetSong(ctx, viewer, songID)
+	if err != nil {
+		return nil, err
+	}
+
+	if parentID != nil {
+		parent, err := s.findComment(ctx, *parentID)
+		if err != nil {
+			if errors.Is(err, ErrCommentNotFound) {
+				return nil, ErrInvalidParent
+			}
+			return nil, err
+		}
+		if parent.SongID != songID || parent.SuggestionID != nil || parent.DeletedAt != nil {
+			return nil, ErrInvalidParent
+		}
+	}
+
+	if lineNumber != nil {
+		lines := strings.Count(song.BodyChordPro, "\n") + 1
+		if *lineNumber < 1 || *lineNumber > lines {
+			return nil, ErrInvalidLine
+		}
+	}
+
+	comment := db.Comment{
+		SongID:     songID,
+		UserID:     &viewer.UserID,
+		ParentID:   parentID,
+		Body:       body,
+		LineNumber: lineNumber,
+	}
+
+	if err := s.store.Comments().Create(ctx, &comment); err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+// UpdateComment edits the body of a comment. Only the author may edit.
+func (s *CommentService) UpdateComment(ctx context.Context, userID, commentID uuid.UUID, body string) (*db.Comment, error) {
+	comment, err := s.findComment(ctx, commentID)
+	if err != nil {
+		return nil, err
+	}
+
+	if comment.UserID == nil || *comment.UserID != userID {
+		return nil, ErrPermissionDenied
+	}
+
+	if comment.DeletedAt != nil {
+		return nil, ErrCommentDeleted
+	}
+
+	now := time.Now()
+	if err := s.store.Comments().Update(ctx, comment, map[string]interface{}{
+		"body":      body,
+		"edited_at": now,
+	}); err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// DeleteComment soft deletes a comment. The author and the owner of the
+// song may delete it.
+func (s *CommentService) DeleteComment(ctx context.Context, userID, commentID uuid.UUID) error {
+	comment, err := s.findComment(ctx, commentID)
+	if err != nil {
+		return err
+	}
+
+	canModerate, err := s.canModerate(ctx, userID, comment)
+	if err != nil {
+		return err
+	}
+	if !canModerate {
+		return ErrPermissionDenied
+	}
+
+	if comment.DeletedAt != nil {
+		return nil
+	}
+
+	return s.store.Comments().Update(ctx, comment, map[string]interface{}{
+		"deleted_at": time.Now(),
+	})
+}
+
+func (s *CommentService) canModerate(ctx context.Context, userID uuid.UUID, comment *db.Comment) (bool, error) {
+	if comment.UserID != nil && *comment.UserID == userID {
+		return true, nil
+	}
+
+	song, err := s.findSong(ctx, comment.SongID)
+	if err != nil {
+		return false, err
+	}
+
+	return song.CreatedByID == userID, nil
+}
+
+func (s *CommentService) findSong(ctx context.Context, songID uuid.UUID) (*db.Song, error) {
+	song, err := s.store.Songs().Get(ctx, songID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrSongNotFound
+		}
+		return nil, err
+	}
+	return song, nil
+}
+
+func (s *CommentService) findComment(ctx context.Context, commentID uuid.UUID) (*db.Comment, error) {
+	comment, err := s.store.Comments().Get(ctx, commentID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrCommentNotFound
+		}
+		return nil, err
+	}
+	return comment, nil
+}
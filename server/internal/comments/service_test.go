@@ -0,0 +1,141 @@
+package comments
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/badges"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/songs"
+	"github.com/supercakecrumb/chordik/internal/store"
+)
+
+var ctx = context.Background()
+
+// newTestStore returns a store on a fresh in-memory SQLite database
+func newTestStore(t *testing.T) store.Store {
+	t.Helper()
+
+	conn, err := db.NewSQLiteConnection(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if err := db.Migrate(conn.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	st := store.New(conn.DB)
+	if err := badges.NewBadgeService(st).InitializeBadges(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func createUser(t *testing.T, st store.Store, name string) *db.User {
+	t.Helper()
+
+	user := db.User{Email: name + "@example.com", PasswordHash: "x", DisplayName: name, Role: "user"}
+	if err := st.Users().Create(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+func createSong(t *testing.T, st store.Store, owner *db.User) *db.Song {
+	t.Helper()
+
+	song := db.Song{Title: "Song", Artist: "Artist", BodyChordPro: "[C]la\n[G]la", Status: songs.StatusVisible, CreatedByID: owner.ID}
+	if err := st.Songs().Create(ctx, &song); err != nil {
+		t.Fatal(err)
+	}
+	return &song
+}
+
+func TestCommentThreads(t *testing.T) {
+	st := newTestStore(t)
+	owner := createUser(t, st, "owner")
+	reader := createUser(t, st, "reader")
+	song := createSong(t, st, owner)
+	service := NewCommentService(st)
+
+	root, err := service.CreateComment(ctx, songs.Viewer{UserID: reader.ID}, song.ID, nil, "Nice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	line := 2
+	if _, err := service.CreateComment(ctx, songs.Viewer{UserID: owner.ID}, song.ID, &root.ID, "Thanks", &line); err != nil {
+		t.Fatal(err)
+	}
+
+	line = 3
+	if _, err := service.CreateComment(ctx, songs.Viewer{UserID: reader.ID}, song.ID, nil, "Past the end", &line); !errors.Is(err, ErrInvalidLine) {
+		t.Errorf("commenting past the last line: got %v, want %v", err, ErrInvalidLine)
+	}
+	missing := uuid.New()
+	if _, err := service.CreateComment(ctx, songs.Viewer{UserID: reader.ID}, song.ID, &missing, "Reply", nil); !errors.Is(err, ErrInvalidParent) {
+		t.Errorf("replying to a missing comment: got %v, want %v", err, ErrInvalidParent)
+	}
+
+	// The song owner may delete a comment, which stays as a placeholder
+	if err := service.DeleteComment(ctx, owner.ID, root.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.UpdateComment(ctx, reader.ID, root.ID, "Edited"); !errors.Is(err, ErrCommentDeleted) {
+		t.Errorf("editing a deleted comment: got %v, want %v", err, ErrCommentDeleted)
+	}
+
+	threads, err := service.ListComments(ctx, songs.Viewer{}, song.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(threads) != 1 || len(threads[0].Replies) != 1 {
+		t.Fatalf("got %d threads, want one with one reply", len(threads))
+	}
+	if deleted := threads[0]; deleted.Body != "" || deleted.UserID != nil || deleted.User != nil || deleted.DeletedAt == nil {
+		t.Errorf("deleted comment has body %q by %v", deleted.Body, deleted.UserID)
+	}
+	if reply := threads[0].Replies[0]; reply.Body != "Thanks" || reply.User.DisplayName != "owner" {
+		t.Errorf("reply is %q by %q", reply.Body, reply.User.DisplayName)
+	}
+}
+
+func TestCommentPermissions(t *testing.T) {
+	st := newTestStore(t)
+	owner := createUser(t, st, "owner")
+	author := createUser(t, st, "author")
+	other := createUser(t, st, "other")
+	song := createSong(t, st, owner)
+	service := NewCommentService(st)
+
+	comment, err := service.CreateComment(ctx, songs.Viewer{UserID: author.ID}, song.ID, nil, "Nice", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.UpdateComment(ctx, owner.ID, comment.ID, "Edited"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("editing as the song owner: got %v, want %v", err, ErrPermissionDenied)
+	}
+	if err := service.DeleteComment(ctx, other.ID, comment.ID); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("deleting as someone else: got %v, want %v", err, ErrPermissionDenied)
+	}
+
+	updated, err := service.UpdateComment(ctx, author.ID, comment.ID, "Edited")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.Body != "Edited" || updated.EditedAt == nil {
+		t.Errorf("updated comment has body %q and edited at %v", updated.Body, updated.EditedAt)
+	}
+
+	stored, err := st.Comments().Get(ctx, comment.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Body != "Edited" {
+		t.Errorf("stored comment has body %q, want %q", stored.Body, "Edited")
+	}
+}
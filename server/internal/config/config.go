@@ -0,0 +1,387 @@
+// Package config loads the server settings. Every setting has a default
+// and can be set, in increasing order of precedence, in a YAML or TOML
+// file, in an environment variable and on the command line.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/supercakecrumb/chordik/internal/auth"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/http"
+	"github.com/supercakecrumb/chordik/internal/logging"
+	"github.com/supercakecrumb/chordik/internal/ratelimit"
+	"github.com/supercakecrumb/chordik/internal/sessions"
+	"github.com/supercakecrumb/chordik/internal/tracing"
+)
+
+// Config holds every server setting. Fields are tagged with their key in
+// config files, the environment variable that sets them and, for passwords
+// and keys, secret so they are redacted when printed.
+type Config struct {
+	Server     Server     `config:"server"`
+	Log        Log        `config:"log"`
+	Database   Database   `config:"database"`
+	Sessions   Sessions   `config:"sessions"`
+	Auth       Auth       `config:"auth"`
+	Mail       Mail       `config:"mail"`
+	OIDC       OIDC       `config:"oidc"`
+	RateLimits RateLimits `config:"rate_limits"`
+	Jobs       Jobs       `config:"jobs"`
+	Metrics    Metrics    `config:"metrics"`
+	Tracing    Tracing    `config:"tracing"`
+	Features   Features   `config:"features"`
+}
+
+type Server struct {
+	Port string `config:"port" env:"PORT"`
+	// AllowedOrigins lists the origins allowed to make credentialed
+	// cross-origin requests
+	AllowedOrigins []string `config:"allowed_origins" env:"CORS_ALLOWED_ORIGINS"`
+	// TrustedProxies lists the proxies whose X-Forwarded-For headers are
+	// used to find the client IP. None are trusted by default.
+	TrustedProxies []string `config:"trusted_proxies" env:"TRUSTED_PROXIES"`
+
+	ReadHeaderTimeout time.Duration `config:"read_header_timeout" env:"HTTP_READ_HEADER_TIMEOUT"`
+	ReadTimeout       time.Duration `config:"read_timeout" env:"HTTP_READ_TIMEOUT"`
+	WriteTimeout      time.Duration `config:"write_timeout" env:"HTTP_WRITE_TIMEOUT"`
+	IdleTimeout       time.Duration `config:"idle_timeout" env:"HTTP_IDLE_TIMEOUT"`
+	MaxHeaderBytes    int           `config:"max_header_bytes" env:"HTTP_MAX_HEADER_BYTES"`
+	MaxBodyBytes      int64         `config:"max_body_bytes" env:"HTTP_MAX_BODY_BYTES"`
+	// ShutdownTimeout is how long in-flight requests may finish on SIGTERM
+	ShutdownTimeout time.Duration `config:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+	// ShutdownDelay is how long /readyz fails before the server stops
+	// accepting connections, so load balancers can drain it
+	ShutdownDelay time.Duration `config:"shutdown_delay" env:"SHUTDOWN_DELAY"`
+}
+
+type Log struct {
+	Level  string `config:"level" env:"LOG_LEVEL"`
+	Format string `config:"format" env:"LOG_FORMAT"`
+	// SlowQuery is how long a database query may take before it is logged
+	// as slow. Zero turns slow query warnings off.
+	SlowQuery time.Duration `config:"slow_query" env:"LOG_SLOW_QUERY"`
+}
+
+type Database struct {
+	Driver string `config:"driver" env:"DB_DRIVER"`
+	// DSN is a full Postgres connection string. When set, the separate
+	// connection settings below are ignored.
+	DSN         string `config:"dsn" env:"DB_DSN" secret:"true"`
+	Host        string `config:"host" env:"DB_HOST"`
+	Port        string `config:"port" env:"DB_PORT"`
+	User        string `config:"user" env:"DB_USER"`
+	Password    string `config:"password" env:"DB_PASSWORD" secret:"true"`
+	Name        string `config:"name" env:"DB_NAME"`
+	SSLMode     string `config:"ssl_mode" env:"DB_SSL_MODE"`
+	SSLRootCert string `config:"ssl_root_cert" env:"DB_SSL_ROOT_CERT"`
+	SQLitePath  string `config:"sqlite_path" env:"SQLITE_PATH"`
+
+	MaxOpenConns    int           `config:"max_open_conns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `config:"max_idle_conns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `config:"conn_max_lifetime" env:"DB_CONN_MAX_LIFETIME"`
+	ConnMaxIdleTime time.Duration `config:"conn_max_idle_time" env:"DB_CONN_MAX_IDLE_TIME"`
+
+	// AutoMigrate applies pending migrations on startup. Unset, it is on
+	// for SQLite, which has no separate migration step, and off for Postgres.
+	AutoMigrate *bool `config:"auto_migrate" env:"DB_AUTO_MIGRATE"`
+}
+
+type Sessions struct {
+	CookieName     string        `config:"cookie_name" env:"SESSION_COOKIE_NAME"`
+	CookieDomain   string        `config:"cookie_domain" env:"SESSION_COOKIE_DOMAIN"`
+	CookieSecure   bool          `config:"cookie_secure" env:"SESSION_COOKIE_SECURE"`
+	CookieSameSite string        `config:"cookie_same_site" env:"SESSION_COOKIE_SAMESITE"`
+	IdleTTL        time.Duration `config:"idle_ttl" env:"SESSION_IDLE_TTL"`
+	MaxLifetime    time.Duration `config:"max_lifetime" env:"SESSION_MAX_LIFETIME"`
+}
+
+type Auth struct {
+	// AppURL is the public URL of the web app, used to build email links
+	AppURL            string        `config:"app_url" env:"APP_BASE_URL"`
+	PasswordResetTTL  time.Duration `config:"password_reset_ttl" env:"PASSWORD_RESET_TTL"`
+	EmailVerifyTTL    time.Duration `config:"email_verify_ttl" env:"EMAIL_VERIFY_TTL"`
+	PasswordMinLength int           `config:"password_min_length" env:"PASSWORD_MIN_LENGTH"`
+	PasswordMaxLength int           `config:"password_max_length" env:"PASSWORD_MAX_LENGTH"`
+	// PasswordBreachedList is a directory of breached password hash ranges
+	PasswordBreachedList string `config:"password_breached_list" env:"PASSWORD_BREACHED_LIST"`
+	PasswordHash         string `config:"password_hash" env:"PASSWORD_HASH"`
+	BcryptCost           int    `config:"bcrypt_cost" env:"BCRYPT_COST"`
+	Argon2Memory         uint32 `config:"argon2_memory_kib" env:"ARGON2_MEMORY_KIB"`
+	Argon2Iterations     uint32 `config:"argon2_iterations" env:"ARGON2_ITERATIONS"`
+	Argon2Parallelism    uint8  `config:"argon2_parallelism" env:"ARGON2_PARALLELISM"`
+}
+
+type Mail struct {
+	Driver       string `config:"driver" env:"MAIL_DRIVER"`
+	LogPath      string `config:"log_path" env:"MAIL_LOG_PATH"`
+	From         string `config:"from" env:"MAIL_FROM"`
+	SMTPHost     string `config:"smtp_host" env:"SMTP_HOST"`
+	SMTPPort     string `config:"smtp_port" env:"SMTP_PORT"`
+	SMTPUsername string `config:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword string `config:"smtp_password" env:"SMTP_PASSWORD" secret:"true"`
+}
+
+type OIDC struct {
+	ProviderName string `config:"provider_name" env:"OIDC_PROVIDER_NAME"`
+	Issuer       string `config:"issuer" env:"OIDC_ISSUER"`
+	ClientID     string `config:"client_id" env:"OIDC_CLIENT_ID"`
+	ClientSecret string `config:"client_secret" env:"OIDC_CLIENT_SECRET" secret:"true"`
+	// RedirectURL defaults to the callback route behind the app URL
+	RedirectURL string   `config:"redirect_url" env:"OIDC_REDIRECT_URL"`
+	Scopes      []string `config:"scopes" env:"OIDC_SCOPES"`
+}
+
+type RateLimits struct {
+	Auth                 ratelimit.Limit `config:"auth" env:"RATE_LIMIT_AUTH"`
+	Write                ratelimit.Limit `config:"write" env:"RATE_LIMIT_WRITE"`
+	Songs                ratelimit.Limit `config:"songs" env:"RATE_LIMIT_SONGS"`
+	Votes                ratelimit.Limit `config:"votes" env:"RATE_LIMIT_VOTES"`
+	LockoutThreshold     int             `config:"lockout_threshold" env:"LOGIN_LOCKOUT_THRESHOLD"`
+	LockoutBaseDelay     time.Duration   `config:"lockout_base_delay" env:"LOGIN_LOCKOUT_BASE_DELAY"`
+	LockoutMaxDelay      time.Duration   `config:"lockout_max_delay" env:"LOGIN_LOCKOUT_MAX_DELAY"`
+	LockoutFailureWindow time.Duration   `config:"lockout_window" env:"LOGIN_LOCKOUT_WINDOW"`
+}
+
+type Jobs struct {
+	LeaderboardRefresh time.Duration `config:"leaderboard_refresh" env:"LEADERBOARD_REFRESH_INTERVAL"`
+	// TrashRetention is how long deleted songs stay restorable
+	TrashRetention time.Duration `config:"trash_retention" env:"TRASH_RETENTION"`
+}
+
+type Metrics struct {
+	Enabled bool `config:"enabled" env:"METRICS_ENABLED"`
+	// Addr is a separate address, such as ":9090", to serve the metrics
+	// on instead of the API port
+	Addr string `config:"addr" env:"METRICS_ADDR"`
+}
+
+type Tracing struct {
+	// Exporter is where spans go: none, otlp or stdout
+	Exporter string `config:"exporter" env:"TRACING_EXPORTER"`
+	// Endpoint is the OTLP/HTTP collector URL; when empty the standard
+	// OTEL_EXPORTER_OTLP_* variables apply
+	Endpoint    string  `config:"endpoint" env:"TRACING_ENDPOINT"`
+	ServiceName string  `config:"service_name" env:"OTEL_SERVICE_NAME"`
+	SampleRatio float64 `config:"sample_ratio" env:"TRACING_SAMPLE_RATIO"`
+}
+
+// Features switch optional parts of the app on and off
+type Features struct {
+	// Registration lets new users sign up, with a password or through OIDC
+	Registration bool `config:"registration" env:"FEATURE_REGISTRATION"`
+	// APITokens lets users create personal API tokens
+	APITokens bool `config:"api_tokens" env:"FEATURE_API_TOKENS"`
+}
+
+// Default returns the settings used when nothing is configured
+func Default() *Config {
+	httpDefaults := http.DefaultLimits()
+	sessionDefaults := sessions.DefaultConfig()
+	authDefaults := auth.DefaultConfig()
+	limits := ratelimit.DefaultConfig()
+
+	return &Config{
+		Server: Server{
+			Port:              "8080",
+			ReadHeaderTimeout: httpDefaults.ReadHeaderTimeout,
+			ReadTimeout:       httpDefaults.ReadTimeout,
+			WriteTimeout:      httpDefaults.WriteTimeout,
+			IdleTimeout:       httpDefaults.IdleTimeout,
+			MaxHeaderBytes:    httpDefaults.MaxHeaderBytes,
+			MaxBodyBytes:      httpDefaults.MaxBodyBytes,
+			ShutdownTimeout:   httpDefaults.ShutdownTimeout,
+		},
+		Log: Log{
+			Level:     "info",
+			Format:    logging.FormatJSON,
+			SlowQuery: 200 * time.Millisecond,
+		},
+		Database: Database{
+			Driver:          db.DriverPostgres,
+			Port:            "5432",
+			SSLMode:         "prefer",
+			SQLitePath:      "chordik.db",
+			MaxOpenConns:    25,
+			MaxIdleConns:    10,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnMaxIdleTime: 5 * time.Minute,
+		},
+		Sessions: Sessions{
+			CookieName:     sessionDefaults.CookieName,
+			CookieSecure:   sessionDefaults.Secure,
+			CookieSameSite: "lax",
+			IdleTTL:        sessionDefaults.IdleTTL,
+			MaxLifetime:    sessionDefaults.MaxLifetime,
+		},
+		Auth: Auth{
+			AppURL:            authDefaults.AppURL,
+			PasswordResetTTL:  authDefaults.ResetTokenTTL,
+			EmailVerifyTTL:    authDefaults.VerifyTokenTTL,
+			PasswordMinLength: authDefaults.Password.MinLength,
+			PasswordMaxLength: authDefaults.Password.MaxLength,
+			PasswordHash:      authDefaults.Hash.Algorithm,
+			BcryptCost:        authDefaults.Hash.BcryptCost,
+			Argon2Memory:      authDefaults.Hash.Argon2Memory,
+			Argon2Iterations:  authDefaults.Hash.Argon2Iterations,
+			Argon2Parallelism: authDefaults.Hash.Argon2Parallelism,
+		},
+		Mail: Mail{
+			Driver:   "log",
+			SMTPPort: "587",
+		},
+		RateLimits: RateLimits{
+			Auth:                 limits.Auth,
+			Write:                limits.Write,
+			Songs:                limits.Songs,
+			Votes:                limits.Votes,
+			LockoutThreshold:     limits.Lockout.Threshold,
+			LockoutBaseDelay:     limits.Lockout.BaseDelay,
+			LockoutMaxDelay:      limits.Lockout.MaxDelay,
+			LockoutFailureWindow: limits.Lockout.Window,
+		},
+		Jobs: Jobs{
+			LeaderboardRefresh: 10 * time.Minute,
+			TrashRetention:     30 * 24 * time.Hour,
+		},
+		Metrics: Metrics{
+			Enabled: true,
+		},
+		Tracing: Tracing{
+			Exporter:    tracing.ExporterNone,
+			ServiceName: "chordik-api",
+			SampleRatio: 1,
+		},
+		Features: Features{
+			Registration: true,
+			APITokens:    true,
+		},
+	}
+}
+
+// Validate checks that required settings are present and that values are
+// in range, reporting every problem at once
+func (c *Config) Validate() error {
+	var errs []error
+	check := func(ok bool, key, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf("%s: "+format, append([]interface{}{key}, args...)...))
+		}
+	}
+
+	port, err := strconv.Atoi(c.Server.Port)
+	check(err == nil && port > 0 && port < 65536, "server.port", "must be a port number, got %q", c.Server.Port)
+	for _, origin := range c.Server.AllowedOrigins {
+		check(isOrigin(origin), "server.allowed_origins", "%q is not an origin like https://example.com", origin)
+	}
+	for _, proxy := range c.Server.TrustedProxies {
+		check(isIPOrCIDR(proxy), "server.trusted_proxies", "%q is not an IP address or CIDR range", proxy)
+	}
+
+	check(c.Server.ReadHeaderTimeout >= 0 && c.Server.ReadTimeout >= 0 && c.Server.WriteTimeout >= 0 &&
+		c.Server.IdleTimeout >= 0 && c.Server.ShutdownTimeout >= 0, "server.*_timeout", "must not be negative")
+	check(c.Server.ShutdownDelay >= 0, "server.shutdown_delay", "must not be negative")
+	check(c.Server.MaxHeaderBytes >= 0, "server.max_header_bytes", "must not be negative")
+	check(c.Server.MaxBodyBytes >= 0, "server.max_body_bytes", "must not be negative")
+
+	check(isOneOf(strings.ToLower(c.Log.Level), "debug", "info", "warn", "error"), "log.level", "must be debug, info, warn or error")
+	check(isOneOf(strings.ToLower(c.Log.Format), logging.FormatJSON, logging.FormatText), "log.format", "must be json or text")
+	check(c.Log.SlowQuery >= 0, "log.slow_query", "must not be negative")
+
+	d := c.Database
+	switch d.Driver {
+	case db.DriverPostgres:
+		if d.DSN == "" {
+			check(d.Host != "", "database.host", "required for postgres unless database.dsn is set")
+			check(d.User != "", "database.user", "required for postgres unless database.dsn is set")
+			check(d.Name != "", "database.name", "required for postgres unless database.dsn is set")
+			check(isOneOf(d.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full"),
+				"database.ssl_mode", "must be disable, allow, prefer, require, verify-ca or verify-full")
+		}
+	case db.DriverSQLite:
+		check(d.SQLitePath != "", "database.sqlite_path", "required for sqlite")
+	default:
+		check(false, "database.driver", "must be postgres or sqlite, got %q", d.Driver)
+	}
+	check(d.MaxOpenConns >= 0, "database.max_open_conns", "must not be negative")
+	check(d.MaxIdleConns >= 0, "database.max_idle_conns", "must not be negative")
+
+	check(c.Sessions.CookieName != "", "sessions.cookie_name", "required")
+	check(isOneOf(strings.ToLower(c.Sessions.CookieSameSite), "lax", "strict", "none"), "sessions.cookie_same_site", "must be lax, strict or none")
+	check(c.Sessions.IdleTTL > 0, "sessions.idle_ttl", "must be positive")
+	check(c.Sessions.MaxLifetime >= c.Sessions.IdleTTL, "sessions.max_lifetime", "must be at least sessions.idle_ttl")
+
+	a := c.Auth
+	appURL, err := url.Parse(a.AppURL)
+	check(err == nil && (appURL.Scheme == "http" || appURL.Scheme == "https") && appURL.Host != "",
+		"auth.app_url", "must be an http or https URL, got %q", a.AppURL)
+	check(a.PasswordResetTTL > 0, "auth.password_reset_ttl", "must be positive")
+	check(a.EmailVerifyTTL > 0, "auth.email_verify_ttl", "must be positive")
+	check(a.PasswordMinLength > 0, "auth.password_min_length", "must be positive")
+	check(a.PasswordMaxLength >= a.PasswordMinLength, "auth.password_max_length", "must be at least auth.password_min_length")
+	check(isOneOf(a.PasswordHash, auth.HashBcrypt, auth.HashArgon2id), "auth.password_hash", "must be bcrypt or argon2id")
+	check(a.PasswordHash != auth.HashBcrypt || a.PasswordMaxLength <= auth.BcryptMaxBytes,
+		"auth.password_max_length", "must be at most %d with bcrypt, which can't hash longer passwords", auth.BcryptMaxBytes)
+	check(a.BcryptCost >= 4 && a.BcryptCost <= 31, "auth.bcrypt_cost", "must be between 4 and 31")
+	check(a.Argon2Memory > 0 && a.Argon2Iterations > 0 && a.Argon2Parallelism > 0, "auth.argon2_*", "must be positive")
+
+	switch c.Mail.Driver {
+	case "log":
+	case "smtp":
+		check(c.Mail.SMTPHost != "", "mail.smtp_host", "required for smtp")
+		check(c.Mail.From != "", "mail.from", "required for smtp")
+	default:
+		check(false, "mail.driver", "must be log or smtp, got %q", c.Mail.Driver)
+	}
+
+	if c.OIDC.Issuer != "" {
+		check(c.OIDC.ClientID != "", "oidc.client_id", "required when oidc.issuer is set")
+	}
+
+	check(c.RateLimits.LockoutThreshold >= 0, "rate_limits.lockout_threshold", "must not be negative")
+	check(c.Jobs.LeaderboardRefresh > 0, "jobs.leaderboard_refresh", "must be positive")
+	check(c.Jobs.TrashRetention > 0, "jobs.trash_retention", "must be positive")
+
+	if c.Metrics.Addr != "" {
+		_, metricsPort, err := net.SplitHostPort(c.Metrics.Addr)
+		check(err == nil && metricsPort != c.Server.Port, "metrics.addr", "must be a host:port other than the API port, got %q", c.Metrics.Addr)
+	}
+
+	check(isOneOf(c.Tracing.Exporter, tracing.ExporterNone, tracing.ExporterOTLP, tracing.ExporterStdout), "tracing.exporter", "must be none, otlp or stdout")
+	if c.Tracing.Endpoint != "" {
+		endpoint, err := url.Parse(c.Tracing.Endpoint)
+		check(err == nil && (endpoint.Scheme == "http" || endpoint.Scheme == "https") && endpoint.Host != "",
+			"tracing.endpoint", "must be an http or https URL, got %q", c.Tracing.Endpoint)
+	}
+	check(c.Tracing.SampleRatio >= 0 && c.Tracing.SampleRatio <= 1, "tracing.sample_ratio", "must be between 0 and 1")
+
+	return errors.Join(errs...)
+}
+
+func isOneOf(value string, options ...string) bool {
+	for _, option := range options {
+		if value == option {
+			return true
+		}
+	}
+	return false
+}
+
+// isOrigin reports whether a value is a scheme and host with nothing else
+func isOrigin(value string) bool {
+	u, err := url.Parse(value)
+	return err == nil && u.Scheme != "" && u.Host != "" && (u.Path == "" || u.Path == "/") && u.RawQuery == ""
+}
+
+func isIPOrCIDR(value string) bool {
+	if _, _, err := net.ParseCIDR(value); err == nil {
+		return true
+	}
+	return net.ParseIP(value) != nil
+}
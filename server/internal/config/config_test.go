@@ -0,0 +1,135 @@
+package config
+
+import (
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		value, ok := values[key]
+		return value, ok
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "chordik.yaml")
+	content := `
+server:
+  port: 9000
+  allowed_origins: [https://a.example, https://b.example]
+database:
+  driver: sqlite
+  sqlite_path: file.db
+  max_open_conns: 5
+jobs:
+  trash_retention: 48h
+features:
+  registration: false
+`
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(file, env(map[string]string{
+		"SQLITE_PATH":       "env.db",
+		"DB_MAX_OPEN_CONNS": "",
+		"RATE_LIMIT_AUTH":   "5/1m",
+	}), map[string]string{"server.port": "9100"})
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	if cfg.Server.Port != "9100" {
+		t.Errorf("port = %q, want the override", cfg.Server.Port)
+	}
+	if cfg.Database.SQLitePath != "env.db" {
+		t.Errorf("sqlite path = %q, want the environment value", cfg.Database.SQLitePath)
+	}
+	if cfg.Database.MaxOpenConns != 5 {
+		t.Errorf("max open conns = %d, want the file value as the variable is empty", cfg.Database.MaxOpenConns)
+	}
+	if len(cfg.Server.AllowedOrigins) != 2 || cfg.Jobs.TrashRetention != 48*time.Hour || cfg.Features.Registration {
+		t.Errorf("file values not applied: %+v", cfg)
+	}
+	if cfg.RateLimits.Auth.Requests != 5 || cfg.RateLimits.Auth.Period != time.Minute {
+		t.Errorf("auth limit = %+v, want 5/1m", cfg.RateLimits.Auth)
+	}
+	if !cfg.Database.ShouldAutoMigrate() {
+		t.Error("SQLite should migrate on startup by default")
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "chordik.toml")
+	content := "[database]\ndriver = \"sqlite\"\nauto_migrate = false\n"
+	if err := os.WriteFile(file, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := Load(file, env(nil), nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if cfg.Database.ShouldAutoMigrate() {
+		t.Error("auto_migrate = false was ignored")
+	}
+}
+
+func TestLoadRejectsInvalid(t *testing.T) {
+	_, err := Load("", env(map[string]string{
+		"DB_HOST":               "",
+		"PORT":                  "http",
+		"SESSION_COOKIE_SECURE": "yes please",
+	}), nil)
+	if err == nil || !strings.Contains(err.Error(), "SESSION_COOKIE_SECURE") {
+		t.Fatalf("err = %v, want the bad boolean reported", err)
+	}
+
+	_, err = Load("", env(map[string]string{"PORT": "http", "MAIL_DRIVER": "smtp", "TRUSTED_PROXIES": "10.0.0.0/8,proxy.internal"}), nil)
+	if err == nil {
+		t.Fatal("expected validation errors")
+	}
+	for _, key := range []string{"server.port", "database.host", "mail.smtp_host", "server.trusted_proxies"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("error does not mention %s: %v", key, err)
+		}
+	}
+
+	if _, err := Load("", env(nil), map[string]string{"database.nope": "1"}); err == nil {
+		t.Error("unknown setting was accepted")
+	}
+
+	// bcrypt can't hash more than 72 bytes; argon2id has no such limit
+	long := map[string]string{"DB_DRIVER": "sqlite", "SQLITE_PATH": "chordik.db", "PASSWORD_MAX_LENGTH": "128"}
+	_, err = Load("", env(long), nil)
+	if err == nil || !strings.Contains(err.Error(), "auth.password_max_length") {
+		t.Errorf("err = %v, want a too long password_max_length for bcrypt reported", err)
+	}
+	long["PASSWORD_HASH"] = "argon2id"
+	if _, err := Load("", env(long), nil); err != nil {
+		t.Errorf("password_max_length 128 with argon2id: %v", err)
+	}
+}
+
+func TestLogValueRedactsSecrets(t *testing.T) {
+	cfg := Default()
+	cfg.Database.Password = "hunter2"
+	cfg.Database.DSN = "postgres://u:hunter2@db/chordik"
+
+	var out strings.Builder
+	slog.New(slog.NewTextHandler(&out, nil)).Info("configuration", "config", cfg)
+	if strings.Contains(out.String(), "hunter2") {
+		t.Errorf("secret logged:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "config.database.password=[redacted]") {
+		t.Errorf("password missing:\n%s", out.String())
+	}
+	if !strings.Contains(out.String(), "config.rate_limits.auth=") {
+		t.Errorf("rate limit missing:\n%s", out.String())
+	}
+}
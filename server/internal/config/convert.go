@@ -0,0 +1,158 @@
+package config
+
+import (
+	nethttp "net/http"
+	"strings"
+
+	"github.com/supercakecrumb/chordik/internal/auth"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/http"
+	"github.com/supercakecrumb/chordik/internal/mail"
+	"github.com/supercakecrumb/chordik/internal/ratelimit"
+	"github.com/supercakecrumb/chordik/internal/sessions"
+	"github.com/supercakecrumb/chordik/internal/tracing"
+)
+
+// Limits returns the connection timeouts and request size limits
+func (s Server) Limits() http.Limits {
+	return http.Limits{
+		ReadHeaderTimeout: s.ReadHeaderTimeout,
+		ReadTimeout:       s.ReadTimeout,
+		WriteTimeout:      s.WriteTimeout,
+		IdleTimeout:       s.IdleTimeout,
+		MaxHeaderBytes:    s.MaxHeaderBytes,
+		MaxBodyBytes:      s.MaxBodyBytes,
+		ShutdownTimeout:   s.ShutdownTimeout,
+		ShutdownDelay:     s.ShutdownDelay,
+	}
+}
+
+// DB returns the connection settings for the db package
+func (d Database) DB() db.Config {
+	return db.Config{
+		Driver:          d.Driver,
+		Host:            d.Host,
+		User:            d.User,
+		Password:        d.Password,
+		Name:            d.Name,
+		Port:            d.Port,
+		DSN:             d.DSN,
+		SSLMode:         d.SSLMode,
+		SSLRootCert:     d.SSLRootCert,
+		SQLitePath:      d.SQLitePath,
+		MaxOpenConns:    d.MaxOpenConns,
+		MaxIdleConns:    d.MaxIdleConns,
+		ConnMaxLifetime: d.ConnMaxLifetime,
+		ConnMaxIdleTime: d.ConnMaxIdleTime,
+	}
+}
+
+// ShouldAutoMigrate reports whether migrations run on startup
+func (d Database) ShouldAutoMigrate() bool {
+	if d.AutoMigrate != nil {
+		return *d.AutoMigrate
+	}
+	return d.Driver == db.DriverSQLite
+}
+
+// Config returns the settings for the sessions package
+func (s Sessions) Config() sessions.Config {
+	config := sessions.DefaultConfig()
+	config.CookieName = s.CookieName
+	config.Domain = s.CookieDomain
+	config.Secure = s.CookieSecure
+	config.IdleTTL = s.IdleTTL
+	config.MaxLifetime = s.MaxLifetime
+
+	switch strings.ToLower(s.CookieSameSite) {
+	case "strict":
+		config.SameSite = nethttp.SameSiteStrictMode
+	case "none":
+		// Browsers reject SameSite=None cookies that are not Secure
+		config.SameSite = nethttp.SameSiteNoneMode
+		config.Secure = true
+	default:
+		config.SameSite = nethttp.SameSiteLaxMode
+	}
+
+	return config
+}
+
+// AuthConfig returns the settings for the auth package, with the mailer
+// the mail settings select
+func (c *Config) AuthConfig() auth.Config {
+	config := auth.DefaultConfig()
+	config.AppURL = c.AppURL()
+	config.ResetTokenTTL = c.Auth.PasswordResetTTL
+	config.VerifyTokenTTL = c.Auth.EmailVerifyTTL
+	config.Password.MinLength = c.Auth.PasswordMinLength
+	config.Password.MaxLength = c.Auth.PasswordMaxLength
+	config.Password.BreachedList = c.Auth.PasswordBreachedList
+	config.Hash.Algorithm = c.Auth.PasswordHash
+	config.Hash.BcryptCost = c.Auth.BcryptCost
+	config.Hash.Argon2Memory = c.Auth.Argon2Memory
+	config.Hash.Argon2Iterations = c.Auth.Argon2Iterations
+	config.Hash.Argon2Parallelism = c.Auth.Argon2Parallelism
+	config.Registration = c.Features.Registration
+
+	switch c.Mail.Driver {
+	case "smtp":
+		config.Mailer = mail.NewSMTPMailer(mail.SMTPConfig{
+			Host:     c.Mail.SMTPHost,
+			Port:     c.Mail.SMTPPort,
+			Username: c.Mail.SMTPUsername,
+			Password: c.Mail.SMTPPassword,
+			From:     c.Mail.From,
+		})
+	default:
+		config.Mailer = mail.NewLogMailer(c.Mail.LogPath)
+	}
+
+	return config
+}
+
+// AppURL returns the public URL of the web app without a trailing slash
+func (c *Config) AppURL() string {
+	return strings.TrimSuffix(c.Auth.AppURL, "/")
+}
+
+// OIDCConfig returns the OpenID Connect provider settings. The callback
+// defaults to the API behind the app URL.
+func (c *Config) OIDCConfig() auth.OIDCConfig {
+	config := auth.OIDCConfig{
+		Name:         c.OIDC.ProviderName,
+		Issuer:       c.OIDC.Issuer,
+		ClientID:     c.OIDC.ClientID,
+		ClientSecret: c.OIDC.ClientSecret,
+		RedirectURL:  c.OIDC.RedirectURL,
+		Scopes:       c.OIDC.Scopes,
+	}
+	if config.RedirectURL == "" {
+		config.RedirectURL = c.AppURL() + "/api/auth/oidc/callback"
+	}
+	return config
+}
+
+// Config returns the settings for the ratelimit package
+func (r RateLimits) Config() ratelimit.Config {
+	config := ratelimit.DefaultConfig()
+	config.Auth = r.Auth
+	config.Write = r.Write
+	config.Songs = r.Songs
+	config.Votes = r.Votes
+	config.Lockout.Threshold = r.LockoutThreshold
+	config.Lockout.BaseDelay = r.LockoutBaseDelay
+	config.Lockout.MaxDelay = r.LockoutMaxDelay
+	config.Lockout.Window = r.LockoutFailureWindow
+	return config
+}
+
+// Config returns the settings for the tracing package
+func (t Tracing) Config() tracing.Config {
+	return tracing.Config{
+		Exporter:    t.Exporter,
+		Endpoint:    t.Endpoint,
+		ServiceName: t.ServiceName,
+		SampleRatio: t.SampleRatio,
+	}
+}
@@ -0,0 +1,349 @@
+package config
+
+import (
+	"encoding"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// fileEnv names the environment variable pointing at a config file
+const fileEnv = "CHORDIK_CONFIG"
+
+// Load builds the configuration from the defaults, then a config file if
+// one is given, then the environment, then overrides keyed like the file
+// (e.g. "database.host"), and validates the result
+func Load(file string, lookupEnv func(string) (string, bool), overrides map[string]string) (*Config, error) {
+	c := Default()
+
+	if file != "" {
+		if err := c.loadFile(file); err != nil {
+			return nil, err
+		}
+	}
+
+	err := walk(reflect.ValueOf(c).Elem(), "", func(key string, field reflect.StructField, v reflect.Value) error {
+		name := field.Tag.Get("env")
+		if name == "" {
+			return nil
+		}
+		// Empty variables count as unset, as compose files often leave them
+		if value, ok := lookupEnv(name); ok && value != "" {
+			if err := setValue(v, value); err != nil {
+				return fmt.Errorf("invalid %s: %w", name, err)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range overrides {
+		if err := c.Set(key, value); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return c, nil
+}
+
+// Set changes a single setting by its config file key
+func (c *Config) Set(key, value string) error {
+	found := false
+	err := walk(reflect.ValueOf(c).Elem(), "", func(k string, _ reflect.StructField, v reflect.Value) error {
+		if k != key {
+			return nil
+		}
+		found = true
+		if err := setValue(v, value); err != nil {
+			return fmt.Errorf("invalid %s: %w", key, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if !found {
+		return fmt.Errorf("unknown setting %q", key)
+	}
+	return nil
+}
+
+// loadFile applies a YAML or TOML file, picked by its extension. Nested
+// tables map to the sections of Config.
+func (c *Config) loadFile(file string) error {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	values := map[string]interface{}{}
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(content, &values)
+	case ".toml":
+		err = toml.Unmarshal(content, &values)
+	default:
+		return fmt.Errorf("unsupported config file %s: use .yaml, .yml or .toml", file)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse %s: %w", file, err)
+	}
+
+	settings := map[string]string{}
+	flatten("", values, settings)
+	for key, value := range settings {
+		if err := c.Set(key, value); err != nil {
+			return fmt.Errorf("%s: %w", file, err)
+		}
+	}
+	return nil
+}
+
+// flatten turns nested tables into dotted keys. Lists become
+// comma-separated, the same as in environment variables.
+func flatten(prefix string, values map[string]interface{}, out map[string]string) {
+	for key, value := range values {
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+		switch value := value.(type) {
+		case map[string]interface{}:
+			flatten(key, value, out)
+		case []interface{}:
+			items := make([]string, len(value))
+			for i, item := range value {
+				items[i] = fmt.Sprint(item)
+			}
+			out[key] = strings.Join(items, ",")
+		case nil:
+			out[key] = ""
+		default:
+			out[key] = fmt.Sprint(value)
+		}
+	}
+}
+
+// walk calls fn for every setting with its dotted key
+func walk(v reflect.Value, prefix string, fn func(key string, field reflect.StructField, v reflect.Value) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key := field.Tag.Get("config")
+		if key == "" {
+			continue
+		}
+		if prefix != "" {
+			key = prefix + "." + key
+		}
+
+		value := v.Field(i)
+		if value.Kind() == reflect.Struct && !isScalar(value) {
+			if err := walk(value, key, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := fn(key, field, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isScalar reports whether a struct is a single setting, like a rate limit
+func isScalar(v reflect.Value) bool {
+	_, ok := v.Addr().Interface().(encoding.TextUnmarshaler)
+	return ok
+}
+
+// setValue parses a setting from its text form
+func setValue(v reflect.Value, raw string) error {
+	if u, ok := v.Addr().Interface().(encoding.TextUnmarshaler); ok {
+		return u.UnmarshalText([]byte(raw))
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		elem := reflect.New(v.Type().Elem())
+		if err := setValue(elem.Elem(), raw); err != nil {
+			return err
+		}
+		v.Set(elem)
+	case reflect.String:
+		v.SetString(raw)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", raw)
+		}
+		v.SetBool(b)
+	case reflect.Int, reflect.Int64:
+		if v.Type() == reflect.TypeOf(time.Duration(0)) {
+			d, err := time.ParseDuration(raw)
+			if err != nil {
+				return fmt.Errorf("%q is not a duration", raw)
+			}
+			v.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not an integer", raw)
+		}
+		v.SetInt(n)
+	case reflect.Float64:
+		f, err := strconv.ParseFloat(raw, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", raw)
+		}
+		v.SetFloat(f)
+	case reflect.Uint8, reflect.Uint32:
+		n, err := strconv.ParseUint(raw, 10, v.Type().Bits())
+		if err != nil {
+			return fmt.Errorf("%q is not a non-negative integer in range", raw)
+		}
+		v.SetUint(n)
+	case reflect.Slice:
+		var items []string
+		for _, item := range strings.Split(raw, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		v.Set(reflect.ValueOf(items))
+	default:
+		return fmt.Errorf("unsupported setting type %s", v.Type())
+	}
+	return nil
+}
+
+// formatValue renders a setting for printing
+func formatValue(v reflect.Value) string {
+	if m, ok := v.Interface().(encoding.TextMarshaler); ok {
+		text, _ := m.MarshalText()
+		return string(text)
+	}
+
+	switch v.Kind() {
+	case reflect.Ptr:
+		if v.IsNil() {
+			return "(default)"
+		}
+		return formatValue(v.Elem())
+	case reflect.Slice:
+		items := make([]string, v.Len())
+		for i := range items {
+			items[i] = fmt.Sprint(v.Index(i).Interface())
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// LogValue logs every setting, with secrets redacted
+func (c *Config) LogValue() slog.Value {
+	return slog.GroupValue(c.settings()...)
+}
+
+// settings lists every setting in its text form, with secrets redacted
+func (c *Config) settings() []slog.Attr {
+	var attrs []slog.Attr
+	walk(reflect.ValueOf(c).Elem(), "", func(key string, field reflect.StructField, v reflect.Value) error {
+		value := formatValue(v)
+		if field.Tag.Get("secret") == "true" && value != "" {
+			value = "[redacted]"
+		}
+		attrs = append(attrs, slog.String(key, value))
+		return nil
+	})
+	return attrs
+}
+
+// Flags are the command line options for loading the configuration. Only
+// flags that were given override other sources.
+type Flags struct {
+	fs        *flag.FlagSet
+	file      *string
+	values    map[string]*string
+	overrides settingList
+}
+
+// flagSettings are the settings with a dedicated flag; any other setting
+// can be given with -set
+var flagSettings = []struct {
+	name  string
+	key   string
+	usage string
+}{
+	{"port", "server.port", "port to listen on"},
+	{"db-driver", "database.driver", "database driver: postgres or sqlite"},
+	{"db-dsn", "database.dsn", "Postgres connection string"},
+	{"sqlite-path", "database.sqlite_path", "SQLite database file, or :memory:"},
+}
+
+// RegisterFlags adds the configuration flags to a flag set
+func RegisterFlags(fs *flag.FlagSet) *Flags {
+	f := &Flags{
+		fs:     fs,
+		file:   fs.String("config", "", "YAML or TOML config file (default $"+fileEnv+")"),
+		values: make(map[string]*string, len(flagSettings)),
+	}
+	for _, s := range flagSettings {
+		f.values[s.name] = fs.String(s.name, "", s.usage)
+	}
+	fs.Var(&f.overrides, "set", "override a setting as key=value, e.g. database.max_open_conns=10 (repeatable)")
+	return f
+}
+
+// Load reads the configuration using the parsed flags and the environment
+func (f *Flags) Load() (*Config, error) {
+	file := *f.file
+	if file == "" {
+		file = os.Getenv(fileEnv)
+	}
+
+	overrides := make(map[string]string, len(f.overrides))
+	for _, s := range f.overrides {
+		key, value, _ := strings.Cut(s, "=")
+		overrides[strings.TrimSpace(key)] = value
+	}
+	f.fs.Visit(func(fl *flag.Flag) {
+		for _, s := range flagSettings {
+			if s.name == fl.Name {
+				overrides[s.key] = *f.values[s.name]
+			}
+		}
+	})
+
+	return Load(file, os.LookupEnv, overrides)
+}
+
+// settingList collects repeated -set flags
+type settingList []string
+
+func (l *settingList) String() string {
+	return strings.Join(*l, " ")
+}
+
+func (l *settingList) Set(value string) error {
+	if !strings.Contains(value, "=") {
+		return fmt.Errorf("expected key=value, got %q", value)
+	}
+	*l = append(*l, value)
+	return nil
+}
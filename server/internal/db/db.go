@@ -2,22 +2,141 @@ package db
 
 import (
 	"fmt"
+	"reflect"
+	"strings"
+	"time"
 
+	"github.com/glebarez/sqlite"
+	"github.com/google/uuid"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
 )
 
-// PostgresConnection holds the database connection
-type PostgresConnection struct {
+// Database drivers
+const (
+	DriverPostgres = "postgres"
+	DriverSQLite   = "sqlite"
+)
+
+// Config selects the database backend and how to reach it
+type Config struct {
+	Driver   string // postgres (default) or sqlite
+	Host     string
+	User     string
+	Password string
+	Name     string
+	Port     string
+	// DSN is a full Postgres connection string that takes the place of the
+	// separate settings above
+	DSN string
+	// SSLMode and SSLRootCert set how Postgres connections are encrypted.
+	// SSLMode defaults to disable.
+	SSLMode     string
+	SSLRootCert string
+	// SQLitePath is the database file, chordik.db by default, or ":memory:"
+	// for a throwaway database that lives as long as the process
+	SQLitePath string
+
+	// Pool limits for Postgres; zero leaves the database/sql default
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+
+	// Logger receives GORM's query logs. Defaults to GORM's own logger.
+	Logger logger.Interface
+}
+
+// postgresDSN builds the connection string for the config
+func (c Config) postgresDSN() string {
+	if c.DSN != "" {
+		return c.DSN
+	}
+
+	sslMode := c.SSLMode
+	if sslMode == "" {
+		sslMode = "disable"
+	}
+	params := []string{
+		"host=" + quoteDSN(c.Host),
+		"user=" + quoteDSN(c.User),
+		"password=" + quoteDSN(c.Password),
+		"dbname=" + quoteDSN(c.Name),
+		"port=" + quoteDSN(c.Port),
+		"sslmode=" + quoteDSN(sslMode),
+	}
+	if c.SSLRootCert != "" {
+		params = append(params, "sslrootcert="+quoteDSN(c.SSLRootCert))
+	}
+	return strings.Join(params, " ")
+}
+
+// quoteDSN quotes a connection string value if it is empty or has spaces,
+// quotes or backslashes in it
+func quoteDSN(value string) string {
+	if value != "" && !strings.ContainsAny(value, " '\\") {
+		return value
+	}
+	value = strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+	return "'" + value + "'"
+}
+
+// Connection holds the database connection
+type Connection struct {
 	DB *gorm.DB
 }
 
+// Close closes the connection pool
+func (c *Connection) Close() error {
+	sqlDB, err := c.DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
+// NewConnection connects to the backend selected by the config
+func NewConnection(config Config) (*Connection, error) {
+	switch config.Driver {
+	case "", DriverPostgres:
+		conn, err := openPostgres(config.postgresDSN(), config.Logger)
+		if err != nil {
+			return nil, err
+		}
+
+		sqlDB, err := conn.DB.DB()
+		if err != nil {
+			return nil, fmt.Errorf("failed to connect to database: %w", err)
+		}
+		if config.MaxOpenConns > 0 {
+			sqlDB.SetMaxOpenConns(config.MaxOpenConns)
+		}
+		if config.MaxIdleConns > 0 {
+			sqlDB.SetMaxIdleConns(config.MaxIdleConns)
+		}
+		sqlDB.SetConnMaxLifetime(config.ConnMaxLifetime)
+		sqlDB.SetConnMaxIdleTime(config.ConnMaxIdleTime)
+
+		return conn, nil
+	case DriverSQLite:
+		path := config.SQLitePath
+		if path == "" {
+			path = "chordik.db"
+		}
+		return openSQLite(path, config.Logger)
+	default:
+		return nil, fmt.Errorf("unknown database driver %q: must be postgres or sqlite", config.Driver)
+	}
+}
+
 // NewPostgresConnection creates a new database connection
-func NewPostgresConnection(host, user, password, dbname, port string) (*PostgresConnection, error) {
-	dsn := fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%s sslmode=disable",
-		host, user, password, dbname, port)
+func NewPostgresConnection(host, user, password, dbname, port string) (*Connection, error) {
+	return openPostgres(Config{Host: host, User: user, Password: password, Name: dbname, Port: port}.postgresDSN(), nil)
+}
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+func openPostgres(dsn string, log logger.Interface) (*Connection, error) {
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: log})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
@@ -31,23 +150,68 @@ func NewPostgresConnection(host, user, password, dbname, port string) (*Postgres
 		return nil, fmt.Errorf("failed to create citext extension: %w", err)
 	}
 
-	return &PostgresConnection{DB: db}, nil
+	return &Connection{DB: db}, nil
+}
+
+// NewSQLiteConnection opens an SQLite database file, creating it if needed.
+// It needs no database server, which suits tests and small self-hosted
+// instances.
+func NewSQLiteConnection(path string) (*Connection, error) {
+	return openSQLite(path, nil)
+}
+
+func openSQLite(path string, log logger.Interface) (*Connection, error) {
+	if path == "" {
+		return nil, fmt.Errorf("failed to connect to database: no SQLite path configured")
+	}
+
+	// Foreign keys are off by default in SQLite, and concurrent writers
+	// should wait for the lock instead of failing right away
+	dsn := path + "?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{Logger: log})
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	sqlDB, err := db.DB()
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+	// SQLite allows a single writer, and every connection to ":memory:"
+	// would otherwise get its own empty database
+	sqlDB.SetMaxOpenConns(1)
+
+	if err := db.Callback().Create().Before("gorm:create").Register("chordik:uuid", assignUUIDs); err != nil {
+		return nil, fmt.Errorf("failed to connect to database: %w", err)
+	}
+
+	return &Connection{DB: db}, nil
 }
 
-// Migrate runs database migrations for all models
-func Migrate(db *gorm.DB) error {
-	models := []interface{}{
-		&User{},
-		&Session{},
-		&Song{},
-		&SongLike{},
-		&Badge{},
-		&UserBadge{},
+// assignUUIDs gives new rows a random ID before they are inserted. Postgres
+// fills IDs in with gen_random_uuid(), which SQLite has no equivalent of.
+func assignUUIDs(tx *gorm.DB) {
+	if tx.Statement.Schema == nil {
+		return
+	}
+	field := tx.Statement.Schema.PrioritizedPrimaryField
+	if field == nil || field.FieldType != reflect.TypeOf(uuid.UUID{}) {
+		return
 	}
 
-	if err := db.AutoMigrate(models...); err != nil {
-		return fmt.Errorf("failed to migrate models: %w", err)
+	assign := func(rv reflect.Value) {
+		if _, zero := field.ValueOf(tx.Statement.Context, rv); zero {
+			tx.AddError(field.Set(tx.Statement.Context, rv, uuid.New()))
+		}
 	}
 
-	return nil
+	rv := tx.Statement.ReflectValue
+	switch rv.Kind() {
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			assign(reflect.Indirect(rv.Index(i)))
+		}
+	case reflect.Struct:
+		assign(rv)
+	}
 }
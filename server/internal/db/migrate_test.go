@@ -0,0 +1,191 @@
+package db
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// models lists every table the application reads and writes
+var models = []interface{}{
+	&User{}, &Session{}, &Song{}, &SongLike{}, &Badge{}, &UserBadge{},
+	&BadgeEvent{}, &LeaderboardEntry{}, &Comment{}, &EditSuggestion{},
+	&Report{}, &UserWarning{}, &UserToken{}, &UserIdentity{}, &APIToken{},
+	&RecoveryCode{},
+}
+
+// checkColumns fails the test for every model column the schema lacks
+func checkColumns(t *testing.T, db *gorm.DB) {
+	t.Helper()
+
+	for _, model := range models {
+		stmt := &gorm.Statement{DB: db}
+		if err := stmt.Parse(model); err != nil {
+			t.Fatal(err)
+		}
+		for _, field := range stmt.Schema.Fields {
+			if field.DBName == "" {
+				continue
+			}
+			if !db.Migrator().HasColumn(model, field.DBName) {
+				t.Errorf("%s has no column %s", stmt.Schema.Table, field.DBName)
+			}
+		}
+	}
+}
+
+func TestMigrateSQLite(t *testing.T) {
+	conn, err := NewSQLiteConnection(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if err := Migrate(conn.DB); err != nil {
+		t.Fatal(err)
+	}
+	checkColumns(t, conn.DB)
+}
+
+// The tables as an older AutoMigrate release created them. The baseline
+// indexes the session token hash and the song status, so those columns
+// must exist for it to adopt the tables; the rest is added afterwards.
+type (
+	autoMigratedUser struct {
+		ID           uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+		Email        string    `gorm:"type:citext;unique;not null"`
+		PasswordHash string    `gorm:"type:text;not null"`
+		DisplayName  string    `gorm:"type:text;unique;not null"`
+		CreatedAt    time.Time `gorm:"autoCreateTime"`
+		UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+	}
+	autoMigratedSession struct {
+		ID        uuid.UUID        `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+		UserID    uuid.UUID        `gorm:"type:uuid;not null"`
+		User      autoMigratedUser `gorm:"foreignKey:UserID"`
+		TokenHash *string          `gorm:"type:text"`
+		CreatedAt time.Time        `gorm:"autoCreateTime"`
+		ExpiresAt time.Time        `gorm:"not null"`
+	}
+	autoMigratedSong struct {
+		ID           uuid.UUID        `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+		Title        string           `gorm:"type:text;not null;index"`
+		Artist       string           `gorm:"type:text;not null;index"`
+		BodyChordPro string           `gorm:"type:text;not null"`
+		Key          string           `gorm:"type:text"`
+		CreatedByID  uuid.UUID        `gorm:"type:uuid;not null"`
+		CreatedBy    autoMigratedUser `gorm:"foreignKey:CreatedByID"`
+		Status       string           `gorm:"type:text;not null;default:visible"`
+		DeletedAt    *time.Time
+		CreatedAt    time.Time `gorm:"autoCreateTime"`
+		UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+	}
+	autoMigratedSongLike struct {
+		ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+		SongID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_song_user"`
+		UserID    uuid.UUID `gorm:"type:uuid;not null;uniqueIndex:idx_song_user"`
+		Value     int16     `gorm:"not null"`
+		CreatedAt time.Time `gorm:"autoCreateTime"`
+	}
+	autoMigratedBadge struct {
+		ID          uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+		Code        string    `gorm:"type:text;unique;not null"`
+		Name        string    `gorm:"type:text;not null"`
+		Description string    `gorm:"type:text;not null"`
+	}
+	autoMigratedUserBadge struct {
+		ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+		UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+		BadgeID   uuid.UUID `gorm:"type:uuid;not null"`
+		AwardedAt time.Time `gorm:"autoCreateTime"`
+	}
+)
+
+func (autoMigratedUser) TableName() string      { return "users" }
+func (autoMigratedSession) TableName() string   { return "sessions" }
+func (autoMigratedSong) TableName() string      { return "songs" }
+func (autoMigratedSongLike) TableName() string  { return "song_likes" }
+func (autoMigratedBadge) TableName() string     { return "badges" }
+func (autoMigratedUserBadge) TableName() string { return "user_badges" }
+
+// TestMigrateAdoptsAutoMigrateSchema checks that the migrations bring a
+// database created by AutoMigrate up to the current schema and keep its
+// rows. It needs CHORDIK_TEST_POSTGRES_DSN to point at an empty database,
+// which it leaves empty again.
+func TestMigrateAdoptsAutoMigrateSchema(t *testing.T) {
+	dsn := os.Getenv("CHORDIK_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("CHORDIK_TEST_POSTGRES_DSN is not set")
+	}
+
+	conn, err := openPostgres(dsn, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if err := conn.DB.AutoMigrate(&autoMigratedUser{}, &autoMigratedSession{}, &autoMigratedSong{},
+		&autoMigratedSongLike{}, &autoMigratedBadge{}, &autoMigratedUserBadge{}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		for _, table := range []string{"user_badges", "badges", "song_likes", "songs", "sessions", "users"} {
+			conn.DB.Exec(`DROP TABLE IF EXISTS "` + table + `" CASCADE`)
+		}
+	})
+
+	user := autoMigratedUser{Email: "ana@example.com", PasswordHash: "hash", DisplayName: "Ana"}
+	if err := conn.DB.Create(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	song := autoMigratedSong{Title: "Song", Artist: "Artist", BodyChordPro: "[C]La", CreatedByID: user.ID}
+	if err := conn.DB.Create(&song).Error; err != nil {
+		t.Fatal(err)
+	}
+	session := autoMigratedSession{UserID: user.ID, ExpiresAt: time.Now().Add(time.Hour)}
+	if err := conn.DB.Create(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	migrator, err := NewMigrator(conn.DB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := migrator.Up(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := migrator.Down(len(migrator.migrations)); err != nil {
+			t.Error(err)
+		}
+		conn.DB.Exec(`DROP TABLE IF EXISTS "schema_migrations"`)
+	})
+
+	checkColumns(t, conn.DB)
+
+	var adopted User
+	if err := conn.DB.First(&adopted, "id = ?", user.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if adopted.Role != "user" || adopted.EmailVerifiedAt != nil {
+		t.Errorf("adopted user has role %q and verified at %v", adopted.Role, adopted.EmailVerifiedAt)
+	}
+
+	var adoptedSong Song
+	if err := conn.DB.First(&adoptedSong, "id = ?", song.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if adoptedSong.Status != "visible" {
+		t.Errorf("adopted song has status %q, want visible", adoptedSong.Status)
+	}
+
+	// Sessions from before token hashes can't be looked up, so they go
+	var sessions int64
+	conn.DB.Model(&Session{}).Count(&sessions)
+	if sessions != 0 {
+		t.Errorf("%d sessions without a token hash were kept", sessions)
+	}
+}
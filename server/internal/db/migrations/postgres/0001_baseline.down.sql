@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS "recovery_codes";
+DROP TABLE IF EXISTS "api_tokens";
+DROP TABLE IF EXISTS "user_identities";
+DROP TABLE IF EXISTS "user_tokens";
+DROP TABLE IF EXISTS "user_warnings";
+DROP TABLE IF EXISTS "reports";
+DROP TABLE IF EXISTS "edit_suggestions";
+DROP TABLE IF EXISTS "comments";
+DROP TABLE IF EXISTS "leaderboard_entries";
+DROP TABLE IF EXISTS "badge_events";
+DROP TABLE IF EXISTS "user_badges";
+DROP TABLE IF EXISTS "badges";
+DROP TABLE IF EXISTS "song_likes";
+DROP TABLE IF EXISTS "songs";
+DROP TABLE IF EXISTS "sessions";
+DROP TABLE IF EXISTS "users";
@@ -0,0 +1,233 @@
+-- Baseline: the schema as created by GORM AutoMigrate before versioned
+-- migrations. IF NOT EXISTS lets databases created that way adopt it.
+
+CREATE EXTENSION IF NOT EXISTS "citext";
+
+CREATE TABLE IF NOT EXISTS "users" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "email" citext NOT NULL,
+    "password_hash" text NOT NULL,
+    "display_name" text NOT NULL,
+    "role" text NOT NULL DEFAULT 'user',
+    "email_verified_at" timestamptz,
+    "anonymized_at" timestamptz,
+    "totp_secret" text NOT NULL DEFAULT '',
+    "totp_enabled_at" timestamptz,
+    "totp_last_counter" bigint NOT NULL DEFAULT 0,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "uni_users_email" UNIQUE ("email"),
+    CONSTRAINT "uni_users_display_name" UNIQUE ("display_name")
+);
+
+CREATE TABLE IF NOT EXISTS "sessions" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "user_id" uuid NOT NULL,
+    "token_hash" text,
+    "csrf_token" text NOT NULL DEFAULT '',
+    "ip" text,
+    "user_agent" text,
+    "last_seen_at" timestamptz,
+    "created_at" timestamptz,
+    "expires_at" timestamptz NOT NULL,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_sessions_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_sessions_expires_at" ON "sessions" ("expires_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_sessions_token_hash" ON "sessions" ("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_sessions_user_id" ON "sessions" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "songs" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "title" text NOT NULL,
+    "artist" text NOT NULL,
+    "body_chord_pro" text NOT NULL,
+    "key" text,
+    "status" text NOT NULL DEFAULT 'visible',
+    "created_by_id" uuid NOT NULL,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    "deleted_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_songs_created_by" FOREIGN KEY ("created_by_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_songs_deleted_at" ON "songs" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_songs_status" ON "songs" ("status");
+CREATE INDEX IF NOT EXISTS "idx_songs_artist" ON "songs" ("artist");
+CREATE INDEX IF NOT EXISTS "idx_songs_title" ON "songs" ("title");
+
+CREATE TABLE IF NOT EXISTS "song_likes" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "song_id" uuid NOT NULL,
+    "user_id" uuid NOT NULL,
+    "value" smallint NOT NULL,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_song_user" ON "song_likes" ("song_id", "user_id");
+
+CREATE TABLE IF NOT EXISTS "badges" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "code" text NOT NULL,
+    "name" text NOT NULL,
+    "description" text NOT NULL,
+    "threshold" bigint NOT NULL DEFAULT 0,
+    "revocable" boolean NOT NULL DEFAULT false,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "uni_badges_code" UNIQUE ("code")
+);
+
+CREATE TABLE IF NOT EXISTS "user_badges" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "user_id" uuid NOT NULL,
+    "badge_id" uuid NOT NULL,
+    "awarded_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_user_badges_user_id" ON "user_badges" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "badge_events" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "user_id" uuid NOT NULL,
+    "badge_id" uuid NOT NULL,
+    "action" text NOT NULL,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_badge_events_user_id" ON "badge_events" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "leaderboard_entries" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "board" text NOT NULL,
+    "period" text NOT NULL,
+    "subject_id" uuid NOT NULL,
+    "score" bigint NOT NULL,
+    "rank" bigint NOT NULL,
+    "refreshed_at" timestamptz NOT NULL,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_board_period" ON "leaderboard_entries" ("board", "period");
+
+CREATE TABLE IF NOT EXISTS "comments" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "song_id" uuid NOT NULL,
+    "user_id" uuid NOT NULL,
+    "parent_id" uuid,
+    "suggestion_id" uuid,
+    "body" text NOT NULL,
+    "line_number" bigint,
+    "edited_at" timestamptz,
+    "deleted_at" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_comments_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_comments_suggestion_id" ON "comments" ("suggestion_id");
+CREATE INDEX IF NOT EXISTS "idx_comments_parent_id" ON "comments" ("parent_id");
+CREATE INDEX IF NOT EXISTS "idx_comments_song_id" ON "comments" ("song_id");
+
+CREATE TABLE IF NOT EXISTS "edit_suggestions" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "song_id" uuid NOT NULL,
+    "author_id" uuid NOT NULL,
+    "title" text NOT NULL,
+    "artist" text NOT NULL,
+    "body_chord_pro" text NOT NULL,
+    "key" text,
+    "message" text,
+    "status" text NOT NULL DEFAULT 'pending',
+    "reject_reason" text,
+    "reviewed_at" timestamptz,
+    "created_at" timestamptz,
+    "updated_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_edit_suggestions_author" FOREIGN KEY ("author_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_edit_suggestions_status" ON "edit_suggestions" ("status");
+CREATE INDEX IF NOT EXISTS "idx_edit_suggestions_author_id" ON "edit_suggestions" ("author_id");
+CREATE INDEX IF NOT EXISTS "idx_edit_suggestions_song_id" ON "edit_suggestions" ("song_id");
+
+CREATE TABLE IF NOT EXISTS "reports" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "song_id" uuid,
+    "reporter_id" uuid NOT NULL,
+    "reason" text NOT NULL,
+    "details" text,
+    "status" text NOT NULL DEFAULT 'open',
+    "action" text,
+    "moderator_note" text,
+    "resolved_by_id" uuid,
+    "resolved_at" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_reports_song" FOREIGN KEY ("song_id") REFERENCES "songs"("id") ON DELETE SET NULL,
+    CONSTRAINT "fk_reports_reporter" FOREIGN KEY ("reporter_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_reports_status" ON "reports" ("status");
+CREATE INDEX IF NOT EXISTS "idx_reports_song_id" ON "reports" ("song_id");
+
+CREATE TABLE IF NOT EXISTS "user_warnings" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "user_id" uuid NOT NULL,
+    "moderator_id" uuid NOT NULL,
+    "report_id" uuid,
+    "message" text NOT NULL,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_user_warnings_user_id" ON "user_warnings" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "user_tokens" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "user_id" uuid NOT NULL,
+    "purpose" text NOT NULL,
+    "token_hash" text NOT NULL,
+    "expires_at" timestamptz NOT NULL,
+    "used_at" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_user_tokens_token_hash" ON "user_tokens" ("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_user_tokens_user_id" ON "user_tokens" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "user_identities" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "user_id" uuid NOT NULL,
+    "issuer" text NOT NULL,
+    "subject" text NOT NULL,
+    "email" text,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_user_identities_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_identity_subject" ON "user_identities" ("issuer", "subject");
+CREATE INDEX IF NOT EXISTS "idx_user_identities_user_id" ON "user_identities" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "api_tokens" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "user_id" uuid NOT NULL,
+    "name" text NOT NULL,
+    "prefix" text NOT NULL,
+    "token_hash" text NOT NULL,
+    "scopes" text NOT NULL,
+    "expires_at" timestamptz NOT NULL,
+    "last_used_at" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_api_tokens_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_api_tokens_expires_at" ON "api_tokens" ("expires_at");
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_api_tokens_token_hash" ON "api_tokens" ("token_hash");
+CREATE INDEX IF NOT EXISTS "idx_api_tokens_user_id" ON "api_tokens" ("user_id");
+
+CREATE TABLE IF NOT EXISTS "recovery_codes" (
+    "id" uuid DEFAULT gen_random_uuid(),
+    "user_id" uuid NOT NULL,
+    "code_hash" text NOT NULL,
+    "used_at" timestamptz,
+    "created_at" timestamptz,
+    PRIMARY KEY ("id")
+);
+CREATE INDEX IF NOT EXISTS "idx_recovery_codes_user_id" ON "recovery_codes" ("user_id");
@@ -0,0 +1,31 @@
+-- Databases that an older AutoMigrate release created can adopt the
+-- baseline while missing columns added since, because CREATE TABLE IF NOT
+-- EXISTS leaves their tables alone. Add whatever is missing.
+
+ALTER TABLE "users"
+    ADD COLUMN IF NOT EXISTS "role" text NOT NULL DEFAULT 'user',
+    ADD COLUMN IF NOT EXISTS "email_verified_at" timestamptz,
+    ADD COLUMN IF NOT EXISTS "anonymized_at" timestamptz,
+    ADD COLUMN IF NOT EXISTS "totp_secret" text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS "totp_enabled_at" timestamptz,
+    ADD COLUMN IF NOT EXISTS "totp_last_counter" bigint NOT NULL DEFAULT 0;
+
+ALTER TABLE "sessions"
+    ADD COLUMN IF NOT EXISTS "token_hash" text,
+    ADD COLUMN IF NOT EXISTS "csrf_token" text NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS "ip" text,
+    ADD COLUMN IF NOT EXISTS "user_agent" text,
+    ADD COLUMN IF NOT EXISTS "last_seen_at" timestamptz;
+-- Older sessions have no token hash to look them up by
+DELETE FROM "sessions" WHERE "token_hash" IS NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS "idx_sessions_token_hash" ON "sessions" ("token_hash");
+
+ALTER TABLE "songs"
+    ADD COLUMN IF NOT EXISTS "status" text NOT NULL DEFAULT 'visible',
+    ADD COLUMN IF NOT EXISTS "deleted_at" timestamptz;
+CREATE INDEX IF NOT EXISTS "idx_songs_deleted_at" ON "songs" ("deleted_at");
+CREATE INDEX IF NOT EXISTS "idx_songs_status" ON "songs" ("status");
+
+ALTER TABLE "badges"
+    ADD COLUMN IF NOT EXISTS "threshold" bigint NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS "revocable" boolean NOT NULL DEFAULT false;
@@ -0,0 +1 @@
+ALTER TABLE "user_tokens" DROP COLUMN "email";
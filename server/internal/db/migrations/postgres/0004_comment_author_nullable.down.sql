@@ -0,0 +1,3 @@
+-- Placeholders without an author can't be kept
+DELETE FROM "comments" WHERE "user_id" IS NULL;
+ALTER TABLE "comments" ALTER COLUMN "user_id" SET NOT NULL;
@@ -0,0 +1,2 @@
+-- Comments of purged users stay as placeholders without an author
+ALTER TABLE "comments" ALTER COLUMN "user_id" DROP NOT NULL;
@@ -0,0 +1 @@
+-- The columns are part of the baseline schema, so they stay
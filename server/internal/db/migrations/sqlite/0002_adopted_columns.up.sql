@@ -0,0 +1,2 @@
+-- SQLite databases were never created by AutoMigrate, so there is nothing
+-- to add. This keeps the versions in step with Postgres.
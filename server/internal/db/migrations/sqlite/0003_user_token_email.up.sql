@@ -0,0 +1,3 @@
+-- The address an emailed token was sent to, so redeeming it only proves
+-- that address. Existing tokens prove none.
+ALTER TABLE "user_tokens" ADD COLUMN "email" text NOT NULL DEFAULT '';
@@ -0,0 +1,24 @@
+-- Comments of purged users stay as placeholders without an author.
+-- SQLite cannot drop a NOT NULL constraint, so the table is rebuilt.
+CREATE TABLE "comments_new" (
+    "id" text NOT NULL,
+    "song_id" text NOT NULL,
+    "user_id" text,
+    "parent_id" text,
+    "suggestion_id" text,
+    "body" text NOT NULL,
+    "line_number" integer,
+    "edited_at" datetime,
+    "deleted_at" datetime,
+    "created_at" datetime,
+    "updated_at" datetime,
+    PRIMARY KEY ("id"),
+    CONSTRAINT "fk_comments_user" FOREIGN KEY ("user_id") REFERENCES "users"("id")
+);
+INSERT INTO "comments_new" SELECT "id", "song_id", "user_id", "parent_id", "suggestion_id", "body",
+    "line_number", "edited_at", "deleted_at", "created_at", "updated_at" FROM "comments";
+DROP TABLE "comments";
+ALTER TABLE "comments_new" RENAME TO "comments";
+CREATE INDEX "idx_comments_suggestion_id" ON "comments" ("suggestion_id");
+CREATE INDEX "idx_comments_parent_id" ON "comments" ("parent_id");
+CREATE INDEX "idx_comments_song_id" ON "comments" ("song_id");
@@ -4,35 +4,51 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
+// User is embedded in public song, comment and suggestion responses, so
+// anything private to the account is kept out of its JSON.
 type User struct {
-	ID           uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	Email        string    `gorm:"type:citext;unique;not null"`
-	PasswordHash string    `gorm:"type:text;not null"`
-	DisplayName  string    `gorm:"type:text;unique;not null"`
-	CreatedAt    time.Time `gorm:"autoCreateTime"`
-	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+	ID              uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Email           string     `gorm:"type:citext;unique;not null" json:"-"`
+	PasswordHash    string     `gorm:"type:text;not null" json:"-"`
+	DisplayName     string     `gorm:"type:text;unique;not null"`
+	Role            string     `gorm:"type:text;not null;default:user"` // user, moderator or admin
+	EmailVerifiedAt *time.Time `json:"-"`
+	AnonymizedAt    *time.Time // set when the account was deleted but its contributions kept
+	TOTPSecret      string     `gorm:"column:totp_secret;type:text;not null;default:''" json:"-"` // base32, set during enrollment
+	TOTPEnabledAt   *time.Time `gorm:"column:totp_enabled_at" json:"-"`
+	TOTPLastCounter int64      `gorm:"column:totp_last_counter;not null;default:0" json:"-"` // last accepted time step, to reject replays
+	CreatedAt       time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt       time.Time  `gorm:"autoUpdateTime"`
 }
 
 type Session struct {
-	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	UserID    uuid.UUID `gorm:"type:uuid;not null"`
-	User      User      `gorm:"foreignKey:UserID"`
-	CreatedAt time.Time `gorm:"autoCreateTime"`
-	ExpiresAt time.Time `gorm:"not null"`
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	User       User      `gorm:"foreignKey:UserID"`
+	TokenHash  string    `gorm:"type:text;uniqueIndex"` // SHA-256 of the opaque cookie token
+	CSRFToken  string    `gorm:"type:text;not null;default:''"`
+	IP         string    `gorm:"type:text"`
+	UserAgent  string    `gorm:"type:text"`
+	LastSeenAt time.Time
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+	ExpiresAt  time.Time `gorm:"not null;index"`
 }
 
 type Song struct {
-	ID           uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
-	Title        string    `gorm:"type:text;not null;index"`
-	Artist       string    `gorm:"type:text;not null;index"`
-	BodyChordPro string    `gorm:"type:text;not null"`
-	Key          string    `gorm:"type:text"`
-	CreatedByID  uuid.UUID `gorm:"type:uuid;not null"`
-	CreatedBy    User      `gorm:"foreignKey:CreatedByID"`
-	CreatedAt    time.Time `gorm:"autoCreateTime"`
-	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+	ID           uuid.UUID      `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Title        string         `gorm:"type:text;not null;index"`
+	Artist       string         `gorm:"type:text;not null;index"`
+	BodyChordPro string         `gorm:"type:text;not null"`
+	Key          string         `gorm:"type:text"`
+	Status       string         `gorm:"type:text;not null;default:visible;index"` // visible or hidden
+	CreatedByID  uuid.UUID      `gorm:"type:uuid;not null"`
+	CreatedBy    User           `gorm:"foreignKey:CreatedByID"`
+	CreatedAt    time.Time      `gorm:"autoCreateTime"`
+	UpdatedAt    time.Time      `gorm:"autoUpdateTime"`
+	DeletedAt    gorm.DeletedAt `gorm:"index"` // set while the song is in its owner's trash
 }
 
 type SongLike struct {
@@ -48,6 +64,8 @@ type Badge struct {
 	Code        string    `gorm:"type:text;unique;not null"`
 	Name        string    `gorm:"type:text;not null"`
 	Description string    `gorm:"type:text;not null"`
+	Threshold   int64     `gorm:"not null;default:0"`
+	Revocable   bool      `gorm:"not null;default:false"`
 }
 
 type UserBadge struct {
@@ -56,3 +74,136 @@ type UserBadge struct {
 	BadgeID   uuid.UUID `gorm:"type:uuid;not null"`
 	AwardedAt time.Time `gorm:"autoCreateTime"`
 }
+
+type BadgeEvent struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	BadgeID   uuid.UUID `gorm:"type:uuid;not null"`
+	Action    string    `gorm:"type:text;not null"` // "awarded" or "revoked"
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// LeaderboardEntry is a precomputed leaderboard row, refreshed periodically
+type LeaderboardEntry struct {
+	ID          uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	Board       string    `gorm:"type:text;not null;index:idx_board_period"` // contributors, songs or rising
+	Period      string    `gorm:"type:text;not null;index:idx_board_period"` // week, month or all
+	SubjectID   uuid.UUID `gorm:"type:uuid;not null"`                        // user or song ID depending on the board
+	Score       int64     `gorm:"not null"`
+	Rank        int       `gorm:"not null"`
+	RefreshedAt time.Time `gorm:"not null"`
+}
+
+type Comment struct {
+	ID           uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	SongID       uuid.UUID  `gorm:"type:uuid;not null;index"`
+	UserID       *uuid.UUID `gorm:"type:uuid"` // nil once the author is purged
+	User         *User      `gorm:"foreignKey:UserID" json:",omitempty"`
+	ParentID     *uuid.UUID `gorm:"type:uuid;index"` // nil for top-level comments
+	SuggestionID *uuid.UUID `gorm:"type:uuid;index"` // set when discussing an edit suggestion
+	Body         string     `gorm:"type:text;not null"`
+	LineNumber   *int       // optional 1-based line of BodyChordPro the comment refers to
+	EditedAt     *time.Time
+	DeletedAt    *time.Time // soft deleted comments keep their place in the thread
+	CreatedAt    time.Time  `gorm:"autoCreateTime"`
+	UpdatedAt    time.Time  `gorm:"autoUpdateTime"`
+}
+
+// Redact blanks the body and author of a deleted comment, which stays in
+// responses only to keep replies in context
+func (c *Comment) Redact() {
+	if c.DeletedAt == nil {
+		return
+	}
+	c.Body = ""
+	c.UserID = nil
+	c.User = nil
+}
+
+type EditSuggestion struct {
+	ID           uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	SongID       uuid.UUID `gorm:"type:uuid;not null;index"`
+	AuthorID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	Author       User      `gorm:"foreignKey:AuthorID"`
+	Title        string    `gorm:"type:text;not null"`
+	Artist       string    `gorm:"type:text;not null"`
+	BodyChordPro string    `gorm:"type:text;not null"`
+	Key          string    `gorm:"type:text"`
+	Message      string    `gorm:"type:text"`
+	Status       string    `gorm:"type:text;not null;default:pending;index"` // pending, accepted or rejected
+	RejectReason string    `gorm:"type:text"`
+	ReviewedAt   *time.Time
+	CreatedAt    time.Time `gorm:"autoCreateTime"`
+	UpdatedAt    time.Time `gorm:"autoUpdateTime"`
+}
+
+type Report struct {
+	ID            uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	SongID        *uuid.UUID `gorm:"type:uuid;index"` // cleared when the song is purged
+	Song          *Song      `gorm:"foreignKey:SongID;constraint:OnDelete:SET NULL"`
+	ReporterID    uuid.UUID  `gorm:"type:uuid;not null"`
+	Reporter      User       `gorm:"foreignKey:ReporterID"`
+	Reason        string     `gorm:"type:text;not null"` // spam, copyright, abuse or other
+	Details       string     `gorm:"type:text"`
+	Status        string     `gorm:"type:text;not null;default:open;index"` // open, resolved or dismissed
+	Action        string     `gorm:"type:text"`                             // action taken by the moderator
+	ModeratorNote string     `gorm:"type:text"`
+	ResolvedByID  *uuid.UUID `gorm:"type:uuid"`
+	ResolvedAt    *time.Time
+	CreatedAt     time.Time `gorm:"autoCreateTime"`
+}
+
+type UserWarning struct {
+	ID          uuid.UUID  `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID      uuid.UUID  `gorm:"type:uuid;not null;index"`
+	ModeratorID uuid.UUID  `gorm:"type:uuid;not null"`
+	ReportID    *uuid.UUID `gorm:"type:uuid"`
+	Message     string     `gorm:"type:text;not null"`
+	CreatedAt   time.Time  `gorm:"autoCreateTime"`
+}
+
+// UserToken is a single-use token sent by email, e.g. for password resets
+type UserToken struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	Purpose   string    `gorm:"type:text;not null"` // password_reset, verify_email or two_factor_login
+	TokenHash string    `gorm:"type:text;not null;uniqueIndex"`
+	Email     string    `gorm:"type:text;not null;default:''"` // address the token was sent to, if any
+	ExpiresAt time.Time `gorm:"not null"`
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// UserIdentity links a user to an account at an OpenID Connect provider
+type UserIdentity struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	User      User      `gorm:"foreignKey:UserID"`
+	Issuer    string    `gorm:"type:text;not null;uniqueIndex:idx_identity_subject"`
+	Subject   string    `gorm:"type:text;not null;uniqueIndex:idx_identity_subject"`
+	Email     string    `gorm:"type:text"` // email reported by the provider when linked
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
+
+// APIToken is a personal access token for scripts and integrations
+type APIToken struct {
+	ID         uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID     uuid.UUID `gorm:"type:uuid;not null;index"`
+	User       User      `gorm:"foreignKey:UserID"`
+	Name       string    `gorm:"type:text;not null"`
+	Prefix     string    `gorm:"type:text;not null"`             // first characters of the token, to tell tokens apart
+	TokenHash  string    `gorm:"type:text;not null;uniqueIndex"` // SHA-256 of the token
+	Scopes     string    `gorm:"type:text;not null"`             // space-separated, e.g. "songs:read votes:write"
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	LastUsedAt *time.Time
+	CreatedAt  time.Time `gorm:"autoCreateTime"`
+}
+
+// RecoveryCode is a one-time code that stands in for a TOTP code
+type RecoveryCode struct {
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey;default:gen_random_uuid()"`
+	UserID    uuid.UUID `gorm:"type:uuid;not null;index"`
+	CodeHash  string    `gorm:"type:text;not null"` // SHA-256 of the normalized code
+	UsedAt    *time.Time
+	CreatedAt time.Time `gorm:"autoCreateTime"`
+}
@@ -0,0 +1,84 @@
+// Package health runs the dependency checks behind the readiness probe
+package health
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Statuses of a check and of the report as a whole
+const (
+	StatusOK           = "ok"
+	StatusFailing      = "failing"
+	StatusDegraded     = "degraded"
+	StatusUnavailable  = "unavailable"
+	StatusShuttingDown = "shutting_down"
+)
+
+// Check is a single dependency. A failing critical check makes the server
+// unavailable; any other failing check only degrades it.
+type Check struct {
+	Name     string
+	Critical bool
+	Run      func(ctx context.Context) error
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Status  string
+	Latency time.Duration
+	Err     error
+}
+
+// Report is the outcome of every check
+type Report struct {
+	Status string
+	Checks map[string]Result
+}
+
+// Ready reports whether the server can take traffic
+func (r Report) Ready() bool {
+	return r.Status == StatusOK || r.Status == StatusDegraded
+}
+
+// Run runs the checks concurrently, giving each at most timeout
+func Run(ctx context.Context, checks []Check, timeout time.Duration) Report {
+	report := Report{
+		Status: StatusOK,
+		Checks: make(map[string]Result, len(checks)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, check := range checks {
+		wg.Add(1)
+		go func(check Check) {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check.Run(checkCtx)
+			result := Result{Status: StatusOK, Latency: time.Since(start), Err: err}
+			if err != nil {
+				result.Status = StatusFailing
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[check.Name] = result
+			switch {
+			case err == nil:
+			case check.Critical:
+				report.Status = StatusUnavailable
+			case report.Status == StatusOK:
+				report.Status = StatusDegraded
+			}
+		}(check)
+	}
+	wg.Wait()
+
+	return report
+}
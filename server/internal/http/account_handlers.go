@@ -0,0 +1,165 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/auth"
+	"github.com/supercakecrumb/chordik/internal/sessions"
+)
+
+type AccountHandlers struct {
+	authService    *auth.AuthService
+	sessionService *sessions.SessionService
+}
+
+func NewAccountHandlers(authService *auth.AuthService, sessionService *sessions.SessionService) *AccountHandlers {
+	return &AccountHandlers{authService: authService, sessionService: sessionService}
+}
+
+type changePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword" binding:"required"`
+	NewPassword     string `json:"newPassword" binding:"required"`
+}
+
+type changeEmailRequest struct {
+	Password string `json:"password" binding:"required"`
+	Email    string `json:"email" binding:"required,email"`
+}
+
+type deleteAccountRequest struct {
+	Password      string `json:"password" binding:"required"`
+	Contributions string `json:"contributions" binding:"required,oneof=anonymize delete"`
+}
+
+func (h *AccountHandlers) ChangePassword(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+	sessionID, _ := c.Get("sessionID")
+	currentSessionID, _ := sessionID.(uuid.UUID)
+
+	var req changePasswordRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.authService.ChangePassword(c.Request.Context(), userID, currentSessionID, req.CurrentPassword, req.NewPassword); err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AccountHandlers) ChangeEmail(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req changeEmailRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.authService.ChangeEmail(c.Request.Context(), userID, req.Password, req.Email); err != nil {
+		// The email was changed; only the verification email was throttled
+		if errors.Is(err, auth.ErrTooManyRequests) {
+			c.Status(http.StatusNoContent)
+			return
+		}
+		abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AccountHandlers) DeleteAccount(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req deleteAccountRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.authService.DeleteAccount(c.Request.Context(), userID, req.Password, req.Contributions); err != nil {
+		abort(c, err)
+		return
+	}
+
+	http.SetCookie(c.Writer, h.sessionService.Config().ExpiredCookie())
+	c.Status(http.StatusNoContent)
+}
+
+type twoFactorCodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+type passwordConfirmationRequest struct {
+	Password string `json:"password" binding:"required"`
+}
+
+// BeginTwoFactorSetup returns a new TOTP secret and the otpauth URI to show
+// as a QR code
+func (h *AccountHandlers) BeginTwoFactorSetup(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	enrollment, err := h.authService.BeginTwoFactorEnrollment(c.Request.Context(), userID)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"secret": enrollment.Secret, "otpauthUri": enrollment.URI})
+}
+
+// ConfirmTwoFactorSetup enables two-factor authentication and returns the
+// recovery codes, which are only shown this once
+func (h *AccountHandlers) ConfirmTwoFactorSetup(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req twoFactorCodeRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	codes, err := h.authService.ConfirmTwoFactor(c.Request.Context(), userID, req.Code)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+func (h *AccountHandlers) RegenerateRecoveryCodes(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req passwordConfirmationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	codes, err := h.authService.RegenerateRecoveryCodes(c.Request.Context(), userID, req.Password)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recoveryCodes": codes})
+}
+
+func (h *AccountHandlers) DisableTwoFactor(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req passwordConfirmationRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.authService.DisableTwoFactor(c.Request.Context(), userID, req.Password); err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,107 @@
+package http
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/apitokens"
+	"github.com/supercakecrumb/chordik/internal/db"
+)
+
+type APITokenHandlers struct {
+	tokenService *apitokens.APITokenService
+}
+
+func NewAPITokenHandlers(tokenService *apitokens.APITokenService) *APITokenHandlers {
+	return &APITokenHandlers{tokenService: tokenService}
+}
+
+type createAPITokenRequest struct {
+	Name   string   `json:"name" binding:"required,max=100"`
+	Scopes []string `json:"scopes" binding:"required,min=1"`
+	// ExpiresInDays defaults to 90
+	ExpiresInDays int `json:"expiresInDays" binding:"omitempty,min=1,max=365"`
+}
+
+type apiTokenResponse struct {
+	ID         uuid.UUID  `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	ExpiresAt  time.Time  `json:"expiresAt"`
+	LastUsedAt *time.Time `json:"lastUsedAt"`
+	CreatedAt  time.Time  `json:"createdAt"`
+}
+
+func (h *APITokenHandlers) CreateToken(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	var req createAPITokenRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	days := req.ExpiresInDays
+	if days == 0 {
+		days = 90
+	}
+
+	token, raw, err := h.tokenService.Create(c.Request.Context(), userID, req.Name, req.Scopes, time.Duration(days)*24*time.Hour)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	// The raw token is only ever shown in this response
+	c.JSON(http.StatusCreated, gin.H{
+		"token":    raw,
+		"apiToken": newAPITokenResponse(token),
+	})
+}
+
+func (h *APITokenHandlers) ListTokens(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	tokens, err := h.tokenService.List(c.Request.Context(), userID)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	response := make([]apiTokenResponse, len(tokens))
+	for i := range tokens {
+		response[i] = newAPITokenResponse(&tokens[i])
+	}
+
+	c.JSON(http.StatusOK, gin.H{"tokens": response})
+}
+
+func (h *APITokenHandlers) RevokeToken(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+	tokenID, ok := parseID(c, "token")
+	if !ok {
+		return
+	}
+
+	if err := h.tokenService.Revoke(c.Request.Context(), userID, tokenID); err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func newAPITokenResponse(token *db.APIToken) apiTokenResponse {
+	return apiTokenResponse{
+		ID:         token.ID,
+		Name:       token.Name,
+		Prefix:     token.Prefix,
+		Scopes:     strings.Fields(token.Scopes),
+		ExpiresAt:  token.ExpiresAt,
+		LastUsedAt: token.LastUsedAt,
+		CreatedAt:  token.CreatedAt,
+	}
+}
@@ -1,53 +1,62 @@
 package http
 
 import (
+	"errors"
+	"log/slog"
 	"net/http"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
 	"github.com/supercakecrumb/chordik/internal/auth"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/ratelimit"
+	"github.com/supercakecrumb/chordik/internal/sessions"
 )
 
 type AuthHandlers struct {
-	authService *auth.AuthService
+	authService    *auth.AuthService
+	sessionService *sessions.SessionService
+	lockout        *ratelimit.Lockout
+	// oidc is nil when OpenID Connect login is not configured
+	oidc   *auth.OIDCProvider
+	appURL string
 }
 
-func NewAuthHandlers(authService *auth.AuthService) *AuthHandlers {
-	return &AuthHandlers{authService: authService}
+func NewAuthHandlers(authService *auth.AuthService, sessionService *sessions.SessionService, lockout *ratelimit.Lockout, oidc *auth.OIDCProvider, appURL string) *AuthHandlers {
+	return &AuthHandlers{
+		authService:    authService,
+		sessionService: sessionService,
+		lockout:        lockout,
+		oidc:           oidc,
+		appURL:         appURL,
+	}
 }
 
 type registerRequest struct {
 	Email       string `json:"email" binding:"required,email"`
-	Password    string `json:"password" binding:"required,min=8"`
+	Password    string `json:"password" binding:"required"`
 	DisplayName string `json:"displayName" binding:"required,min=3"`
 }
 
 func (h *AuthHandlers) Register(c *gin.Context) {
 	var req registerRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	user, err := h.authService.Register(req.Email, req.Password, req.DisplayName)
+	user, err := h.authService.Register(c.Request.Context(), req.Email, req.Password, req.DisplayName)
 	if err != nil {
-		if err == auth.ErrEmailTaken {
-			c.JSON(http.StatusConflict, gin.H{"error": "Email already in use"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Registration failed"})
+		abort(c, err)
 		return
 	}
 
-	session, err := h.authService.CreateSession(user.ID)
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+	session, ok := h.startSession(c, user.ID)
+	if !ok {
 		return
 	}
 
-	setSessionCookie(c, session.ID)
-	c.JSON(http.StatusCreated, gin.H{"id": user.ID})
+	c.JSON(http.StatusCreated, gin.H{"id": user.ID, "csrfToken": session.CSRFToken})
 }
 
 type loginRequest struct {
@@ -57,75 +66,320 @@ type loginRequest struct {
 
 func (h *AuthHandlers) Login(c *gin.Context) {
 	var req loginRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	// Locked accounts are rejected before the password is checked, so
+	// guesses during a lockout reveal nothing
+	if locked, err := h.lockout.Check(req.Email); err != nil {
+		slog.ErrorContext(c.Request.Context(), "login lockout check failed", "error", err)
+	} else if locked > 0 {
+		abortTooManyRequests(c, locked)
 		return
 	}
 
-	user, err := h.authService.Login(req.Email, req.Password)
+	user, err := h.authService.Login(c.Request.Context(), req.Email, req.Password)
 	if err != nil {
-		if err == auth.ErrInvalidCredentials {
-			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		if errors.Is(err, auth.ErrInvalidCredentials) {
+			if _, err := h.lockout.Fail(req.Email); err != nil {
+				slog.ErrorContext(c.Request.Context(), "failed to record login failure", "error", err)
+			}
+		}
+		abort(c, err)
+		return
+	}
+
+	if err := h.lockout.Succeed(req.Email); err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to reset login failures", "error", err)
+	}
+
+	// With two-factor authentication the session only starts once a code
+	// is sent to /login/2fa along with the challenge
+	if user.TOTPEnabledAt != nil {
+		challenge, err := h.authService.StartTwoFactorLogin(c.Request.Context(), user.ID)
+		if err != nil {
+			abort(c, err)
 			return
 		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Login failed"})
+		c.JSON(http.StatusOK, gin.H{"twoFactorRequired": true, "challenge": challenge})
+		return
+	}
+
+	session, ok := h.startSession(c, user.ID)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"id": user.ID, "csrfToken": session.CSRFToken})
+}
+
+type twoFactorLoginRequest struct {
+	Challenge string `json:"challenge" binding:"required"`
+	Code      string `json:"code" binding:"required"`
+}
+
+// CompleteTwoFactorLogin is the second login step for users with
+// two-factor authentication. It accepts an authenticator or recovery code.
+func (h *AuthHandlers) CompleteTwoFactorLogin(c *gin.Context) {
+	var req twoFactorLoginRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	userID, err := h.authService.TwoFactorLoginUser(c.Request.Context(), req.Challenge)
+	if err != nil {
+		if errors.Is(err, auth.ErrInvalidToken) {
+			err = errLoginExpired
+		}
+		abort(c, err)
 		return
 	}
 
-	session, err := h.authService.CreateSession(user.ID)
+	// Failures count against the account, so starting a new login with
+	// the password doesn't bring more guesses
+	lockoutKey := "2fa:" + userID.String()
+	if locked, err := h.lockout.Check(lockoutKey); err != nil {
+		slog.ErrorContext(c.Request.Context(), "two-factor lockout check failed", "error", err)
+	} else if locked > 0 {
+		abortTooManyRequests(c, locked)
+		return
+	}
+
+	user, err := h.authService.CompleteTwoFactorLogin(c.Request.Context(), req.Challenge, req.Code)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create session"})
+		switch {
+		case errors.Is(err, auth.ErrInvalidCode):
+			if _, err := h.lockout.Fail(lockoutKey); err != nil {
+				slog.ErrorContext(c.Request.Context(), "failed to record two-factor failure", "error", err)
+			}
+			abort(c, auth.ErrInvalidCode.WithStatus(http.StatusUnauthorized))
+		case errors.Is(err, auth.ErrInvalidToken), errors.Is(err, auth.ErrTwoFactorNotEnabled):
+			abort(c, errLoginExpired)
+		default:
+			abort(c, err)
+		}
+		return
+	}
+
+	if err := h.lockout.Succeed(lockoutKey); err != nil {
+		slog.ErrorContext(c.Request.Context(), "failed to reset two-factor failures", "error", err)
+	}
+
+	session, ok := h.startSession(c, user.ID)
+	if !ok {
 		return
 	}
 
-	setSessionCookie(c, session.ID)
-	c.JSON(http.StatusOK, gin.H{"id": user.ID})
+	c.JSON(http.StatusOK, gin.H{"id": user.ID, "csrfToken": session.CSRFToken})
 }
 
 func (h *AuthHandlers) Logout(c *gin.Context) {
-	sessionID, err := getSessionID(c)
+	token, err := getSessionToken(c, h.sessionService.Config())
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "No active session"})
+		abort(c, errNoSession)
 		return
 	}
 
-	if err := h.authService.DeleteSession(sessionID); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to invalidate session"})
+	if err := h.sessionService.Delete(c.Request.Context(), token); err != nil {
+		abort(c, err)
+		return
+	}
+
+	http.SetCookie(c.Writer, h.sessionService.Config().ExpiredCookie())
+	c.Status(http.StatusNoContent)
+}
+
+// LogoutEverywhere ends every session of the current user, including this one
+func (h *AuthHandlers) LogoutEverywhere(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	if err := h.sessionService.RevokeAll(c.Request.Context(), userID, nil); err != nil {
+		abort(c, err)
 		return
 	}
 
-	c.SetCookie("session", "", -1, "/", "", false, true)
+	http.SetCookie(c.Writer, h.sessionService.Config().ExpiredCookie())
 	c.Status(http.StatusNoContent)
 }
 
 func (h *AuthHandlers) GetCurrentUser(c *gin.Context) {
-	sessionID, err := getSessionID(c)
+	token, err := getSessionToken(c, h.sessionService.Config())
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+		abort(c, errNotAuthenticated)
 		return
 	}
 
-	user, err := h.authService.GetUserFromSession(sessionID)
+	session, err := lookupSession(c, h.sessionService, token)
 	if err != nil {
-		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid session"})
+		abort(c, errInvalidSession.Wrap(err))
 		return
 	}
 
+	user := session.User
+	c.Header(csrfHeader, session.CSRFToken)
 	c.JSON(http.StatusOK, gin.H{
-		"id":          user.ID,
-		"email":       user.Email,
-		"displayName": user.DisplayName,
+		"id":               user.ID,
+		"email":            user.Email,
+		"displayName":      user.DisplayName,
+		"role":             user.Role,
+		"emailVerified":    user.EmailVerifiedAt != nil,
+		"twoFactorEnabled": user.TOTPEnabledAt != nil,
+		"csrfToken":        session.CSRFToken,
 	})
 }
 
-func setSessionCookie(c *gin.Context, sessionID uuid.UUID) {
-	c.SetCookie("session", sessionID.String(), int((time.Hour * 24 * 7).Seconds()), "/", "", false, true)
+type forgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+func (h *AuthHandlers) ForgotPassword(c *gin.Context) {
+	var req forgotPasswordRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.authService.RequestPasswordReset(c.Request.Context(), req.Email); err != nil {
+		abort(c, err)
+		return
+	}
+
+	// Same response whether or not the email has an account
+	c.JSON(http.StatusAccepted, gin.H{"message": "If the email has an account, a reset link has been sent"})
+}
+
+type resetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required"`
 }
 
-func getSessionID(c *gin.Context) (uuid.UUID, error) {
-	cookie, err := c.Cookie("session")
+func (h *AuthHandlers) ResetPassword(c *gin.Context) {
+	var req resetPasswordRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.authService.ResetPassword(c.Request.Context(), req.Token, req.Password); err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+type verifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+func (h *AuthHandlers) VerifyEmail(c *gin.Context) {
+	var req verifyEmailRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	if err := h.authService.VerifyEmail(c.Request.Context(), req.Token); err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *AuthHandlers) RequestEmailVerification(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	if err := h.authService.RequestEmailVerification(c.Request.Context(), userID); err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusAccepted)
+}
+
+type sessionResponse struct {
+	ID         uuid.UUID `json:"id"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"userAgent"`
+	CreatedAt  time.Time `json:"createdAt"`
+	LastSeenAt time.Time `json:"lastSeenAt"`
+	ExpiresAt  time.Time `json:"expiresAt"`
+	Current    bool      `json:"current"`
+}
+
+func (h *AuthHandlers) ListSessions(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+	currentID, _ := c.Get("sessionID")
+	current, _ := currentID.(uuid.UUID)
+
+	list, err := h.sessionService.List(c.Request.Context(), userID)
 	if err != nil {
-		return uuid.Nil, err
+		abort(c, err)
+		return
+	}
+
+	response := make([]sessionResponse, len(list))
+	for i, session := range list {
+		response[i] = sessionResponse{
+			ID:         session.ID,
+			Device:     sessions.Describe(session.UserAgent),
+			IP:         session.IP,
+			UserAgent:  session.UserAgent,
+			CreatedAt:  session.CreatedAt,
+			LastSeenAt: session.LastSeenAt,
+			ExpiresAt:  session.ExpiresAt,
+			Current:    session.ID == current,
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"sessions": response})
+}
+
+func (h *AuthHandlers) RevokeSession(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+	sessionID, ok := parseID(c, "session")
+	if !ok {
+		return
+	}
+
+	if err := h.sessionService.Revoke(c.Request.Context(), userID, sessionID); err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// startSession creates a session for the user and sets the session cookie.
+// It aborts the request and returns false on failure.
+func (h *AuthHandlers) startSession(c *gin.Context, userID uuid.UUID) (*db.Session, bool) {
+	session, token, err := h.sessionService.Create(c.Request.Context(), userID, sessions.Metadata{
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	})
+	if err != nil {
+		abort(c, err)
+		return nil, false
+	}
+
+	http.SetCookie(c.Writer, h.sessionService.Config().Cookie(token, session.ExpiresAt))
+	c.Header(csrfHeader, session.CSRFToken)
+	return session, true
+}
+
+func getSessionToken(c *gin.Context, config sessions.Config) (string, error) {
+	return c.Cookie(config.CookieName)
+}
+
+// lookupSession finds the session for a cookie token. When its expiry
+// slid forward, the cookie is set again so it doesn't expire first.
+func lookupSession(c *gin.Context, sessionService *sessions.SessionService, token string) (*db.Session, error) {
+	session, extended, err := sessionService.Lookup(c.Request.Context(), token)
+	if err != nil {
+		return nil, err
+	}
+	if extended {
+		http.SetCookie(c.Writer, sessionService.Config().Cookie(token, session.ExpiresAt))
 	}
-	return uuid.Parse(cookie)
+	return session, nil
 }
@@ -0,0 +1,41 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/badges"
+)
+
+type BadgeHandlers struct {
+	badgeService *badges.BadgeService
+}
+
+func NewBadgeHandlers(badgeService *badges.BadgeService) *BadgeHandlers {
+	return &BadgeHandlers{badgeService: badgeService}
+}
+
+func (h *BadgeHandlers) GetProgress(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	progress, err := h.badgeService.GetProgress(c.Request.Context(), userID)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"badges": progress})
+}
+
+func (h *BadgeHandlers) GetHistory(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	history, err := h.badgeService.GetHistory(c.Request.Context(), userID)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"history": history})
+}
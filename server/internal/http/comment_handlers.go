@@ -0,0 +1,98 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/comments"
+)
+
+type CommentHandlers struct {
+	commentService *comments.CommentService
+}
+
+func NewCommentHandlers(commentService *comments.CommentService) *CommentHandlers {
+	return &CommentHandlers{commentService: commentService}
+}
+
+type createCommentRequest struct {
+	Body       string     `json:"body" binding:"required,max=5000"`
+	ParentID   *uuid.UUID `json:"parentId"`
+	LineNumber *int       `json:"lineNumber"`
+}
+
+type updateCommentRequest struct {
+	Body string `json:"body" binding:"required,max=5000"`
+}
+
+func (h *CommentHandlers) ListComments(c *gin.Context) {
+	songID, ok := parseID(c, "song")
+	if !ok {
+		return
+	}
+
+	threads, err := h.commentService.ListComments(c.Request.Context(), viewerFromContext(c), songID)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"comments": threads})
+}
+
+func (h *CommentHandlers) CreateComment(c *gin.Context) {
+	songID, ok := parseID(c, "song")
+	if !ok {
+		return
+	}
+
+	var req createCommentRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	comment, err := h.commentService.CreateComment(c.Request.Context(), viewerFromContext(c), songID, req.ParentID, req.Body, req.LineNumber)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
+
+func (h *CommentHandlers) UpdateComment(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+	commentID, ok := parseID(c, "comment")
+	if !ok {
+		return
+	}
+
+	var req updateCommentRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	comment, err := h.commentService.UpdateComment(c.Request.Context(), userID, commentID, req.Body)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, comment)
+}
+
+func (h *CommentHandlers) DeleteComment(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+	commentID, ok := parseID(c, "comment")
+	if !ok {
+		return
+	}
+
+	if err := h.commentService.DeleteComment(c.Request.Context(), userID, commentID); err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,127 @@
+package http
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/supercakecrumb/chordik/internal/sessions"
+)
+
+// csrfHeader carries the synchronizer token on mutating requests
+const csrfHeader = "X-CSRF-Token"
+
+// csrfTokenSource looks up the CSRF token bound to a session token
+type csrfTokenSource interface {
+	CSRFToken(ctx context.Context, sessionToken string) (string, error)
+}
+
+// originPolicy decides which cross-origin callers are trusted
+type originPolicy struct {
+	allowed map[string]bool
+}
+
+func newOriginPolicy(origins []string) originPolicy {
+	allowed := make(map[string]bool, len(origins))
+	for _, origin := range origins {
+		allowed[strings.TrimSuffix(strings.ToLower(origin), "/")] = true
+	}
+	return originPolicy{allowed: allowed}
+}
+
+// trusted reports whether a request comes from the API's own origin or
+// from an allow-listed one. Requests without Origin or Referer are not
+// sent by browsers for cross-site form posts, so they are trusted here and
+// left to the token check.
+func (p originPolicy) trusted(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		referer := r.Header.Get("Referer")
+		if referer == "" {
+			return true
+		}
+		u, err := url.Parse(referer)
+		if err != nil {
+			return false
+		}
+		origin = u.Scheme + "://" + u.Host
+	}
+
+	if origin == "null" {
+		return false
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || u.Host == "" {
+		return false
+	}
+
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+
+	return p.allowed[strings.ToLower(u.Scheme+"://"+u.Host)]
+}
+
+func isSafeMethod(method string) bool {
+	return method == http.MethodGet || method == http.MethodHead || method == http.MethodOptions
+}
+
+// csrfMiddleware protects mutating requests with two checks: the Origin
+// (or Referer) must be trusted, and requests carrying a session cookie
+// must echo that session's CSRF token in the X-CSRF-Token header.
+// Requests authenticated with an API token are exempt: browsers never
+// attach the Authorization header on their own, and authMiddleware ignores
+// the session cookie when one is present. A cookie whose session is gone
+// fails the check too, and is cleared.
+func csrfMiddleware(tokens csrfTokenSource, config sessions.Config, origins originPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		// Allow GET, HEAD, and OPTIONS requests (OPTIONS is for CORS preflight)
+		if isSafeMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+
+		if bearerToken(c) != "" {
+			c.Next()
+			return
+		}
+
+		if !origins.trusted(c.Request) {
+			abort(c, errUntrustedOrigin)
+			return
+		}
+
+		// Without a session cookie the request carries no ambient authority
+		sessionToken, err := c.Cookie(config.CookieName)
+		if err != nil {
+			c.Next()
+			return
+		}
+
+		expected, err := tokens.CSRFToken(c.Request.Context(), sessionToken)
+		if errors.Is(err, sessions.ErrSessionNotFound) {
+			// The cookie outlived its session. Clearing it lets the client
+			// retry as a visitor without a session, e.g. to log in again.
+			http.SetCookie(c.Writer, config.ExpiredCookie())
+			abort(c, errInvalidCSRFToken)
+			return
+		}
+		if err != nil {
+			abort(c, err)
+			return
+		}
+
+		provided := c.GetHeader(csrfHeader)
+		if expected == "" || subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) != 1 {
+			abort(c, errInvalidCSRFToken)
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,167 @@
+package http
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/supercakecrumb/chordik/internal/sessions"
+)
+
+type fakeTokenSource map[string]string
+
+func (f fakeTokenSource) CSRFToken(ctx context.Context, sessionToken string) (string, error) {
+	if sessionToken == "broken-session-token" {
+		return "", errors.New("database is down")
+	}
+	token, ok := f[sessionToken]
+	if !ok {
+		return "", sessions.ErrSessionNotFound
+	}
+	return token, nil
+}
+
+func newCSRFRouter(tokens csrfTokenSource, origins ...string) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(csrfMiddleware(tokens, sessions.DefaultConfig(), newOriginPolicy(origins)))
+	handler := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/api/songs", handler)
+	router.POST("/api/songs", handler)
+	router.POST("/api/auth/login", handler)
+	return router
+}
+
+func TestCSRFMiddleware(t *testing.T) {
+	tokens := fakeTokenSource{
+		"session-token":       "good-token",
+		"stale-session-token": "",
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		session string
+		token   string
+		origin  string
+		referer string
+		bearer  string
+		want    int
+	}{
+		{name: "safe method needs no token", method: http.MethodGet, path: "/api/songs", session: "session-token", origin: "https://evil.example", want: http.StatusOK},
+		{name: "same origin with valid token", method: http.MethodPost, path: "/api/songs", session: "session-token", token: "good-token", origin: "http://chordik.test", want: http.StatusOK},
+		{name: "no origin with valid token", method: http.MethodPost, path: "/api/songs", session: "session-token", token: "good-token", want: http.StatusOK},
+		{name: "allow-listed origin with valid token", method: http.MethodPost, path: "/api/songs", session: "session-token", token: "good-token", origin: "https://app.example", want: http.StatusOK},
+		{name: "missing token", method: http.MethodPost, path: "/api/songs", session: "session-token", origin: "http://chordik.test", want: http.StatusForbidden},
+		{name: "wrong token", method: http.MethodPost, path: "/api/songs", session: "session-token", token: "forged", origin: "http://chordik.test", want: http.StatusForbidden},
+		{name: "session without token", method: http.MethodPost, path: "/api/songs", session: "stale-session-token", origin: "http://chordik.test", want: http.StatusForbidden},
+		{name: "cross-origin forgery with cookie", method: http.MethodPost, path: "/api/songs", session: "session-token", origin: "https://evil.example", want: http.StatusForbidden},
+		{name: "cross-origin forgery with leaked token", method: http.MethodPost, path: "/api/songs", session: "session-token", token: "good-token", origin: "https://evil.example", want: http.StatusForbidden},
+		{name: "cross-origin forgery via referer", method: http.MethodPost, path: "/api/songs", session: "session-token", referer: "https://evil.example/page", want: http.StatusForbidden},
+		{name: "opaque origin", method: http.MethodPost, path: "/api/songs", session: "session-token", token: "good-token", origin: "null", want: http.StatusForbidden},
+		{name: "login CSRF from foreign origin", method: http.MethodPost, path: "/api/auth/login", origin: "https://evil.example", want: http.StatusForbidden},
+		{name: "login from same origin", method: http.MethodPost, path: "/api/auth/login", origin: "http://chordik.test", want: http.StatusOK},
+		{name: "login with an expired session cookie", method: http.MethodPost, path: "/api/auth/login", session: "expired-session-token", origin: "http://chordik.test", want: http.StatusForbidden},
+		{name: "session lookup fails", method: http.MethodPost, path: "/api/songs", session: "broken-session-token", token: "good-token", want: http.StatusInternalServerError},
+		{name: "api token needs no CSRF token", method: http.MethodPost, path: "/api/songs", bearer: "chk_token", want: http.StatusOK},
+		{name: "api token ignores session cookie", method: http.MethodPost, path: "/api/songs", session: "session-token", bearer: "chk_token", origin: "https://evil.example", want: http.StatusOK},
+		{name: "empty bearer is not exempt", method: http.MethodPost, path: "/api/songs", session: "session-token", bearer: " ", want: http.StatusForbidden},
+	}
+
+	router := newCSRFRouter(tokens, "https://app.example")
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			req.Host = "chordik.test"
+			if tt.session != "" {
+				req.AddCookie(&http.Cookie{Name: "session", Value: tt.session})
+			}
+			if tt.token != "" {
+				req.Header.Set(csrfHeader, tt.token)
+			}
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.referer != "" {
+				req.Header.Set("Referer", tt.referer)
+			}
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+
+			rec := httptest.NewRecorder()
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("got status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+// TestCSRFClearsExpiredSessionCookie checks that a cookie left over from
+// an expired session is cleared, so the client can log in again
+func TestCSRFClearsExpiredSessionCookie(t *testing.T) {
+	router := newCSRFRouter(fakeTokenSource{})
+
+	req := httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+	req.AddCookie(&http.Cookie{Name: "session", Value: "expired-session-token"})
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "session" || cookies[0].MaxAge >= 0 {
+		t.Fatalf("cookies = %v, want the session cookie cleared", cookies)
+	}
+
+	// Without the cookie the retry goes through
+	req = httptest.NewRequest(http.MethodPost, "/api/auth/login", nil)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("retry got status %d, want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestCORSAllowList(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(nil, Config{
+		AllowedOrigins: []string{"https://app.example"},
+		Sessions:       sessions.DefaultConfig(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		origin    string
+		wantAllow string
+	}{
+		{origin: "https://app.example", wantAllow: "https://app.example"},
+		{origin: "https://evil.example", wantAllow: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.origin, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodOptions, "/api/songs", nil)
+			req.Header.Set("Origin", tt.origin)
+			req.Header.Set("Access-Control-Request-Method", http.MethodPost)
+			req.Header.Set("Access-Control-Request-Headers", csrfHeader)
+
+			rec := httptest.NewRecorder()
+			server.router.ServeHTTP(rec, req)
+
+			if got := rec.Header().Get("Access-Control-Allow-Origin"); got != tt.wantAllow {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantAllow)
+			}
+		})
+	}
+}
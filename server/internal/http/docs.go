@@ -0,0 +1,43 @@
+package http
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/gin-gonic/gin"
+	"github.com/supercakecrumb/chordik/api"
+)
+
+// openAPISpec is the OpenAPI document as JSON, converted once on first use
+var openAPISpec = sync.OnceValues(api.JSON)
+
+// docsPage renders /api/openapi.json with Redoc
+const docsPage = `<!DOCTYPE html>
+<html>
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <title>Chordik API</title>
+</head>
+<body>
+  <redoc spec-url="/api/openapi.json"></redoc>
+  <script src="https://cdn.jsdelivr.net/npm/redoc@2/bundles/redoc.standalone.js"></script>
+</body>
+</html>
+`
+
+// handleOpenAPISpec serves the OpenAPI document describing every route
+func handleOpenAPISpec(c *gin.Context) {
+	spec, err := openAPISpec()
+	if err != nil {
+		abort(c, err)
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", spec)
+}
+
+// handleAPIDocs serves a human readable reference generated from the
+// OpenAPI document
+func handleAPIDocs(c *gin.Context) {
+	c.Data(http.StatusOK, "text/html; charset=utf-8", []byte(docsPage))
+}
@@ -0,0 +1,147 @@
+package http
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/apperr"
+	"github.com/supercakecrumb/chordik/internal/logging"
+	"github.com/supercakecrumb/chordik/internal/tracing"
+)
+
+// problemContentType is the media type of error responses
+const problemContentType = "application/problem+json"
+
+// Errors raised by the HTTP layer itself rather than a service
+var (
+	errInvalidBody       = apperr.Invalid("invalid_body", "Invalid request body")
+	errInvalidID         = apperr.Invalid("invalid_id", "Invalid ID")
+	errBodyTooLarge      = apperr.New(http.StatusRequestEntityTooLarge, "body_too_large", "Request body too large")
+	errNotAuthenticated  = apperr.Unauthorized("not_authenticated", "Not authenticated")
+	errInvalidSession    = apperr.Unauthorized("invalid_session", "Invalid session")
+	errNoSession         = apperr.Invalid("no_session", "No active session")
+	errModeratorRequired = apperr.Forbidden("moderator_required", "Moderator access required")
+	errTokensDisabled    = apperr.Unauthorized("api_tokens_disabled", "API tokens are disabled")
+	errInvalidAPIToken   = apperr.Unauthorized("invalid_api_token", "Invalid API token")
+	errTokenRoute        = apperr.Forbidden("api_token_route", "API tokens cannot access this route")
+	errTokenScope        = apperr.Forbidden("api_token_scope", "API token is missing a scope")
+	errUntrustedOrigin   = apperr.Forbidden("csrf_untrusted_origin", "CSRF protection: untrusted origin")
+	errInvalidCSRFToken  = apperr.Forbidden("csrf_invalid_token", "CSRF protection: invalid token")
+	errRateLimited       = apperr.TooManyRequests("rate_limited", "Too many requests, try again later")
+	errOIDCDisabled      = apperr.NotFound("oidc_disabled", "OpenID Connect login is not enabled")
+	errLoginExpired      = apperr.Unauthorized("login_expired", "Login expired, sign in again")
+	errRouteNotFound     = apperr.NotFound("route_not_found", "Route not found")
+)
+
+// Problem is the body of every error response, in the problem details
+// format of RFC 9457 (formerly RFC 7807). Code is stable and meant for
+// programs; Detail is meant for people and may change.
+type Problem struct {
+	// Type is always about:blank, so Title is the HTTP status text
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail"`
+	Instance string `json:"instance,omitempty"`
+	// Code identifies the error, e.g. "song_not_found"
+	Code string `json:"code"`
+	// Details holds extra data some errors carry, such as invalid fields
+	Details   map[string]any `json:"details,omitempty"`
+	RequestID string         `json:"requestId,omitempty"`
+	TraceID   string         `json:"traceId,omitempty"`
+}
+
+// handleErrors answers requests that failed with the last error a handler
+// recorded. Domain errors keep their status and message; anything else is
+// a 500 whose details only reach the logs.
+func handleErrors() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+
+		if len(c.Errors) == 0 || c.Writer.Written() {
+			return
+		}
+		writeProblem(c, c.Errors.Last().Err)
+	}
+}
+
+// abort stops a request with an error for handleErrors to answer. The
+// status is set here as well, so it holds where handleErrors is not used.
+func abort(c *gin.Context, err error) {
+	c.Error(err)
+	c.Status(apperr.From(err).Status)
+	c.Abort()
+}
+
+// writeProblem writes err as a problem details response
+func writeProblem(c *gin.Context, err error) {
+	e := apperr.From(err)
+	ctx := c.Request.Context()
+
+	c.Header("Content-Type", problemContentType)
+	c.JSON(e.Status, Problem{
+		Type:      "about:blank",
+		Title:     http.StatusText(e.Status),
+		Status:    e.Status,
+		Detail:    e.Message,
+		Instance:  c.Request.URL.Path,
+		Code:      e.Code,
+		Details:   e.Details,
+		RequestID: logging.RequestID(ctx),
+		TraceID:   tracing.TraceID(ctx),
+	})
+}
+
+// bindJSON parses the request body into req. When the body is malformed
+// or fails validation it aborts the request and returns false.
+func bindJSON(c *gin.Context, req any) bool {
+	if err := c.ShouldBindJSON(req); err != nil {
+		abort(c, invalidBody(err))
+		return false
+	}
+	return true
+}
+
+// invalidBody explains why a request body was rejected. Validation
+// failures list each field with the rule it broke.
+func invalidBody(err error) *apperr.Error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return errBodyTooLarge.Wrap(err)
+	}
+
+	var invalid validator.ValidationErrors
+	if errors.As(err, &invalid) {
+		fields := make(map[string]any, len(invalid))
+		for _, field := range invalid {
+			fields[jsonName(field.Field())] = field.Tag()
+		}
+		return errInvalidBody.WithDetails(map[string]any{"fields": fields}).Wrap(err)
+	}
+
+	return errInvalidBody.WithDetails(map[string]any{"reason": err.Error()}).Wrap(err)
+}
+
+// jsonName turns a request struct field name into its JSON name, as the
+// request structs use camelCase names throughout
+func jsonName(field string) string {
+	if field == "" {
+		return field
+	}
+	return strings.ToLower(field[:1]) + field[1:]
+}
+
+// parseID reads the id path parameter, naming what it identifies in the
+// error. It aborts the request and returns false when the ID is invalid.
+func parseID(c *gin.Context, what string) (uuid.UUID, bool) {
+	id, err := uuid.Parse(c.Param("id"))
+	if err != nil {
+		abort(c, errInvalidID.WithMessage("Invalid "+what+" ID"))
+		return uuid.Nil, false
+	}
+	return id, true
+}
@@ -0,0 +1,112 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/supercakecrumb/chordik/internal/songs"
+)
+
+func newErrorRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(handleErrors())
+	router.GET("/domain", func(c *gin.Context) {
+		abort(c, songs.ErrSongNotFound)
+	})
+	router.GET("/wrapped", func(c *gin.Context) {
+		abort(c, songs.ErrPermissionDenied.Wrap(errors.New("owner mismatch")))
+	})
+	router.GET("/internal", func(c *gin.Context) {
+		abort(c, errors.New("connection refused to db.internal:5432"))
+	})
+	router.POST("/bind", func(c *gin.Context) {
+		var req struct {
+			Title        string `json:"title" binding:"required"`
+			BodyChordPro string `json:"bodyChordPro" binding:"required"`
+		}
+		if !bindJSON(c, &req) {
+			return
+		}
+		c.Status(http.StatusNoContent)
+	})
+	return router
+}
+
+func TestErrorResponses(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		body       string
+		wantStatus int
+		wantCode   string
+		wantDetail string
+	}{
+		{name: "domain error", method: http.MethodGet, path: "/domain", wantStatus: http.StatusNotFound, wantCode: "song_not_found", wantDetail: "Song not found"},
+		{name: "wrapped domain error hides cause", method: http.MethodGet, path: "/wrapped", wantStatus: http.StatusForbidden, wantCode: "permission_denied", wantDetail: "Permission denied"},
+		{name: "unknown error is internal", method: http.MethodGet, path: "/internal", wantStatus: http.StatusInternalServerError, wantCode: "internal", wantDetail: "Internal server error"},
+		{name: "malformed body", method: http.MethodPost, path: "/bind", body: "{", wantStatus: http.StatusBadRequest, wantCode: "invalid_body", wantDetail: "Invalid request body"},
+	}
+
+	router := newErrorRouter()
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			router.ServeHTTP(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := rec.Header().Get("Content-Type"); !strings.HasPrefix(got, problemContentType) {
+				t.Errorf("got content type %q, want %q", got, problemContentType)
+			}
+
+			var problem Problem
+			if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+				t.Fatalf("invalid problem body %q: %v", rec.Body.String(), err)
+			}
+			if problem.Status != tt.wantStatus || problem.Code != tt.wantCode || problem.Detail != tt.wantDetail {
+				t.Errorf("got %+v, want status %d, code %q, detail %q", problem, tt.wantStatus, tt.wantCode, tt.wantDetail)
+			}
+			if problem.Type != "about:blank" || problem.Title != http.StatusText(tt.wantStatus) || problem.Instance != tt.path {
+				t.Errorf("got type %q, title %q, instance %q", problem.Type, problem.Title, problem.Instance)
+			}
+			if strings.Contains(rec.Body.String(), "db.internal") || strings.Contains(rec.Body.String(), "owner mismatch") {
+				t.Errorf("response leaks the cause: %s", rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestValidationErrorListsFields(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPost, "/bind", strings.NewReader(`{"title": "Wonderwall"}`))
+	newErrorRouter().ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusBadRequest)
+	}
+
+	var problem struct {
+		Code    string `json:"code"`
+		Details struct {
+			Fields map[string]string `json:"fields"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+		t.Fatal(err)
+	}
+	if problem.Code != "invalid_body" {
+		t.Errorf("got code %q, want invalid_body", problem.Code)
+	}
+	if len(problem.Details.Fields) != 1 || problem.Details.Fields["bodyChordPro"] != "required" {
+		t.Errorf("got fields %v, want bodyChordPro: required", problem.Details.Fields)
+	}
+}
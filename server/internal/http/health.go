@@ -0,0 +1,114 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/supercakecrumb/chordik/internal/auth"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/health"
+)
+
+// healthCheckTimeout bounds each readiness check, so a hung dependency
+// cannot hold up the probe
+const healthCheckTimeout = 2 * time.Second
+
+// handleLiveness reports that the process is up and serving. It checks no
+// dependencies, so an outage does not get the process restarted.
+func (s *Server) handleLiveness(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": health.StatusOK})
+}
+
+// handleReadiness reports whether the server can take traffic, with the
+// status and latency of every dependency. Error details are only shown to
+// admins, as they can leak hostnames and schema details.
+func (s *Server) handleReadiness(c *gin.Context) {
+	report := health.Run(c.Request.Context(), s.healthChecks, healthCheckTimeout)
+	if s.draining.Load() {
+		report.Status = health.StatusShuttingDown
+	}
+
+	showErrors := s.isAdmin(c)
+	checks := make(gin.H, len(report.Checks))
+	for name, result := range report.Checks {
+		check := gin.H{
+			"status":     result.Status,
+			"latency_ms": float64(result.Latency.Microseconds()) / 1000,
+		}
+		if showErrors && result.Err != nil {
+			check["error"] = result.Err.Error()
+		}
+		checks[name] = check
+	}
+
+	status := http.StatusOK
+	if !report.Ready() {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, gin.H{
+		"status": report.Status,
+		"checks": checks,
+	})
+}
+
+// isAdmin reports whether the request carries an admin session. Unlike
+// the auth middlewares it never rejects the request.
+func (s *Server) isAdmin(c *gin.Context) bool {
+	token, err := getSessionToken(c, s.sessions.Config())
+	if err != nil {
+		return false
+	}
+	session, _, err := s.sessions.Lookup(c.Request.Context(), token)
+	if err != nil {
+		return false
+	}
+	return session.User.Role == auth.RoleAdmin
+}
+
+// defaultHealthChecks are the checks every server runs: the database must
+// be reachable and its schema at the latest migration
+func (s *Server) defaultHealthChecks() []health.Check {
+	return []health.Check{
+		{
+			Name:     "database",
+			Critical: true,
+			Run: func(ctx context.Context) error {
+				sqlDB, err := s.db.DB()
+				if err != nil {
+					return err
+				}
+				return sqlDB.PingContext(ctx)
+			},
+		},
+		{
+			Name:     "migrations",
+			Critical: true,
+			Run: func(ctx context.Context) error {
+				migrator, err := db.NewMigrator(s.db.WithContext(ctx))
+				if err != nil {
+					return err
+				}
+				current, err := migrator.Current()
+				if err != nil {
+					return err
+				}
+				if latest := migrator.Latest(); current != latest {
+					return fmt.Errorf("schema is at version %d, latest is %d", current, latest)
+				}
+				return nil
+			},
+		},
+		{
+			// Search runs against the songs table rather than a separate
+			// index, so this runs a search query
+			Name: "search",
+			Run: func(ctx context.Context) error {
+				_, _, err := s.songService.ListSongs(ctx, 0, 1, "health")
+				return err
+			},
+		},
+	}
+}
@@ -0,0 +1,62 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/supercakecrumb/chordik/internal/leaderboards"
+)
+
+type LeaderboardHandlers struct {
+	leaderboardService *leaderboards.LeaderboardService
+}
+
+func NewLeaderboardHandlers(leaderboardService *leaderboards.LeaderboardService) *LeaderboardHandlers {
+	return &LeaderboardHandlers{leaderboardService: leaderboardService}
+}
+
+func leaderboardLimit(c *gin.Context) int {
+	limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if err != nil || limit <= 0 || limit > leaderboards.Size {
+		return 20
+	}
+	return limit
+}
+
+func (h *LeaderboardHandlers) GetContributors(c *gin.Context) {
+	period := c.DefaultQuery("period", leaderboards.PeriodWeek)
+
+	entries, refreshedAt, err := h.leaderboardService.GetContributors(c.Request.Context(), period, leaderboardLimit(c))
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"period":      period,
+		"refreshedAt": refreshedAt,
+		"entries":     entries,
+	})
+}
+
+func (h *LeaderboardHandlers) GetSongs(c *gin.Context) {
+	period := c.DefaultQuery("period", leaderboards.PeriodWeek)
+	board := leaderboards.BoardTopSongs
+	if c.Query("sort") == "rising" {
+		board = leaderboards.BoardRisingSongs
+	}
+
+	entries, refreshedAt, err := h.leaderboardService.GetSongs(c.Request.Context(), board, period, leaderboardLimit(c))
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"period":      period,
+		"sort":        c.DefaultQuery("sort", "top"),
+		"refreshedAt": refreshedAt,
+		"entries":     entries,
+	})
+}
@@ -0,0 +1,56 @@
+package http
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Limits bounds how long clients may take and how much they may send. Zero
+// values disable a limit.
+type Limits struct {
+	// ReadHeaderTimeout and ReadTimeout bound reading the request headers
+	// and the whole request
+	ReadHeaderTimeout time.Duration
+	ReadTimeout       time.Duration
+	// WriteTimeout bounds handling a request and writing the response
+	WriteTimeout time.Duration
+	// IdleTimeout is how long keep-alive connections wait for the next request
+	IdleTimeout    time.Duration
+	MaxHeaderBytes int
+	// MaxBodyBytes caps request bodies; larger ones are rejected with 413
+	MaxBodyBytes int64
+	// ShutdownTimeout is how long in-flight requests may finish once the
+	// server is asked to stop
+	ShutdownTimeout time.Duration
+	// ShutdownDelay is how long readiness fails before the server stops
+	// accepting connections
+	ShutdownDelay time.Duration
+}
+
+// DefaultLimits returns the limits used when nothing is configured
+func DefaultLimits() Limits {
+	return Limits{
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       15 * time.Second,
+		WriteTimeout:      30 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		MaxHeaderBytes:    1 << 20,
+		MaxBodyBytes:      1 << 20,
+		ShutdownTimeout:   20 * time.Second,
+	}
+}
+
+// limitBody rejects requests whose declared size is over the limit and
+// stops reading bodies that grow past it
+func limitBody(max int64) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.ContentLength > max {
+			abort(c, errBodyTooLarge)
+			return
+		}
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, max)
+		c.Next()
+	}
+}
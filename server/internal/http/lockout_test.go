@@ -0,0 +1,53 @@
+package http
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/supercakecrumb/chordik/internal/ratelimit"
+)
+
+// TestTwoFactorLockout checks that an account is locked after a few wrong
+// codes, even when they are spread over several login challenges, so codes
+// can't be guessed
+func TestTwoFactorLockout(t *testing.T) {
+	_, ts, _ := testServer(t, func(cfg *Config) {
+		cfg.RateLimits.Lockout = ratelimit.LockoutConfig{Threshold: 3, BaseDelay: time.Minute, MaxDelay: time.Hour, Window: time.Hour}
+	})
+	alice, phone := newAuthor(t, ts)
+
+	var login struct {
+		Challenge string `json:"challenge"`
+	}
+	phone.do("POST", "/api/auth/login", object{"email": alice.email, "password": "correct horse battery"}, 200, &login)
+
+	code := totp(t, alice.secret)
+	n, err := strconv.Atoi(code)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong := fmt.Sprintf("%06d", (n+500000)%1000000)
+
+	var problem Problem
+	for i := 0; i < 3; i++ {
+		// A fresh challenge for the last guess must not reset the count
+		if i == 2 {
+			phone.do("POST", "/api/auth/login", object{"email": alice.email, "password": "correct horse battery"}, 200, &login)
+		}
+		phone.do("POST", "/api/auth/login/2fa", object{"challenge": login.Challenge, "code": wrong}, 401, &problem)
+		if problem.Code != "invalid_code" {
+			t.Errorf("wrong code %d: got %q, want invalid_code", i+1, problem.Code)
+		}
+	}
+	phone.do("POST", "/api/auth/login/2fa", object{"challenge": login.Challenge, "code": code}, 429, nil)
+
+	phone.do("POST", "/api/auth/login", object{"email": alice.email, "password": "correct horse battery"}, 200, &login)
+	phone.do("POST", "/api/auth/login/2fa", object{"challenge": login.Challenge, "code": code}, 429, nil)
+
+	phone.do("POST", "/api/auth/login/2fa", object{"challenge": "expired", "code": code}, 401, &problem)
+	if problem.Code != "login_expired" {
+		t.Errorf("unknown challenge: got %q, want login_expired", problem.Code)
+	}
+}
@@ -0,0 +1,103 @@
+package http
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/logging"
+)
+
+// requestIDHeader carries the request ID. IDs set by a proxy in front of
+// the API are kept so logs can be followed across both.
+const requestIDHeader = "X-Request-ID"
+
+// requestID gives every request an ID, stores it in the request context
+// and echoes it in the response
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		c.Header(requestIDHeader, id)
+		c.Request = c.Request.WithContext(logging.WithRequestID(c.Request.Context(), id))
+		c.Next()
+	}
+}
+
+// validRequestID accepts short printable IDs, so a client can't inject
+// anything odd into the logs
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, r := range id {
+		if r <= ' ' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// accessLog logs every request once it is handled, with the errors
+// handlers attached to it. Server errors are logged at error level. The
+// auth middleware puts the user ID on the request context, so it shows up
+// here too.
+func accessLog() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		status := c.Writer.Status()
+		level := slog.LevelInfo
+		if status >= http.StatusInternalServerError {
+			level = slog.LevelError
+		}
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		attrs := []slog.Attr{
+			slog.String("method", c.Request.Method),
+			slog.String("route", route),
+			slog.String("path", c.Request.URL.Path),
+			slog.Int("status", status),
+			logging.Milliseconds("latency_ms", time.Since(start)),
+			slog.String("client_ip", c.ClientIP()),
+			slog.Int("bytes", c.Writer.Size()),
+		}
+		if len(c.Errors) > 0 {
+			attrs = append(attrs, slog.String("error", c.Errors.String()))
+		}
+
+		slog.LogAttrs(c.Request.Context(), level, "request", attrs...)
+	}
+}
+
+// recoverPanics turns a panicking handler into a 500 and logs the panic
+// with its stack
+func recoverPanics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		defer func() {
+			if recovered := recover(); recovered != nil {
+				err := fmt.Errorf("panic: %v", recovered)
+				c.Error(err)
+				slog.ErrorContext(c.Request.Context(), "handler panicked",
+					slog.Any("panic", recovered),
+					slog.String("stack", string(debug.Stack())))
+				// handleErrors runs inside this middleware, so the panic
+				// skipped it
+				c.Abort()
+				writeProblem(c, err)
+			}
+		}()
+		c.Next()
+	}
+}
@@ -0,0 +1,34 @@
+package http
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/supercakecrumb/chordik/internal/metrics"
+)
+
+// instrument counts requests and times them by route. Requests that match
+// no route share one label, so scanners can't blow up the label count.
+func instrument() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		metrics.HTTPRequests.WithLabelValues(c.Request.Method, route, metrics.Status(c.Writer.Status())).Inc()
+		metrics.HTTPDuration.WithLabelValues(c.Request.Method, route).Observe(time.Since(start).Seconds())
+	}
+}
+
+// ServeMetrics serves only the metrics on addr until ctx is cancelled. It
+// is meant for an admin port that is not exposed to the internet.
+func ServeMetrics(ctx context.Context, addr string, limits Limits) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", metrics.Handler())
+	return serve(ctx, newHTTPServer(addr, mux, limits), limits.ShutdownTimeout)
+}
@@ -0,0 +1,92 @@
+package http
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/moderation"
+)
+
+type ModerationHandlers struct {
+	moderationService *moderation.ModerationService
+}
+
+func NewModerationHandlers(moderationService *moderation.ModerationService) *ModerationHandlers {
+	return &ModerationHandlers{moderationService: moderationService}
+}
+
+type reportRequest struct {
+	Reason  string `json:"reason" binding:"required,oneof=spam copyright abuse other"`
+	Details string `json:"details" binding:"max=5000"`
+}
+
+type resolveReportRequest struct {
+	Action string `json:"action" binding:"required,oneof=hide delete warn dismiss"`
+	Note   string `json:"note" binding:"max=5000"`
+}
+
+type ListReportsResponse struct {
+	Reports []db.Report `json:"reports"`
+	Total   int64       `json:"total"`
+}
+
+func (h *ModerationHandlers) ReportSong(c *gin.Context) {
+	songID, ok := parseID(c, "song")
+	if !ok {
+		return
+	}
+
+	var req reportRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	report, err := h.moderationService.ReportSong(c.Request.Context(), viewerFromContext(c), songID, req.Reason, req.Details)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": report.ID})
+}
+
+func (h *ModerationHandlers) ListReports(c *gin.Context) {
+	offset, _ := strconv.Atoi(c.DefaultQuery("offset", "0"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	status := c.DefaultQuery("status", moderation.StatusOpen)
+
+	reports, total, err := h.moderationService.ListReports(c.Request.Context(), status, offset, limit)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, ListReportsResponse{
+		Reports: reports,
+		Total:   total,
+	})
+}
+
+func (h *ModerationHandlers) ResolveReport(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+	reportID, ok := parseID(c, "report")
+	if !ok {
+		return
+	}
+
+	var req resolveReportRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	report, err := h.moderationService.ResolveReport(c.Request.Context(), userID, reportID, req.Action, req.Note)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,161 @@
+package http
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/gin-gonic/gin"
+	"github.com/supercakecrumb/chordik/internal/auth"
+)
+
+// oidcCookieName holds the state, nonce and PKCE verifier of a login in
+// progress. It only lives for the round trip to the provider.
+const (
+	oidcCookieName = "oidc_login"
+	oidcCookiePath = "/api/auth/oidc"
+	oidcCookieTTL  = 600 // seconds
+)
+
+// GetOIDCProvider tells the web app whether to show an OpenID Connect
+// login button
+func (h *AuthHandlers) GetOIDCProvider(c *gin.Context) {
+	if h.oidc == nil {
+		c.JSON(http.StatusOK, gin.H{"enabled": false})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"enabled": true, "name": h.oidc.Name()})
+}
+
+// BeginOIDCLogin redirects the browser to the provider
+func (h *AuthHandlers) BeginOIDCLogin(c *gin.Context) {
+	if h.oidc == nil {
+		abort(c, errOIDCDisabled)
+		return
+	}
+
+	request, err := h.oidc.Begin()
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	value, err := json.Marshal(auth.OIDCRequest{State: request.State, Nonce: request.Nonce, Verifier: request.Verifier})
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	h.setOIDCCookie(c, base64.RawURLEncoding.EncodeToString(value), oidcCookieTTL)
+	c.Redirect(http.StatusFound, request.URL)
+}
+
+// CompleteOIDCLogin handles the provider's redirect back, starts a session
+// and sends the browser to the web app
+func (h *AuthHandlers) CompleteOIDCLogin(c *gin.Context) {
+	if h.oidc == nil {
+		abort(c, errOIDCDisabled)
+		return
+	}
+
+	request, ok := readOIDCCookie(c)
+	h.setOIDCCookie(c, "", -1)
+	if !ok || c.Query("state") == "" || c.Query("state") != request.State {
+		h.redirectToApp(c, "/login", "oidc_state")
+		return
+	}
+
+	// The provider reports denied consent and similar through the query
+	if providerError := c.Query("error"); providerError != "" {
+		h.redirectToApp(c, "/login", "oidc_denied")
+		return
+	}
+
+	identity, err := h.oidc.Exchange(c.Request.Context(), c.Query("code"), request)
+	if err != nil {
+		slog.WarnContext(c.Request.Context(), "openid connect exchange failed", "error", err)
+		h.redirectToApp(c, "/login", "oidc_failed")
+		return
+	}
+
+	user, err := h.authService.LoginWithOIDC(c.Request.Context(), identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, auth.ErrEmailNotVerified):
+			h.redirectToApp(c, "/login", "email_not_verified")
+			return
+		case errors.Is(err, auth.ErrAccountNotVerified):
+			h.redirectToApp(c, "/login", "account_not_verified")
+			return
+		case errors.Is(err, auth.ErrRegistrationClosed):
+			h.redirectToApp(c, "/login", "registration_closed")
+			return
+		}
+		slog.ErrorContext(c.Request.Context(), "openid connect login failed", "error", err)
+		h.redirectToApp(c, "/login", "oidc_failed")
+		return
+	}
+
+	// The provider stands in for the password, not for the second factor
+	if user.TOTPEnabledAt != nil {
+		challenge, err := h.authService.StartTwoFactorLogin(c.Request.Context(), user.ID)
+		if err != nil {
+			slog.ErrorContext(c.Request.Context(), "openid connect login failed", "error", err)
+			h.redirectToApp(c, "/login", "oidc_failed")
+			return
+		}
+		c.Redirect(http.StatusFound, h.appURL+"/login/2fa?challenge="+url.QueryEscape(challenge))
+		return
+	}
+
+	if _, ok := h.startSession(c, user.ID); !ok {
+		return
+	}
+
+	h.redirectToApp(c, "/", "")
+}
+
+func (h *AuthHandlers) setOIDCCookie(c *gin.Context, value string, maxAge int) {
+	config := h.sessionService.Config()
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcCookieName,
+		Value:    value,
+		Path:     oidcCookiePath,
+		Domain:   config.Domain,
+		MaxAge:   maxAge,
+		Secure:   config.Secure,
+		HttpOnly: true,
+		// Lax so the cookie comes back on the provider's top-level redirect
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+func readOIDCCookie(c *gin.Context) (auth.OIDCRequest, bool) {
+	var request auth.OIDCRequest
+
+	value, err := c.Cookie(oidcCookieName)
+	if err != nil {
+		return request, false
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return request, false
+	}
+	if err := json.Unmarshal(raw, &request); err != nil {
+		return request, false
+	}
+	return request, request.State != "" && request.Verifier != ""
+}
+
+// redirectToApp sends the browser to a page of the web app, optionally
+// with an error code for it to display
+func (h *AuthHandlers) redirectToApp(c *gin.Context, path, errorCode string) {
+	target := h.appURL + path
+	if errorCode != "" {
+		target += "?error=" + url.QueryEscape(errorCode)
+	}
+	c.Redirect(http.StatusFound, target)
+}
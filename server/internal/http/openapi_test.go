@@ -0,0 +1,566 @@
+package http
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/gin-gonic/gin"
+	"github.com/supercakecrumb/chordik/api"
+	"github.com/supercakecrumb/chordik/client"
+	"github.com/supercakecrumb/chordik/internal/auth"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/mail"
+	"github.com/supercakecrumb/chordik/internal/ratelimit"
+	"github.com/supercakecrumb/chordik/internal/sessions"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	openapi3.DefineStringFormatValidator("uuid", openapi3.NewRegexpFormatValidator(openapi3.FormatOfStringForUUIDOfRFC4122))
+	// The docs page is HTML; its content is not checked
+	openapi3filter.RegisterBodyDecoder("text/html", func(body io.Reader, _ http.Header, _ *openapi3.SchemaRef, _ openapi3filter.EncodingFn) (any, error) {
+		data, err := io.ReadAll(body)
+		return string(data), err
+	})
+}
+
+func loadSpec(t *testing.T) *openapi3.T {
+	t.Helper()
+	doc, err := openapi3.NewLoader().LoadFromData(api.YAML())
+	if err != nil {
+		t.Fatalf("failed to load the OpenAPI document: %v", err)
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		t.Fatalf("invalid OpenAPI document: %v", err)
+	}
+	return doc
+}
+
+// ginPath turns an OpenAPI path template into gin's syntax
+var pathParam = regexp.MustCompile(`\{([^}]+)\}`)
+
+func ginPath(path string) string {
+	return pathParam.ReplaceAllString(path, ":$1")
+}
+
+// TestSpecCoversRoutes checks that the OpenAPI document describes exactly
+// the routes the server registers
+func TestSpecCoversRoutes(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(nil, Config{Sessions: sessions.DefaultConfig(), APITokens: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registered := map[string]bool{}
+	for _, route := range server.router.Routes() {
+		registered[route.Method+" "+route.Path] = true
+	}
+
+	documented := map[string]bool{}
+	for path, item := range loadSpec(t).Paths.Map() {
+		for method := range item.Operations() {
+			documented[method+" "+ginPath(path)] = true
+		}
+	}
+
+	for _, route := range sortedKeys(registered) {
+		if !documented[route] {
+			t.Errorf("route %s is not in the OpenAPI document", route)
+		}
+	}
+	for _, route := range sortedKeys(documented) {
+		if !registered[route] {
+			t.Errorf("the OpenAPI document describes %s, which is not a route", route)
+		}
+	}
+}
+
+func sortedKeys(m map[string]bool) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// outbox keeps the emails the server sends, so tests can follow the links
+type outbox struct {
+	mu       sync.Mutex
+	messages []mail.Message
+}
+
+func (o *outbox) Send(msg mail.Message) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.messages = append(o.messages, msg)
+	return nil
+}
+
+var linkToken = regexp.MustCompile(`token=([^\s&]+)`)
+
+// lastToken returns the token in the last link emailed to an address
+func (o *outbox) lastToken(t *testing.T, to string) string {
+	t.Helper()
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	for i := len(o.messages) - 1; i >= 0; i-- {
+		if o.messages[i].To != to {
+			continue
+		}
+		if match := linkToken.FindStringSubmatch(o.messages[i].Body); match != nil {
+			return match[1]
+		}
+	}
+	t.Fatalf("no link was emailed to %s", to)
+	return ""
+}
+
+// contractClient is one user of the API. Every request it sends and every
+// response it gets is checked against the OpenAPI document.
+type contractClient struct {
+	t      *testing.T
+	base   string
+	router routers.Router
+	client *http.Client
+	csrf   string
+	bearer string
+}
+
+func newContractClient(t *testing.T, base string, router routers.Router) *contractClient {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &contractClient{
+		t:      t,
+		base:   base,
+		router: router,
+		client: &http.Client{
+			Jar: jar,
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}
+}
+
+// do sends a request, validates it and the response against the document
+// and decodes the response body into out when given
+func (c *contractClient) do(method, path string, body any, wantStatus int, out any) {
+	c.t.Helper()
+
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			c.t.Fatal(err)
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.base+path, reader)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.bearer != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearer)
+	} else if c.csrf != "" && !isSafeMethod(method) {
+		req.Header.Set(csrfHeader, c.csrf)
+	}
+
+	route, params, err := c.router.FindRoute(req)
+	if err != nil {
+		c.t.Fatalf("%s %s: not in the OpenAPI document: %v", method, path, err)
+	}
+	ctx := context.Background()
+	input := &openapi3filter.RequestValidationInput{
+		Request:    req,
+		PathParams: params,
+		Route:      route,
+		Options: &openapi3filter.Options{
+			AuthenticationFunc:    openapi3filter.NoopAuthenticationFunc,
+			IncludeResponseStatus: true,
+		},
+	}
+	if err := openapi3filter.ValidateRequest(ctx, input); err != nil {
+		c.t.Fatalf("%s %s: request does not match the OpenAPI document: %v", method, path, err)
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		c.t.Fatal(err)
+	}
+
+	if resp.StatusCode != wantStatus {
+		c.t.Fatalf("%s %s: got status %d, want %d: %s", method, path, resp.StatusCode, wantStatus, data)
+	}
+	if err := openapi3filter.ValidateResponse(ctx, &openapi3filter.ResponseValidationInput{
+		RequestValidationInput: input,
+		Status:                 resp.StatusCode,
+		Header:                 resp.Header,
+		Body:                   io.NopCloser(bytes.NewReader(data)),
+	}); err != nil {
+		c.t.Fatalf("%s %s: response does not match the OpenAPI document: %v\n%s", method, path, err, data)
+	}
+
+	if token := resp.Header.Get(csrfHeader); token != "" {
+		c.csrf = token
+	}
+	if out != nil {
+		if err := json.Unmarshal(data, out); err != nil {
+			c.t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+}
+
+// totp computes the current code for a base32 secret, as an
+// authenticator app would
+func totp(t *testing.T, secret string) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(time.Now().Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+type object = map[string]any
+
+// testServer runs a server on a fresh in-memory database. Emails end up in
+// the returned outbox. Rate limits are off unless an option sets them.
+func testServer(t *testing.T, options ...func(*Config)) (*Server, *httptest.Server, *outbox) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	conn, err := db.NewSQLiteConnection(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	if err := db.Migrate(conn.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	mails := &outbox{}
+	authConfig := auth.DefaultConfig()
+	authConfig.Mailer = mails
+	authConfig.Hash.BcryptCost = bcrypt.MinCost
+
+	cfg := Config{
+		Sessions:   sessions.DefaultConfig(),
+		Auth:       authConfig,
+		RateLimits: ratelimit.Config{},
+		APITokens:  true,
+	}
+	for _, option := range options {
+		option(&cfg)
+	}
+	server, err := NewServer(conn.DB, cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := server.badgeService.InitializeBadges(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	ts := httptest.NewServer(server.router)
+	t.Cleanup(ts.Close)
+	return server, ts, mails
+}
+
+// TestAPIMatchesSpec walks through every route as the web app and scripts
+// use them and checks all requests and responses against the document
+func TestAPIMatchesSpec(t *testing.T) {
+	server, ts, mails := testServer(t)
+
+	doc := loadSpec(t)
+	doc.Servers = openapi3.Servers{{URL: ts.URL}}
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anonymous := newContractClient(t, ts.URL, router)
+	alice := newContractClient(t, ts.URL, router)
+	bob := newContractClient(t, ts.URL, router)
+
+	// Probes and docs
+	anonymous.do("GET", "/livez", nil, 200, nil)
+	anonymous.do("GET", "/readyz", nil, 200, nil)
+	anonymous.do("GET", "/api/health", nil, 200, nil)
+	anonymous.do("GET", "/api/openapi.json", nil, 200, nil)
+	anonymous.do("GET", "/api/docs", nil, 200, nil)
+
+	// Accounts
+	var aliceUser struct{ ID string }
+	alice.do("POST", "/api/auth/register", object{"email": "alice@example.com", "password": "correct horse battery", "displayName": "Alice"}, 201, &aliceUser)
+	bob.do("POST", "/api/auth/register", object{"email": "bob@example.com", "password": "staple paper clip", "displayName": "Bobby"}, 201, nil)
+	alice.do("GET", "/api/auth/me", nil, 200, nil)
+	anonymous.do("GET", "/api/auth/me", nil, 401, nil)
+	anonymous.do("GET", "/api/auth/oidc", nil, 200, nil)
+	anonymous.do("GET", "/api/auth/oidc/login", nil, 404, nil)
+	anonymous.do("GET", "/api/auth/oidc/callback?state=x&code=y", nil, 404, nil)
+	anonymous.do("POST", "/api/auth/register", object{"email": "carol@example.com", "password": "short", "displayName": "Carol"}, 400, nil)
+
+	alice.do("POST", "/api/auth/email/verification", nil, 202, nil)
+	anonymous.do("POST", "/api/auth/email/verify", object{"token": mails.lastToken(t, "alice@example.com")}, 204, nil)
+	anonymous.do("POST", "/api/auth/password/forgot", object{"email": "bob@example.com"}, 202, nil)
+	anonymous.do("POST", "/api/auth/password/reset", object{"token": mails.lastToken(t, "bob@example.com"), "password": "new staple paper clip"}, 204, nil)
+	// The reset ended bob's session, so his old cookie fails the CSRF
+	// check once and is cleared
+	bob.do("POST", "/api/auth/login", object{"email": "bob@example.com", "password": "new staple paper clip"}, 403, nil)
+	bob.do("POST", "/api/auth/login", object{"email": "bob@example.com", "password": "new staple paper clip"}, 200, nil)
+
+	// Songs
+	var song struct{ ID string }
+	alice.do("POST", "/api/songs", object{"title": "Wonderwall", "artist": "Oasis", "bodyChordPro": "[Em]Today is gonna be the [G]day", "key": "Em"}, 201, &song)
+	songPath := "/api/songs/" + song.ID
+	anonymous.do("GET", "/api/songs?search=wonder&limit=5", nil, 200, nil)
+	anonymous.do("GET", songPath, nil, 200, nil)
+	alice.do("PUT", songPath, object{"title": "Wonderwall", "artist": "Oasis", "bodyChordPro": "[Em]Today is gonna be the [G]day\n[D]That they're gonna throw it back"}, 200, nil)
+	bob.do("PUT", songPath, object{"title": "Mine", "artist": "Bob", "bodyChordPro": "[C]"}, 403, nil)
+
+	// Votes
+	bob.do("POST", songPath+"/vote", object{"value": 1}, 200, nil)
+	bob.do("GET", songPath+"/vote", nil, 200, nil)
+
+	// Comments
+	anonymous.do("GET", songPath+"/comments", nil, 200, nil)
+	var comment struct{ ID string }
+	alice.do("POST", songPath+"/comments", object{"body": "Capo on 2", "lineNumber": 1}, 201, &comment)
+	bob.do("POST", songPath+"/comments", object{"body": "Thanks!", "parentId": comment.ID}, 201, nil)
+	anonymous.do("GET", songPath+"/comments", nil, 200, nil)
+	alice.do("PUT", "/api/comments/"+comment.ID, object{"body": "Capo on 2nd fret"}, 200, nil)
+	alice.do("DELETE", "/api/comments/"+comment.ID, nil, 204, nil)
+	anonymous.do("GET", songPath+"/comments", nil, 200, nil)
+
+	// Suggestions
+	var rejected, accepted struct{ ID string }
+	bob.do("POST", songPath+"/suggestions", object{"title": "Wonderwall", "artist": "Oasis", "bodyChordPro": "[Em]Today", "message": "Shorter"}, 201, &rejected)
+	bob.do("POST", songPath+"/suggestions", object{"title": "Wonderwall (live)", "artist": "Oasis", "bodyChordPro": "[Em]Today is gonna be the [G]day", "key": "G"}, 201, &accepted)
+	alice.do("GET", songPath+"/suggestions?status=pending", nil, 200, nil)
+	alice.do("GET", "/api/suggestions/"+accepted.ID, nil, 200, nil)
+	bob.do("POST", "/api/suggestions/"+accepted.ID+"/comments", object{"body": "Matches the live version"}, 201, nil)
+	alice.do("POST", "/api/suggestions/"+rejected.ID+"/reject", object{"reason": "Too short"}, 200, nil)
+	alice.do("POST", "/api/suggestions/"+accepted.ID+"/accept", nil, 200, nil)
+
+	// Badges and leaderboards
+	alice.do("GET", "/api/badges/progress", nil, 200, nil)
+	alice.do("GET", "/api/badges/history", nil, 200, nil)
+	anonymous.do("GET", "/api/leaderboards/contributors?period=month", nil, 200, nil)
+	if err := server.leaderboards.Refresh(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	anonymous.do("GET", "/api/leaderboards/contributors", nil, 200, nil)
+	anonymous.do("GET", "/api/leaderboards/songs?sort=rising&period=week", nil, 200, nil)
+
+	// Moderation
+	var report struct{ ID string }
+	bob.do("POST", songPath+"/report", object{"reason": "copyright", "details": "Full lyrics"}, 201, &report)
+	bob.do("GET", "/api/moderation/reports", nil, 403, nil)
+	if err := server.db.Model(&db.User{}).Where("id = ?", aliceUser.ID).Update("role", auth.RoleModerator).Error; err != nil {
+		t.Fatal(err)
+	}
+	alice.do("GET", "/api/moderation/reports?status=open", nil, 200, nil)
+	alice.do("POST", "/api/moderation/reports/"+report.ID+"/resolve", object{"action": "dismiss", "note": "Chords only"}, 200, nil)
+
+	// API tokens
+	var created struct {
+		Token    string `json:"token"`
+		APIToken struct {
+			ID string `json:"id"`
+		} `json:"apiToken"`
+	}
+	alice.do("POST", "/api/auth/tokens", object{"name": "backup script", "scopes": []string{"songs:read"}}, 201, &created)
+	alice.do("GET", "/api/auth/tokens", nil, 200, nil)
+	script := newContractClient(t, ts.URL, router)
+	script.bearer = created.Token
+	script.do("GET", songPath, nil, 200, nil)
+	script.do("GET", "/api/songs/trash", nil, 200, nil)
+	script.do("DELETE", songPath, nil, 403, nil)
+	alice.do("DELETE", "/api/auth/tokens/"+created.APIToken.ID, nil, 204, nil)
+	script.do("GET", songPath, nil, 401, nil)
+
+	// Trash
+	alice.do("DELETE", songPath, nil, 204, nil)
+	alice.do("GET", "/api/songs/trash", nil, 200, nil)
+	alice.do("POST", songPath+"/restore", nil, 200, nil)
+	alice.do("DELETE", songPath, nil, 204, nil)
+	alice.do("DELETE", songPath+"/purge", nil, 204, nil)
+	alice.do("GET", "/api/moderation/reports?status=dismissed", nil, 200, nil)
+
+	// Sessions
+	laptop := newContractClient(t, ts.URL, router)
+	laptop.do("POST", "/api/auth/login", object{"email": "alice@example.com", "password": "correct horse battery"}, 200, nil)
+	var list struct {
+		Sessions []struct {
+			ID      string `json:"id"`
+			Current bool   `json:"current"`
+		} `json:"sessions"`
+	}
+	alice.do("GET", "/api/auth/sessions", nil, 200, &list)
+	for _, session := range list.Sessions {
+		if !session.Current {
+			alice.do("DELETE", "/api/auth/sessions/"+session.ID, nil, 204, nil)
+		}
+	}
+	laptop.do("GET", "/api/auth/me", nil, 401, nil)
+
+	// Account settings
+	alice.do("PUT", "/api/account/password", object{"currentPassword": "correct horse battery", "newPassword": "battery staple horse"}, 204, nil)
+	alice.do("PUT", "/api/account/password", object{"currentPassword": "wrong password", "newPassword": "battery staple horse"}, 403, nil)
+	alice.do("PUT", "/api/account/email", object{"password": "battery staple horse", "email": "alice@example.org"}, 204, nil)
+
+	// Two-factor authentication
+	var enrollment struct {
+		Secret string `json:"secret"`
+	}
+	alice.do("POST", "/api/account/2fa/setup", nil, 200, &enrollment)
+	alice.do("POST", "/api/account/2fa/confirm", object{"code": totp(t, enrollment.Secret)}, 200, nil)
+	var codes struct {
+		RecoveryCodes []string `json:"recoveryCodes"`
+	}
+	alice.do("POST", "/api/account/2fa/recovery-codes", object{"password": "battery staple horse"}, 200, &codes)
+
+	phone := newContractClient(t, ts.URL, router)
+	var login struct {
+		Challenge string `json:"challenge"`
+	}
+	phone.do("POST", "/api/auth/login", object{"email": "alice@example.org", "password": "battery staple horse"}, 200, &login)
+	phone.do("POST", "/api/auth/login/2fa", object{"challenge": login.Challenge, "code": codes.RecoveryCodes[0]}, 200, nil)
+	phone.do("DELETE", "/api/account/2fa", object{"password": "battery staple horse"}, 204, nil)
+
+	// Signing out and leaving
+	phone.do("POST", "/api/auth/logout", nil, 204, nil)
+	alice.do("POST", "/api/auth/logout-all", nil, 204, nil)
+	bob.do("DELETE", "/api/account", object{"password": "new staple paper clip", "contributions": "delete"}, 204, nil)
+}
+
+// TestSpecIsServedAsJSON checks that /api/openapi.json is the document
+func TestSpecIsServedAsJSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	server, err := NewServer(nil, Config{Sessions: sessions.DefaultConfig()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	server.router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/openapi.json", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("got status %d, want %d", rec.Code, http.StatusOK)
+	}
+
+	doc, err := openapi3.NewLoader().LoadFromData(rec.Body.Bytes())
+	if err != nil {
+		t.Fatalf("served document does not load: %v", err)
+	}
+	if !strings.HasPrefix(doc.OpenAPI, "3.") || doc.Paths.Find("/api/songs/{id}") == nil {
+		t.Errorf("served document is incomplete: openapi %q", doc.OpenAPI)
+	}
+}
+
+// TestGeneratedClient uses the generated client the way a script would:
+// sign in once to create an API token, then call the API with the token
+func TestGeneratedClient(t *testing.T) {
+	_, ts, _ := testServer(t)
+	ctx := context.Background()
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var csrf string
+	browser, err := client.NewClientWithResponses(ts.URL,
+		client.WithHTTPClient(&http.Client{Jar: jar}),
+		client.WithRequestEditorFn(func(_ context.Context, req *http.Request) error {
+			req.Header.Set(csrfHeader, csrf)
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	registered, err := browser.RegisterWithResponse(ctx, client.RegisterRequest{
+		Email:       "alice@example.com",
+		Password:    "correct horse battery",
+		DisplayName: "Alice",
+	})
+	if err != nil || registered.JSON201 == nil {
+		t.Fatalf("register failed: %v %s", err, registered.Body)
+	}
+	csrf = registered.JSON201.CsrfToken
+
+	created, err := browser.CreateAPITokenWithResponse(ctx, client.CreateAPITokenRequest{
+		Name:   "import script",
+		Scopes: []client.Scope{client.ScopeSongsWrite, client.ScopeSongsRead},
+	})
+	if err != nil || created.JSON201 == nil {
+		t.Fatalf("creating a token failed: %v %s", err, created.Body)
+	}
+
+	script, err := client.NewClientWithResponses(ts.URL, client.WithBearerToken(created.JSON201.Token))
+	if err != nil {
+		t.Fatal(err)
+	}
+	song, err := script.CreateSongWithResponse(ctx, client.SongRequest{
+		Title:        "Imagine",
+		Artist:       "John Lennon",
+		BodyChordPro: "[C]Imagine [F]all the people",
+	})
+	if err != nil || song.JSON201 == nil {
+		t.Fatalf("creating a song failed: %v %s", err, song.Body)
+	}
+
+	got, err := script.GetSongWithResponse(ctx, song.JSON201.ID)
+	if err != nil || got.JSON200 == nil {
+		t.Fatalf("getting the song failed: %v %s", err, got.Body)
+	}
+	if got.JSON200.Title != "Imagine" || got.JSON200.CreatedBy == nil || got.JSON200.CreatedBy.DisplayName != "Alice" {
+		t.Errorf("got song %+v", got.JSON200)
+	}
+
+	// Votes need a scope the token does not have
+	vote, err := script.VoteWithResponse(ctx, song.JSON201.ID, client.VoteRequest{Value: client.VoteValueLike})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vote.StatusCode() != http.StatusForbidden || vote.ApplicationproblemJSONDefault == nil || vote.ApplicationproblemJSONDefault.Code != "api_token_scope" {
+		t.Errorf("got status %d and problem %+v, want api_token_scope", vote.StatusCode(), vote.ApplicationproblemJSONDefault)
+	}
+}
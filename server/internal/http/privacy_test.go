@@ -0,0 +1,106 @@
+package http
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers/legacy"
+)
+
+// privateUserFields are db.User fields that must never be served
+var privateUserFields = []string{"Email", "PasswordHash", "EmailVerifiedAt", "TOTPSecret", "TOTPEnabledAt", "TOTPLastCounter"}
+
+// author is a user with a password, an email and two-factor
+// authentication set up, whose songs anonymous visitors then look at
+type author struct {
+	*contractClient
+	email  string
+	secret string
+}
+
+func newAuthor(t *testing.T, ts *httptest.Server) (author, *contractClient) {
+	t.Helper()
+	doc := loadSpec(t)
+	doc.Servers = openapi3.Servers{{URL: ts.URL}}
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alice := author{contractClient: newContractClient(t, ts.URL, router), email: "alice@example.com"}
+	alice.do("POST", "/api/auth/register", object{"email": alice.email, "password": "correct horse battery", "displayName": "Alice"}, 201, nil)
+	var enrollment struct {
+		Secret string `json:"secret"`
+	}
+	alice.do("POST", "/api/account/2fa/setup", nil, 200, &enrollment)
+	alice.do("POST", "/api/account/2fa/confirm", object{"code": totp(t, enrollment.Secret)}, 200, nil)
+	alice.secret = enrollment.Secret
+
+	return alice, newContractClient(t, ts.URL, router)
+}
+
+// assertPublic fails when a response body carries anything private about
+// the author
+func (a author) assertPublic(t *testing.T, what string, body json.RawMessage) {
+	t.Helper()
+	for _, field := range privateUserFields {
+		if strings.Contains(string(body), `"`+field+`"`) {
+			t.Errorf("%s has the %s field: %s", what, field, body)
+		}
+	}
+	for _, secret := range []string{a.email, a.secret, "$2a$"} {
+		if strings.Contains(string(body), secret) {
+			t.Errorf("%s contains %q: %s", what, secret, body)
+		}
+	}
+}
+
+func TestSongsHideAuthorSecrets(t *testing.T) {
+	_, ts, _ := testServer(t)
+	alice, anonymous := newAuthor(t, ts)
+
+	var song struct{ ID string }
+	alice.do("POST", "/api/songs", object{"title": "Wonderwall", "artist": "Oasis", "bodyChordPro": "[Em]Today"}, 201, &song)
+
+	var body json.RawMessage
+	anonymous.do("GET", "/api/songs", nil, 200, &body)
+	alice.assertPublic(t, "the song list", body)
+	anonymous.do("GET", "/api/songs/"+song.ID, nil, 200, &body)
+	alice.assertPublic(t, "the song", body)
+}
+
+func TestCommentsHideAuthorSecrets(t *testing.T) {
+	_, ts, _ := testServer(t)
+	alice, anonymous := newAuthor(t, ts)
+
+	var song struct{ ID string }
+	alice.do("POST", "/api/songs", object{"title": "Wonderwall", "artist": "Oasis", "bodyChordPro": "[Em]Today"}, 201, &song)
+	var comment struct{ ID string }
+	alice.do("POST", "/api/songs/"+song.ID+"/comments", object{"body": "Capo on 2"}, 201, &comment)
+	alice.do("POST", "/api/songs/"+song.ID+"/comments", object{"body": "Or on 4", "parentId": comment.ID}, 201, nil)
+
+	var body json.RawMessage
+	anonymous.do("GET", "/api/songs/"+song.ID+"/comments", nil, 200, &body)
+	alice.assertPublic(t, "the comments", body)
+}
+
+func TestSuggestionsHideAuthorSecrets(t *testing.T) {
+	_, ts, _ := testServer(t)
+	alice, carol := newAuthor(t, ts)
+	carol.do("POST", "/api/auth/register", object{"email": "carol@example.com", "password": "staple paper clip", "displayName": "Carol"}, 201, nil)
+
+	var song struct{ ID string }
+	carol.do("POST", "/api/songs", object{"title": "Wonderwall", "artist": "Oasis", "bodyChordPro": "[Em]Today"}, 201, &song)
+	var suggestion struct{ ID string }
+	alice.do("POST", "/api/songs/"+song.ID+"/suggestions", object{"title": "Wonderwall", "artist": "Oasis", "bodyChordPro": "[Em]Today is gonna be the [G]day"}, 201, &suggestion)
+	alice.do("POST", "/api/suggestions/"+suggestion.ID+"/comments", object{"body": "Second line added"}, 201, nil)
+
+	var body json.RawMessage
+	carol.do("GET", "/api/songs/"+song.ID+"/suggestions", nil, 200, &body)
+	alice.assertPublic(t, "the suggestion list", body)
+	carol.do("GET", "/api/suggestions/"+suggestion.ID, nil, 200, &body)
+	alice.assertPublic(t, "the suggestion review", body)
+}
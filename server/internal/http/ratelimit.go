@@ -0,0 +1,64 @@
+package http
+
+import (
+	"log/slog"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/ratelimit"
+)
+
+// rateLimit rejects requests over the limit with 429. Authenticated
+// requests are limited per user and anonymous ones per client IP, so it
+// must run after authMiddleware to count per user.
+func (s *Server) rateLimit(name string, limit ratelimit.Limit) gin.HandlerFunc {
+	limiter := ratelimit.NewLimiter(s.limitStore, name, limit)
+	return func(c *gin.Context) {
+		result, err := limiter.Allow(rateLimitKey(c))
+		if err != nil {
+			// An unavailable store must not take the API down with it
+			slog.ErrorContext(c.Request.Context(), "rate limiter failed", "limiter", name, "error", err)
+			c.Next()
+			return
+		}
+
+		if !result.Allowed {
+			abortTooManyRequests(c, result.RetryAfter)
+			return
+		}
+		c.Next()
+	}
+}
+
+// rateLimitWrites applies a limit to mutating requests only
+func (s *Server) rateLimitWrites(name string, limit ratelimit.Limit) gin.HandlerFunc {
+	limited := s.rateLimit(name, limit)
+	return func(c *gin.Context) {
+		if isSafeMethod(c.Request.Method) {
+			c.Next()
+			return
+		}
+		limited(c)
+	}
+}
+
+func rateLimitKey(c *gin.Context) string {
+	if userID, ok := c.Get("userID"); ok {
+		return "user:" + userID.(uuid.UUID).String()
+	}
+	return "ip:" + c.ClientIP()
+}
+
+// abortTooManyRequests writes a 429 response with a Retry-After header in
+// whole seconds
+func abortTooManyRequests(c *gin.Context, retryAfter time.Duration) {
+	seconds := int(math.Ceil(retryAfter.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	abort(c, errRateLimited.WithDetails(map[string]any{"retryAfter": seconds}))
+}
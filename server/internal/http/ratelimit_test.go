@@ -0,0 +1,53 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/supercakecrumb/chordik/internal/ratelimit"
+)
+
+// TestRateLimitForwardedFor checks that clients can only pick their rate
+// limit bucket with X-Forwarded-For when a trusted proxy sets it
+func TestRateLimitForwardedFor(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		want    int
+	}{
+		{name: "no trusted proxies", want: http.StatusTooManyRequests},
+		{name: "trusted proxy", proxies: []string{"192.0.2.1"}, want: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, _, _ := testServer(t, func(cfg *Config) {
+				cfg.RateLimits.Auth = ratelimit.Limit{Requests: 1, Period: time.Hour}
+				cfg.TrustedProxies = tt.proxies
+			})
+
+			var status int
+			for _, ip := range []string{"203.0.113.1", "203.0.113.2"} {
+				req := httptest.NewRequest(http.MethodPost, "/api/auth/login", strings.NewReader("{}"))
+				req.RemoteAddr = "192.0.2.1:1234"
+				req.Header.Set("Content-Type", "application/json")
+				req.Header.Set("X-Forwarded-For", ip)
+				rec := httptest.NewRecorder()
+				server.router.ServeHTTP(rec, req)
+				status = rec.Code
+			}
+			if status != tt.want {
+				t.Errorf("second client got status %d, want %d", status, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewServerRejectsInvalidProxies(t *testing.T) {
+	if _, err := NewServer(nil, Config{TrustedProxies: []string{"proxy.internal"}}); err == nil {
+		t.Error("an invalid trusted proxy was accepted")
+	}
+}
@@ -1,141 +1,469 @@
 package http
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/apitokens"
 	"github.com/supercakecrumb/chordik/internal/auth"
+	"github.com/supercakecrumb/chordik/internal/badges"
+	"github.com/supercakecrumb/chordik/internal/comments"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/health"
+	"github.com/supercakecrumb/chordik/internal/leaderboards"
+	"github.com/supercakecrumb/chordik/internal/logging"
+	"github.com/supercakecrumb/chordik/internal/metrics"
+	"github.com/supercakecrumb/chordik/internal/moderation"
+	"github.com/supercakecrumb/chordik/internal/ratelimit"
+	"github.com/supercakecrumb/chordik/internal/sessions"
 	"github.com/supercakecrumb/chordik/internal/songs"
+	"github.com/supercakecrumb/chordik/internal/store"
+	"github.com/supercakecrumb/chordik/internal/suggestions"
 	"github.com/supercakecrumb/chordik/internal/votes"
 	"gorm.io/gorm"
 )
 
 type Server struct {
-	db          *gorm.DB
-	router      *gin.Engine
-	auth        *auth.AuthService
-	songService *songs.SongService
-	voteService *votes.VoteService
+	db           *gorm.DB
+	router       *gin.Engine
+	auth         *auth.AuthService
+	sessions     *sessions.SessionService
+	apiTokens    *apitokens.APITokenService
+	tokensOn     bool
+	songService  *songs.SongService
+	voteService  *votes.VoteService
+	badgeService *badges.BadgeService
+	leaderboards *leaderboards.LeaderboardService
+	comments     *comments.CommentService
+	suggestions  *suggestions.SuggestionService
+	moderation   *moderation.ModerationService
+	limits       ratelimit.Config
+	limitStore   ratelimit.Store
+	oidc         *auth.OIDCProvider
+	appURL       string
+	httpLimits   Limits
+	healthChecks []health.Check
+	// draining is set once shutdown starts, failing readiness
+	draining atomic.Bool
 }
 
-func NewServer(db *gorm.DB) *Server {
+// Config holds the HTTP server settings
+type Config struct {
+	// AllowedOrigins lists the origins allowed to make credentialed
+	// cross-origin requests. Same-origin requests are always allowed.
+	AllowedOrigins []string
+	// Sessions configures session lifetimes and the session cookie
+	Sessions sessions.Config
+	// Auth configures account recovery and verification emails
+	Auth auth.Config
+	// OIDC is the OpenID Connect provider users can log in with, or nil
+	OIDC *auth.OIDCProvider
+	// RateLimits sets the request limits for each route group
+	RateLimits ratelimit.Config
+	// RateLimitStore keeps rate limiter state. Defaults to an in-memory
+	// store when nil.
+	RateLimitStore ratelimit.Store
+	// TrustedProxies lists the proxies whose X-Forwarded-For headers are
+	// used to find the client IP for rate limiting. When empty, no proxy
+	// is trusted and the client IP is the address of the connection, so
+	// clients can't pick their own IP with the header.
+	TrustedProxies []string
+	// Limits sets connection timeouts and request size limits
+	Limits Limits
+	// Metrics serves the Prometheus metrics at /metrics. Leave it off when
+	// they are served on a separate port with ServeMetrics.
+	Metrics bool
+	// APITokens enables personal API tokens. When off, the token routes
+	// are not registered and Bearer credentials are rejected.
+	APITokens bool
+	// HealthChecks are run by /readyz on top of the database and migration
+	// checks, e.g. for background workers
+	HealthChecks []health.Check
+}
+
+// NewServer sets up the routes and middleware. It fails when the
+// configuration can't be applied, e.g. for invalid trusted proxies.
+func NewServer(db *gorm.DB, cfg Config) (*Server, error) {
+	st := store.New(db)
 	s := &Server{
-		db:          db,
-		router:      gin.Default(),
-		auth:        auth.NewAuthService(db),
-		songService: songs.NewSongService(db),
-		voteService: votes.NewVoteService(db),
+		db:           db,
+		router:       gin.New(),
+		auth:         auth.NewAuthService(st, cfg.Auth),
+		sessions:     sessions.NewSessionService(st, cfg.Sessions),
+		apiTokens:    apitokens.NewAPITokenService(st),
+		tokensOn:     cfg.APITokens,
+		songService:  songs.NewSongService(st),
+		voteService:  votes.NewVoteService(st),
+		badgeService: badges.NewBadgeService(st),
+		leaderboards: leaderboards.NewLeaderboardService(st),
+		comments:     comments.NewCommentService(st),
+		suggestions:  suggestions.NewSuggestionService(st),
+		moderation:   moderation.NewModerationService(st),
+		limits:       cfg.RateLimits,
+		limitStore:   cfg.RateLimitStore,
+		oidc:         cfg.OIDC,
+		appURL:       cfg.Auth.AppURL,
+		httpLimits:   cfg.Limits,
+	}
+	s.healthChecks = append(s.defaultHealthChecks(), cfg.HealthChecks...)
+	if s.limitStore == nil {
+		s.limitStore = ratelimit.NewMemoryStore()
 	}
 
-	// Add CORS middleware (allow all origins)
-	config := cors.DefaultConfig()
-	config.AllowAllOrigins = true
-	config.AllowCredentials = true
-	config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With"}
-	config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
-	s.router.Use(cors.New(config))
+	// Tag every request with an ID and a trace first, so all later logs
+	// carry them. Errors are answered inside the logging and metrics
+	// middleware, so those see the final status.
+	s.router.Use(requestID(), traceRequests(), accessLog(), instrument(), recoverPanics(), handleErrors())
+	s.router.NoRoute(func(c *gin.Context) {
+		abort(c, errRouteNotFound)
+	})
+
+	if cfg.Metrics {
+		s.router.GET("/metrics", gin.WrapH(metrics.Handler()))
+	}
+
+	if err := s.router.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		return nil, fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
+	if cfg.Limits.MaxBodyBytes > 0 {
+		s.router.Use(limitBody(cfg.Limits.MaxBodyBytes))
+	}
+
+	// Add CORS middleware for the allow-listed origins only
+	if len(cfg.AllowedOrigins) > 0 {
+		config := cors.DefaultConfig()
+		config.AllowOrigins = cfg.AllowedOrigins
+		config.AllowCredentials = true
+		config.AllowHeaders = []string{"Origin", "Content-Type", "Accept", "Authorization", "X-Requested-With", csrfHeader}
+		config.AllowMethods = []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"}
+		config.ExposeHeaders = []string{csrfHeader}
+		s.router.Use(cors.New(config))
+	}
 
 	// Add CSRF protection middleware for mutating requests
-	s.router.Use(csrfMiddleware())
+	s.router.Use(csrfMiddleware(s.sessions, cfg.Sessions, newOriginPolicy(cfg.AllowedOrigins)))
 
 	s.setupRoutes()
 
-	return s
+	return s, nil
 }
 
 func (s *Server) setupRoutes() {
-	authHandlers := NewAuthHandlers(s.auth)
+	lockout := ratelimit.NewLockout(s.limitStore, s.limits.Lockout)
+	authHandlers := NewAuthHandlers(s.auth, s.sessions, lockout, s.oidc, s.appURL)
+	accountHandlers := NewAccountHandlers(s.auth, s.sessions)
+	apiTokenHandlers := NewAPITokenHandlers(s.apiTokens)
 	songHandlers := NewSongHandlers(s.songService)
 	voteHandlers := NewVoteHandlers(s.voteService)
+	badgeHandlers := NewBadgeHandlers(s.badgeService)
+	leaderboardHandlers := NewLeaderboardHandlers(s.leaderboards)
+	commentHandlers := NewCommentHandlers(s.comments)
+	suggestionHandlers := NewSuggestionHandlers(s.suggestions)
+	moderationHandlers := NewModerationHandlers(s.moderation)
 
-	// Public routes
-	s.router.GET("/api/health", s.handleHealthCheck)
+	// Probes. /api/health is kept for existing deployments.
+	s.router.GET("/livez", s.handleLiveness)
+	s.router.GET("/readyz", s.handleReadiness)
+	s.router.GET("/api/health", s.handleReadiness)
 
-	// Auth routes
+	// The OpenAPI document and a reference page rendered from it
+	s.router.GET("/api/openapi.json", handleOpenAPISpec)
+	s.router.GET("/api/docs", handleAPIDocs)
+
+	// Auth routes, limited per IP
 	authGroup := s.router.Group("/api/auth")
+	authLimit := s.rateLimit("auth", s.limits.Auth)
 	{
-		authGroup.POST("/register", authHandlers.Register)
-		authGroup.POST("/login", authHandlers.Login)
+		authGroup.POST("/register", authLimit, authHandlers.Register)
+		authGroup.POST("/login", authLimit, authHandlers.Login)
+		authGroup.POST("/login/2fa", authLimit, authHandlers.CompleteTwoFactorLogin)
 		authGroup.POST("/logout", authHandlers.Logout)
 		authGroup.GET("/me", authHandlers.GetCurrentUser)
+		authGroup.POST("/password/forgot", authLimit, authHandlers.ForgotPassword)
+		authGroup.POST("/password/reset", authLimit, authHandlers.ResetPassword)
+		authGroup.POST("/email/verify", authLimit, authHandlers.VerifyEmail)
+		authGroup.GET("/oidc", authHandlers.GetOIDCProvider)
+		authGroup.GET("/oidc/login", authLimit, authHandlers.BeginOIDCLogin)
+		authGroup.GET("/oidc/callback", authLimit, authHandlers.CompleteOIDCLogin)
 	}
 
 	// Public routes
 	s.router.GET("/api/songs", songHandlers.ListSongs)
-	s.router.GET("/api/songs/:id", songHandlers.GetSong)
+	s.router.GET("/api/songs/:id", s.optionalAuthMiddleware(), songHandlers.GetSong)
+	s.router.GET("/api/songs/:id/comments", s.optionalAuthMiddleware(), commentHandlers.ListComments)
+	s.router.GET("/api/leaderboards/contributors", leaderboardHandlers.GetContributors)
+	s.router.GET("/api/leaderboards/songs", leaderboardHandlers.GetSongs)
 
 	// Protected API routes
 	api := s.router.Group("/api")
-	api.Use(s.authMiddleware())
+	api.Use(s.authMiddleware(), s.rateLimitWrites("write", s.limits.Write))
 	{
+		// Session management routes
+		api.GET("/auth/sessions", authHandlers.ListSessions)
+		api.DELETE("/auth/sessions/:id", authHandlers.RevokeSession)
+		api.POST("/auth/logout-all", authHandlers.LogoutEverywhere)
+		api.POST("/auth/email/verification", authHandlers.RequestEmailVerification)
+
+		// API token routes
+		if s.tokensOn {
+			api.GET("/auth/tokens", apiTokenHandlers.ListTokens)
+			api.POST("/auth/tokens", apiTokenHandlers.CreateToken)
+			api.DELETE("/auth/tokens/:id", apiTokenHandlers.RevokeToken)
+		}
+
+		// Account routes
+		api.PUT("/account/password", accountHandlers.ChangePassword)
+		api.PUT("/account/email", accountHandlers.ChangeEmail)
+		api.DELETE("/account", accountHandlers.DeleteAccount)
+		api.POST("/account/2fa/setup", accountHandlers.BeginTwoFactorSetup)
+		api.POST("/account/2fa/confirm", accountHandlers.ConfirmTwoFactorSetup)
+		api.POST("/account/2fa/recovery-codes", accountHandlers.RegenerateRecoveryCodes)
+		api.DELETE("/account/2fa", accountHandlers.DisableTwoFactor)
+
 		// Song routes
-		api.POST("/songs", songHandlers.CreateSong)
+		api.POST("/songs", s.rateLimit("songs", s.limits.Songs), songHandlers.CreateSong)
 		api.PUT("/songs/:id", songHandlers.UpdateSong)
 		api.DELETE("/songs/:id", songHandlers.DeleteSong)
 
+		// Trash routes
+		api.GET("/songs/trash", songHandlers.ListTrash)
+		api.POST("/songs/:id/restore", songHandlers.RestoreSong)
+		api.DELETE("/songs/:id/purge", songHandlers.PurgeSong)
+
 		// Vote routes
-		api.POST("/songs/:id/vote", voteHandlers.Vote)
+		api.POST("/songs/:id/vote", s.rateLimit("votes", s.limits.Votes), voteHandlers.Vote)
 		api.GET("/songs/:id/vote", voteHandlers.GetVote)
+
+		// Comment routes
+		api.POST("/songs/:id/comments", commentHandlers.CreateComment)
+		api.PUT("/comments/:id", commentHandlers.UpdateComment)
+		api.DELETE("/comments/:id", commentHandlers.DeleteComment)
+
+		// Edit suggestion routes
+		api.POST("/songs/:id/suggestions", suggestionHandlers.CreateSuggestion)
+		api.GET("/songs/:id/suggestions", suggestionHandlers.ListSuggestions)
+		api.GET("/suggestions/:id", suggestionHandlers.GetSuggestion)
+		api.POST("/suggestions/:id/accept", suggestionHandlers.AcceptSuggestion)
+		api.POST("/suggestions/:id/reject", suggestionHandlers.RejectSuggestion)
+		api.POST("/suggestions/:id/comments", suggestionHandlers.AddComment)
+
+		// Badge routes
+		api.GET("/badges/progress", badgeHandlers.GetProgress)
+		api.GET("/badges/history", badgeHandlers.GetHistory)
+
+		// Report routes
+		api.POST("/songs/:id/report", moderationHandlers.ReportSong)
+	}
+
+	// Moderator routes
+	mod := api.Group("/moderation")
+	mod.Use(requireModerator())
+	{
+		mod.GET("/reports", moderationHandlers.ListReports)
+		mod.POST("/reports/:id/resolve", moderationHandlers.ResolveReport)
 	}
 }
 
-func (s *Server) handleHealthCheck(c *gin.Context) {
-	// Check database connection
-	if err := s.db.Exec("SELECT 1").Error; err != nil {
-		c.JSON(http.StatusServiceUnavailable, gin.H{
-			"status": "db_unavailable",
-			"error":  err.Error(),
-		})
-		return
-	}
-
-	c.JSON(http.StatusOK, gin.H{
-		"status": "ok",
-		"services": gin.H{
-			"database": "connected",
-		},
-	})
+// tokenScopes lists the routes API tokens may call and the scope each one
+// needs. Routes not listed only accept session cookies.
+var tokenScopes = map[string]string{
+	"GET /api/songs/trash":        apitokens.ScopeSongsRead,
+	"GET /api/songs/:id":          apitokens.ScopeSongsRead,
+	"GET /api/songs/:id/vote":     apitokens.ScopeSongsRead,
+	"GET /api/songs/:id/comments": apitokens.ScopeSongsRead,
+	"POST /api/songs":             apitokens.ScopeSongsWrite,
+	"PUT /api/songs/:id":          apitokens.ScopeSongsWrite,
+	"DELETE /api/songs/:id":       apitokens.ScopeSongsWrite,
+	"POST /api/songs/:id/restore": apitokens.ScopeSongsWrite,
+	"DELETE /api/songs/:id/purge": apitokens.ScopeSongsWrite,
+	"POST /api/songs/:id/vote":    apitokens.ScopeVotesWrite,
+}
+
+// bearerToken returns the API token from the Authorization header, if any
+func bearerToken(c *gin.Context) string {
+	scheme, token, ok := strings.Cut(c.GetHeader("Authorization"), " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// authenticateToken checks an API token and its scope for the current
+// route. It writes an error response and returns false on failure.
+func (s *Server) authenticateToken(c *gin.Context, raw string) bool {
+	if !s.tokensOn {
+		abort(c, errTokensDisabled)
+		return false
+	}
+
+	token, err := s.apiTokens.Authenticate(c.Request.Context(), raw)
+	if err != nil {
+		abort(c, errInvalidAPIToken.Wrap(err))
+		return false
+	}
+
+	scope, ok := tokenScopes[c.Request.Method+" "+c.FullPath()]
+	if !ok {
+		abort(c, errTokenRoute)
+		return false
+	}
+	if !apitokens.HasScope(token, scope) {
+		abort(c, errTokenScope.WithMessage("API token is missing the "+scope+" scope").WithDetails(map[string]any{"scope": scope}))
+		return false
+	}
+
+	c.Set("userID", token.UserID)
+	c.Set("userRole", token.User.Role)
+	c.Set("apiTokenID", token.ID)
+	c.Request = c.Request.WithContext(logging.WithUserID(c.Request.Context(), token.UserID))
+	return true
 }
 
 func (s *Server) authMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		sessionID, err := getSessionID(c)
+		// An API token takes precedence over the session cookie
+		if raw := bearerToken(c); raw != "" {
+			if s.authenticateToken(c, raw) {
+				c.Next()
+			}
+			return
+		}
+
+		token, err := getSessionToken(c, s.sessions.Config())
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Not authenticated"})
+			abort(c, errNotAuthenticated)
 			return
 		}
 
-		user, err := s.auth.GetUserFromSession(sessionID)
+		session, err := lookupSession(c, s.sessions, token)
 		if err != nil {
-			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid session"})
+			abort(c, errInvalidSession.Wrap(err))
 			return
 		}
 
-		c.Set("userID", user.ID)
+		setSessionContext(c, session)
 		c.Next()
 	}
 }
 
-func csrfMiddleware() gin.HandlerFunc {
+// optionalAuthMiddleware identifies the user when a valid session is
+// present but lets anonymous requests through. API tokens, when sent, must
+// be valid.
+func (s *Server) optionalAuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Allow GET, HEAD, and OPTIONS requests (OPTIONS is for CORS preflight)
-		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions {
-			c.Next()
+		if raw := bearerToken(c); raw != "" {
+			if s.authenticateToken(c, raw) {
+				c.Next()
+			}
 			return
 		}
 
-		// TODO: Implement proper CSRF token validation
-		// For now just check for custom header
-		if c.GetHeader("X-Requested-With") != "XMLHttpRequest" {
-			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "CSRF protection"})
-			return
+		if token, err := getSessionToken(c, s.sessions.Config()); err == nil {
+			if session, err := lookupSession(c, s.sessions, token); err == nil {
+				setSessionContext(c, session)
+			}
 		}
+		c.Next()
+	}
+}
+
+func setSessionContext(c *gin.Context, session *db.Session) {
+	c.Set("userID", session.UserID)
+	c.Set("userRole", session.User.Role)
+	c.Set("sessionID", session.ID)
+	c.Request = c.Request.WithContext(logging.WithUserID(c.Request.Context(), session.UserID))
+}
 
+// requireModerator rejects users without moderation rights. It must run
+// after authMiddleware.
+func requireModerator() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !auth.IsModerator(c.GetString("userRole")) {
+			abort(c, errModeratorRequired)
+			return
+		}
 		c.Next()
 	}
 }
 
-func (s *Server) Run(addr string) error {
-	return s.router.Run(addr)
+// viewerFromContext describes the current user for visibility checks
+func viewerFromContext(c *gin.Context) songs.Viewer {
+	userID, _ := c.Get("userID")
+	id, _ := userID.(uuid.UUID)
+	return songs.Viewer{
+		UserID:    id,
+		Moderator: auth.IsModerator(c.GetString("userRole")),
+	}
+}
+
+// Run serves HTTP on addr until ctx is cancelled. Readiness then fails for
+// the shutdown delay, after which the server stops accepting connections
+// and lets in-flight requests finish, waiting at most the shutdown timeout.
+func (s *Server) Run(ctx context.Context, addr string) error {
+	stopCtx, stop := context.WithCancel(context.Background())
+	defer stop()
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-stopCtx.Done():
+			return
+		}
+		s.draining.Store(true)
+		time.Sleep(s.httpLimits.ShutdownDelay)
+		stop()
+	}()
+
+	return serve(stopCtx, newHTTPServer(addr, s.router, s.httpLimits), s.httpLimits.ShutdownTimeout)
+}
+
+func newHTTPServer(addr string, handler http.Handler, limits Limits) *http.Server {
+	return &http.Server{
+		Addr:              addr,
+		Handler:           handler,
+		ReadHeaderTimeout: limits.ReadHeaderTimeout,
+		ReadTimeout:       limits.ReadTimeout,
+		WriteTimeout:      limits.WriteTimeout,
+		IdleTimeout:       limits.IdleTimeout,
+		MaxHeaderBytes:    limits.MaxHeaderBytes,
+	}
+}
+
+// serve runs a server until ctx is cancelled, then shuts it down
+// gracefully
+func serve(ctx context.Context, server *http.Server, shutdownTimeout time.Duration) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errs:
+		return err
+	case <-ctx.Done():
+	}
+
+	shutdownCtx := context.Background()
+	if shutdownTimeout > 0 {
+		var cancel context.CancelFunc
+		shutdownCtx, cancel = context.WithTimeout(shutdownCtx, shutdownTimeout)
+		defer cancel()
+	}
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		// Cut off whatever is still running
+		server.Close()
+		return fmt.Errorf("graceful shutdown failed: %w", err)
+	}
+	if err := <-errs; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
 }
@@ -0,0 +1,75 @@
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/supercakecrumb/chordik/internal/db"
+)
+
+// TestSessionCookieSlides checks that the session cookie is set again,
+// with the new lifetime, whenever using the session extends it
+func TestSessionCookieSlides(t *testing.T) {
+	server, _, _ := testServer(t)
+	cfg := server.sessions.Config()
+
+	send := func(method, path, body string, cookie *http.Cookie) *http.Response {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		server.router.ServeHTTP(rec, req)
+		return rec.Result()
+	}
+	sessionCookie := func(resp *http.Response) *http.Cookie {
+		for _, cookie := range resp.Cookies() {
+			if cookie.Name == cfg.CookieName {
+				return cookie
+			}
+		}
+		return nil
+	}
+
+	resp := send("POST", "/api/auth/register", `{"email":"alice@example.com","password":"correct horse battery","displayName":"Alice"}`, nil)
+	cookie := sessionCookie(resp)
+	if cookie == nil {
+		t.Fatalf("registering set no session cookie, status %d", resp.StatusCode)
+	}
+	if want := int(cfg.IdleTTL.Seconds()); cookie.MaxAge != want {
+		t.Errorf("new cookie MaxAge = %d, want %d", cookie.MaxAge, want)
+	}
+
+	// Right after login the session is not extended yet
+	if resp := send("GET", "/api/badges/progress", "", cookie); sessionCookie(resp) != nil {
+		t.Error("the cookie was set again although the session was not extended")
+	}
+
+	// A session last used an hour ago, with an hour left
+	if err := server.db.Model(&db.Session{}).Where("1 = 1").Updates(map[string]interface{}{
+		"last_seen_at": time.Now().Add(-time.Hour),
+		"expires_at":   time.Now().Add(time.Hour),
+	}).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{"/api/badges/progress", "/api/auth/me"} {
+		if err := server.db.Model(&db.Session{}).Where("1 = 1").Update("last_seen_at", time.Now().Add(-time.Hour)).Error; err != nil {
+			t.Fatal(err)
+		}
+		refreshed := sessionCookie(send("GET", path, "", cookie))
+		if refreshed == nil {
+			t.Fatalf("%s: the cookie was not set again when the session was extended", path)
+		}
+		if want := int(cfg.IdleTTL.Seconds()); refreshed.MaxAge < want-1 || refreshed.MaxAge > want {
+			t.Errorf("%s: refreshed cookie MaxAge = %d, want %d", path, refreshed.MaxAge, want)
+		}
+		if refreshed.Value != cookie.Value {
+			t.Errorf("%s: the refreshed cookie carries another token", path)
+		}
+	}
+}
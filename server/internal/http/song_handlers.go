@@ -28,9 +28,9 @@ func (h *SongHandlers) ListSongs(c *gin.Context) {
 	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
 	search := c.Query("search")
 
-	songs, total, err := h.songService.ListSongs(offset, limit, search)
+	songs, total, err := h.songService.ListSongs(c.Request.Context(), offset, limit, search)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list songs"})
+		abort(c, err)
 		return
 	}
 
@@ -41,15 +41,14 @@ func (h *SongHandlers) ListSongs(c *gin.Context) {
 }
 
 func (h *SongHandlers) GetSong(c *gin.Context) {
-	id, err := uuid.Parse(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid song ID"})
+	id, ok := parseID(c, "song")
+	if !ok {
 		return
 	}
 
-	song, err := h.songService.GetSong(id)
+	song, err := h.songService.GetSong(c.Request.Context(), viewerFromContext(c), id)
 	if err != nil {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
+		abort(c, err)
 		return
 	}
 	c.JSON(http.StatusOK, song)
@@ -57,19 +56,19 @@ func (h *SongHandlers) GetSong(c *gin.Context) {
 
 func (h *SongHandlers) CreateSong(c *gin.Context) {
 	var req struct {
-		Title        string `json:"title" binding:"required"`
-		Artist       string `json:"artist" binding:"required"`
+		Title        string `json:"title" binding:"required,max=200"`
+		Artist       string `json:"artist" binding:"required,max=200"`
 		BodyChordPro string `json:"bodyChordPro" binding:"required"`
-		Key          string `json:"key"`
+		Key          string `json:"key" binding:"max=16"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	userID, _ := c.Get("userID") // From auth middleware
 	created, err := h.songService.CreateSong(
+		c.Request.Context(),
 		userID.(uuid.UUID),
 		req.Title,
 		req.Artist,
@@ -77,7 +76,7 @@ func (h *SongHandlers) CreateSong(c *gin.Context) {
 		req.Key,
 	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		abort(c, err)
 		return
 	}
 
@@ -85,26 +84,25 @@ func (h *SongHandlers) CreateSong(c *gin.Context) {
 }
 
 func (h *SongHandlers) UpdateSong(c *gin.Context) {
-	id, err := uuid.Parse(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid song ID"})
+	id, ok := parseID(c, "song")
+	if !ok {
 		return
 	}
 
 	var req struct {
-		Title        string `json:"title" binding:"required"`
-		Artist       string `json:"artist" binding:"required"`
+		Title        string `json:"title" binding:"required,max=200"`
+		Artist       string `json:"artist" binding:"required,max=200"`
 		BodyChordPro string `json:"bodyChordPro" binding:"required"`
-		Key          string `json:"key"`
+		Key          string `json:"key" binding:"max=16"`
 	}
 
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
 	userID, _ := c.Get("userID") // From auth middleware
 	updated, err := h.songService.UpdateSong(
+		c.Request.Context(),
 		userID.(uuid.UUID),
 		id,
 		req.Title,
@@ -113,7 +111,7 @@ func (h *SongHandlers) UpdateSong(c *gin.Context) {
 		req.Key,
 	)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		abort(c, err)
 		return
 	}
 
@@ -121,15 +119,57 @@ func (h *SongHandlers) UpdateSong(c *gin.Context) {
 }
 
 func (h *SongHandlers) DeleteSong(c *gin.Context) {
-	id, err := uuid.Parse(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid song ID"})
+	id, ok := parseID(c, "song")
+	if !ok {
 		return
 	}
 
 	userID, _ := c.Get("userID") // From auth middleware
-	if err := h.songService.DeleteSong(userID.(uuid.UUID), id); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+	if err := h.songService.DeleteSong(c.Request.Context(), userID.(uuid.UUID), id); err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+func (h *SongHandlers) ListTrash(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+
+	trashed, err := h.songService.ListTrash(c.Request.Context(), userID)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"songs": trashed})
+}
+
+func (h *SongHandlers) RestoreSong(c *gin.Context) {
+	id, ok := parseID(c, "song")
+	if !ok {
+		return
+	}
+
+	userID := c.MustGet("userID").(uuid.UUID)
+	restored, err := h.songService.RestoreSong(c.Request.Context(), userID, id)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, restored)
+}
+
+func (h *SongHandlers) PurgeSong(c *gin.Context) {
+	id, ok := parseID(c, "song")
+	if !ok {
+		return
+	}
+
+	userID := c.MustGet("userID").(uuid.UUID)
+	if err := h.songService.PurgeSong(c.Request.Context(), userID, id); err != nil {
+		abort(c, err)
 		return
 	}
 
@@ -0,0 +1,149 @@
+package http
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/suggestions"
+)
+
+type SuggestionHandlers struct {
+	suggestionService *suggestions.SuggestionService
+}
+
+func NewSuggestionHandlers(suggestionService *suggestions.SuggestionService) *SuggestionHandlers {
+	return &SuggestionHandlers{suggestionService: suggestionService}
+}
+
+type createSuggestionRequest struct {
+	Title        string `json:"title" binding:"required,max=200"`
+	Artist       string `json:"artist" binding:"required,max=200"`
+	BodyChordPro string `json:"bodyChordPro" binding:"required"`
+	Key          string `json:"key" binding:"max=16"`
+	Message      string `json:"message" binding:"max=5000"`
+}
+
+type rejectSuggestionRequest struct {
+	Reason string `json:"reason" binding:"required,max=5000"`
+}
+
+type suggestionCommentRequest struct {
+	Body string `json:"body" binding:"required,max=5000"`
+}
+
+func (h *SuggestionHandlers) CreateSuggestion(c *gin.Context) {
+	songID, ok := parseID(c, "song")
+	if !ok {
+		return
+	}
+
+	var req createSuggestionRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	suggestion, err := h.suggestionService.CreateSuggestion(
+		c.Request.Context(),
+		viewerFromContext(c),
+		songID,
+		req.Title,
+		req.Artist,
+		req.BodyChordPro,
+		req.Key,
+		req.Message,
+	)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, suggestion)
+}
+
+func (h *SuggestionHandlers) ListSuggestions(c *gin.Context) {
+	songID, ok := parseID(c, "song")
+	if !ok {
+		return
+	}
+
+	list, err := h.suggestionService.ListSuggestions(c.Request.Context(), viewerFromContext(c), songID, c.Query("status"))
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"suggestions": list})
+}
+
+func (h *SuggestionHandlers) GetSuggestion(c *gin.Context) {
+	suggestionID, ok := parseID(c, "suggestion")
+	if !ok {
+		return
+	}
+
+	review, err := h.suggestionService.GetReview(c.Request.Context(), viewerFromContext(c), suggestionID)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, review)
+}
+
+func (h *SuggestionHandlers) AcceptSuggestion(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+	suggestionID, ok := parseID(c, "suggestion")
+	if !ok {
+		return
+	}
+
+	song, err := h.suggestionService.AcceptSuggestion(c.Request.Context(), userID, suggestionID)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, song)
+}
+
+func (h *SuggestionHandlers) RejectSuggestion(c *gin.Context) {
+	userID := c.MustGet("userID").(uuid.UUID)
+	suggestionID, ok := parseID(c, "suggestion")
+	if !ok {
+		return
+	}
+
+	var req rejectSuggestionRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	suggestion, err := h.suggestionService.RejectSuggestion(c.Request.Context(), userID, suggestionID, req.Reason)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, suggestion)
+}
+
+func (h *SuggestionHandlers) AddComment(c *gin.Context) {
+	suggestionID, ok := parseID(c, "suggestion")
+	if !ok {
+		return
+	}
+
+	var req suggestionCommentRequest
+	if !bindJSON(c, &req) {
+		return
+	}
+
+	comment, err := h.suggestionService.AddComment(c.Request.Context(), viewerFromContext(c), suggestionID, req.Body)
+	if err != nil {
+		abort(c, err)
+		return
+	}
+
+	c.JSON(http.StatusCreated, comment)
+}
@@ -0,0 +1,53 @@
+package http
+
+import (
+	"testing"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/songs"
+)
+
+// TestHiddenSongDiscussions checks that the comments and suggestions of a
+// hidden song are only shown to its owner
+func TestHiddenSongDiscussions(t *testing.T) {
+	server, ts, _ := testServer(t)
+	doc := loadSpec(t)
+	doc.Servers = openapi3.Servers{{URL: ts.URL}}
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	anonymous := newContractClient(t, ts.URL, router)
+	alice := newContractClient(t, ts.URL, router)
+	bob := newContractClient(t, ts.URL, router)
+	alice.do("POST", "/api/auth/register", object{"email": "alice@example.com", "password": "correct horse battery", "displayName": "Alice"}, 201, nil)
+	bob.do("POST", "/api/auth/register", object{"email": "bob@example.com", "password": "staple paper clip", "displayName": "Bobby"}, 201, nil)
+
+	var song struct{ ID string }
+	alice.do("POST", "/api/songs", object{"title": "Wonderwall", "artist": "Oasis", "bodyChordPro": "[Em]Today"}, 201, &song)
+	songPath := "/api/songs/" + song.ID
+	bob.do("POST", songPath+"/comments", object{"body": "Capo on 2"}, 201, nil)
+	var suggestion struct{ ID string }
+	bob.do("POST", songPath+"/suggestions", object{"title": "Wonderwall", "artist": "Oasis", "bodyChordPro": "[Em]Today is gonna be the [G]day"}, 201, &suggestion)
+	suggestionPath := "/api/suggestions/" + suggestion.ID
+
+	if err := server.db.Model(&db.Song{}).Where("id = ?", song.ID).Update("status", songs.StatusHidden).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	anonymous.do("GET", songPath+"/comments", nil, 404, nil)
+	bob.do("GET", songPath+"/comments", nil, 404, nil)
+	bob.do("POST", songPath+"/comments", object{"body": "Still there?"}, 404, nil)
+	bob.do("GET", songPath+"/suggestions", nil, 404, nil)
+	bob.do("POST", songPath+"/suggestions", object{"title": "Wonderwall", "artist": "Oasis", "bodyChordPro": "[Em]Today"}, 404, nil)
+	bob.do("GET", suggestionPath, nil, 404, nil)
+	bob.do("POST", suggestionPath+"/comments", object{"body": "Any news?"}, 404, nil)
+
+	alice.do("GET", songPath+"/comments", nil, 200, nil)
+	alice.do("GET", songPath+"/suggestions", nil, 200, nil)
+	alice.do("GET", suggestionPath, nil, 200, nil)
+	alice.do("POST", suggestionPath+"/comments", object{"body": "Looking into it"}, 201, nil)
+}
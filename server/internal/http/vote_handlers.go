@@ -21,26 +21,19 @@ type voteRequest struct {
 }
 
 func (h *VoteHandlers) Vote(c *gin.Context) {
-	userID := c.MustGet("userID").(uuid.UUID)
-	songID, err := uuid.Parse(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid song ID"})
+	songID, ok := parseID(c, "song")
+	if !ok {
 		return
 	}
 
 	var req voteRequest
-	if err := c.ShouldBindJSON(&req); err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	if !bindJSON(c, &req) {
 		return
 	}
 
-	score, err := h.voteService.Vote(userID, songID, req.Value)
+	score, err := h.voteService.Vote(c.Request.Context(), viewerFromContext(c), songID, req.Value)
 	if err != nil {
-		if err == votes.ErrSongNotFound {
-			c.JSON(http.StatusNotFound, gin.H{"error": "Song not found"})
-			return
-		}
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to process vote"})
+		abort(c, err)
 		return
 	}
 
@@ -52,21 +45,20 @@ func (h *VoteHandlers) Vote(c *gin.Context) {
 
 func (h *VoteHandlers) GetVote(c *gin.Context) {
 	userID := c.MustGet("userID").(uuid.UUID)
-	songID, err := uuid.Parse(c.Param("id"))
-	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid song ID"})
+	songID, ok := parseID(c, "song")
+	if !ok {
 		return
 	}
 
-	vote, err := h.voteService.GetUserVote(userID, songID)
+	vote, err := h.voteService.GetUserVote(c.Request.Context(), userID, songID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get vote"})
+		abort(c, err)
 		return
 	}
 
-	score, err := h.voteService.GetSongScore(songID)
+	score, err := h.voteService.GetSongScore(c.Request.Context(), viewerFromContext(c), songID)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to get song score"})
+		abort(c, err)
 		return
 	}
 
@@ -0,0 +1,136 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/supercakecrumb/chordik/internal/logging"
+	"github.com/supercakecrumb/chordik/internal/metrics"
+)
+
+// Job is a unit of background work that runs on a fixed interval
+type Job struct {
+	Name     string
+	Interval time.Duration
+	Run      func(ctx context.Context) error
+}
+
+// Runner runs registered jobs periodically until its context is cancelled
+type Runner struct {
+	jobs []Job
+	wg   sync.WaitGroup
+
+	mu       sync.Mutex
+	running  bool
+	finished map[string]time.Time
+	failures map[string]error
+}
+
+func NewRunner() *Runner {
+	return &Runner{}
+}
+
+// Add registers a job. Jobs must be added before Start is called.
+func (r *Runner) Add(job Job) {
+	r.jobs = append(r.jobs, job)
+}
+
+// Start launches every job in its own goroutine. Each job runs once
+// immediately and then on every tick of its interval.
+func (r *Runner) Start(ctx context.Context) {
+	r.mu.Lock()
+	r.running = true
+	r.finished = make(map[string]time.Time, len(r.jobs))
+	r.failures = make(map[string]error)
+	for _, job := range r.jobs {
+		// Count from the start, so a job stuck in its first run shows up
+		r.finished[job.Name] = time.Now()
+	}
+	r.mu.Unlock()
+
+	go func() {
+		<-ctx.Done()
+		r.mu.Lock()
+		r.running = false
+		r.mu.Unlock()
+	}()
+
+	for _, job := range r.jobs {
+		r.wg.Add(1)
+		go func(job Job) {
+			defer r.wg.Done()
+			r.loop(ctx, job)
+		}(job)
+	}
+}
+
+// Check reports whether the jobs are running, have run recently and
+// succeeded the last time they ran
+func (r *Runner) Check(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.running {
+		return errors.New("background jobs are not running")
+	}
+
+	var errs []error
+	for _, job := range r.jobs {
+		// Allow for a slow run on top of the interval
+		if since := time.Since(r.finished[job.Name]); since > 2*job.Interval+time.Minute {
+			errs = append(errs, fmt.Errorf("job %s has not finished a run in %s", job.Name, since.Round(time.Second)))
+		}
+		if err := r.failures[job.Name]; err != nil {
+			errs = append(errs, fmt.Errorf("job %s failed: %w", job.Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Wait blocks until all jobs have stopped
+func (r *Runner) Wait() {
+	r.wg.Wait()
+}
+
+func (r *Runner) loop(ctx context.Context, job Job) {
+	ticker := time.NewTicker(job.Interval)
+	defer ticker.Stop()
+
+	for {
+		r.runOnce(ctx, job)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *Runner) runOnce(ctx context.Context, job Job) {
+	start := time.Now()
+	err := job.Run(ctx)
+	elapsed := time.Since(start)
+	metrics.JobDuration.WithLabelValues(job.Name).Observe(elapsed.Seconds())
+
+	r.mu.Lock()
+	r.finished[job.Name] = time.Now()
+	if err != nil {
+		r.failures[job.Name] = err
+	} else {
+		delete(r.failures, job.Name)
+	}
+	r.mu.Unlock()
+
+	if err != nil {
+		metrics.JobRuns.WithLabelValues(job.Name, "failure").Inc()
+		slog.ErrorContext(ctx, "job failed", "job", job.Name, logging.Milliseconds("duration_ms", elapsed), "error", err)
+		return
+	}
+	metrics.JobRuns.WithLabelValues(job.Name, "success").Inc()
+	metrics.JobLastSuccess.WithLabelValues(job.Name).SetToCurrentTime()
+}
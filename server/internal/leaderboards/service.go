@@ -0,0 +1,191 @@
+package leaderboards
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/apperr"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/store"
+)
+
+var (
+	ErrInvalidPeriod = apperr.Invalid("invalid_period", "Invalid period")
+	ErrInvalidBoard  = apperr.Invalid("invalid_board", "Invalid board")
+)
+
+// Boards
+const (
+	BoardContributors = "contributors"
+	BoardTopSongs     = "songs"
+	BoardRisingSongs  = "rising"
+)
+
+// Periods
+const (
+	PeriodWeek  = "week"
+	PeriodMonth = "month"
+	PeriodAll   = "all"
+)
+
+// Size is the number of entries kept per board and period
+const Size = 100
+
+type LeaderboardService struct {
+	store store.Store
+}
+
+func NewLeaderboardService(st store.Store) *LeaderboardService {
+	return &LeaderboardService{store: st}
+}
+
+// ContributorEntry is a ranked contributor
+type ContributorEntry struct {
+	Rank                int       `json:"rank"`
+	Score               int64     `json:"score"`
+	UserID              uuid.UUID `json:"userId"`
+	DisplayName         string    `json:"displayName"`
+	AcceptedSuggestions int64     `json:"acceptedSuggestions"`
+}
+
+// SongEntry is a ranked song
+type SongEntry struct {
+	Rank   int       `json:"rank"`
+	Score  int64     `json:"score"`
+	SongID uuid.UUID `json:"songId"`
+	Title  string    `json:"title"`
+	Artist string    `json:"artist"`
+}
+
+// window returns the start of the period, or the zero time for all-time
+func window(period string, now time.Time) (time.Time, error) {
+	switch period {
+	case PeriodWeek:
+		return now.AddDate(0, 0, -7), nil
+	case PeriodMonth:
+		return now.AddDate(0, -1, 0), nil
+	case PeriodAll:
+		return time.Time{}, nil
+	default:
+		return time.Time{}, ErrInvalidPeriod
+	}
+}
+
+// Refresh recomputes every board for every period. It is meant to be run
+// periodically by a background job so that requests only read the
+// precomputed rows instead of summing votes.
+func (s *LeaderboardService) Refresh(ctx context.Context) error {
+	now := time.Now()
+
+	for _, period := range []string{PeriodWeek, PeriodMonth, PeriodAll} {
+		since, err := window(period, now)
+		if err != nil {
+			return err
+		}
+
+		contributors, err := s.store.Leaderboards().ScoreCreators(ctx, since, Size)
+		if err != nil {
+			return err
+		}
+		if err := s.replace(ctx, BoardContributors, period, contributors, now); err != nil {
+			return err
+		}
+
+		songs, err := s.store.Leaderboards().ScoreSongs(ctx, since, Size)
+		if err != nil {
+			return err
+		}
+		if err := s.replace(ctx, BoardTopSongs, period, songs, now); err != nil {
+			return err
+		}
+
+		// Rising compares a period to the one before it, which has no
+		// meaning for all-time
+		if period == PeriodAll {
+			continue
+		}
+
+		rising, err := s.store.Leaderboards().ScoreRisingSongs(ctx, since, since.Add(-now.Sub(since)), Size)
+		if err != nil {
+			return err
+		}
+		if err := s.replace(ctx, BoardRisingSongs, period, rising, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// replace atomically replaces the entries of a board
+func (s *LeaderboardService) replace(ctx context.Context, board, period string, scores []store.Score, refreshedAt time.Time) error {
+	entries := make([]db.LeaderboardEntry, len(scores))
+	for i, score := range scores {
+		entries[i] = db.LeaderboardEntry{
+			Board:       board,
+			Period:      period,
+			SubjectID:   score.SubjectID,
+			Score:       score.Score,
+			Rank:        i + 1,
+			RefreshedAt: refreshedAt,
+		}
+	}
+
+	return s.store.Leaderboards().Replace(ctx, board, period, entries)
+}
+
+// GetContributors returns the contributor leaderboard for a period
+func (s *LeaderboardService) GetContributors(ctx context.Context, period string, limit int) ([]ContributorEntry, *time.Time, error) {
+	if _, err := window(period, time.Now()); err != nil {
+		return nil, nil, err
+	}
+
+	standings, err := s.store.Leaderboards().ListContributors(ctx, BoardContributors, period, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Empty boards are [] rather than null in responses
+	entries := make([]ContributorEntry, len(standings))
+	for i, standing := range standings {
+		entries[i] = ContributorEntry(standing)
+	}
+
+	refreshedAt, err := s.store.Leaderboards().RefreshedAt(ctx, BoardContributors, period)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return entries, refreshedAt, nil
+}
+
+// GetSongs returns the top or rising song leaderboard for a period
+func (s *LeaderboardService) GetSongs(ctx context.Context, board, period string, limit int) ([]SongEntry, *time.Time, error) {
+	if board != BoardTopSongs && board != BoardRisingSongs {
+		return nil, nil, ErrInvalidBoard
+	}
+	if _, err := window(period, time.Now()); err != nil {
+		return nil, nil, err
+	}
+	if board == BoardRisingSongs && period == PeriodAll {
+		return nil, nil, ErrInvalidPeriod
+	}
+
+	standings, err := s.store.Leaderboards().ListSongs(ctx, board, period, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries := make([]SongEntry, len(standings))
+	for i, standing := range standings {
+		entries[i] = SongEntry(standing)
+	}
+
+	refreshedAt, err := s.store.Leaderboards().RefreshedAt(ctx, board, period)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return entries, refreshedAt, nil
+}
@@ -0,0 +1,215 @@
+package leaderboards
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/badges"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/store"
+)
+
+var ctx = context.Background()
+
+// newTestStore returns a store on a fresh in-memory SQLite database
+func newTestStore(t *testing.T) store.Store {
+	t.Helper()
+
+	conn, err := db.NewSQLiteConnection(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if err := db.Migrate(conn.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	st := store.New(conn.DB)
+	if err := badges.NewBadgeService(st).InitializeBadges(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func createUser(t *testing.T, st store.Store, name string) *db.User {
+	t.Helper()
+
+	user := db.User{Email: name + "@example.com", PasswordHash: "x", DisplayName: name, Role: "user"}
+	if err := st.Users().Create(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+func createSong(t *testing.T, st store.Store, owner *db.User, title string) *db.Song {
+	t.Helper()
+
+	song := db.Song{Title: title, Artist: "Artist", BodyChordPro: "[C]la", Status: "visible", CreatedByID: owner.ID}
+	if err := st.Songs().Create(ctx, &song); err != nil {
+		t.Fatal(err)
+	}
+	return &song
+}
+
+func like(t *testing.T, st store.Store, voter *db.User, song *db.Song, at time.Time) {
+	t.Helper()
+
+	if err := st.Votes().Create(ctx, &db.SongLike{SongID: song.ID, UserID: voter.ID, Value: 1, CreatedAt: at}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func songIDs(entries []SongEntry) []uuid.UUID {
+	ids := make([]uuid.UUID, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.SongID
+	}
+	return ids
+}
+
+func equalIDs(a, b []uuid.UUID) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestRefresh(t *testing.T) {
+	st := newTestStore(t)
+	ana := createUser(t, st, "ana")
+	bob := createUser(t, st, "bob")
+	voters := []*db.User{createUser(t, st, "v1"), createUser(t, st, "v2"), createUser(t, st, "v3")}
+	first := createSong(t, st, ana, "First")
+	second := createSong(t, st, bob, "Second")
+
+	now := time.Now()
+	like(t, st, voters[0], first, now)
+	like(t, st, voters[1], first, now)
+	like(t, st, voters[0], second, now)
+	like(t, st, voters[1], second, now.AddDate(0, 0, -10))
+	like(t, st, voters[2], second, now.AddDate(0, 0, -10))
+
+	service := NewLeaderboardService(st)
+
+	entries, refreshedAt, err := service.GetSongs(ctx, BoardTopSongs, PeriodWeek, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if entries == nil || len(entries) != 0 || refreshedAt != nil {
+		t.Errorf("before a refresh got %v refreshed at %v, want an empty board", entries, refreshedAt)
+	}
+
+	if err := service.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		board, period string
+		want          []uuid.UUID
+	}{
+		{BoardTopSongs, PeriodWeek, []uuid.UUID{first.ID, second.ID}},
+		{BoardTopSongs, PeriodMonth, []uuid.UUID{second.ID, first.ID}},
+		{BoardTopSongs, PeriodAll, []uuid.UUID{second.ID, first.ID}},
+		// The second song got fewer votes this week than the week before
+		{BoardRisingSongs, PeriodWeek, []uuid.UUID{first.ID}},
+	}
+	for _, tt := range tests {
+		entries, refreshedAt, err := service.GetSongs(ctx, tt.board, tt.period, 10)
+		if err != nil {
+			t.Fatalf("%s/%s: %v", tt.board, tt.period, err)
+		}
+		if got := songIDs(entries); !equalIDs(got, tt.want) {
+			t.Errorf("%s/%s: got %v, want %v", tt.board, tt.period, got, tt.want)
+		}
+		if refreshedAt == nil {
+			t.Errorf("%s/%s has no refresh time", tt.board, tt.period)
+		}
+	}
+
+	contributors, _, err := service.GetContributors(ctx, PeriodWeek, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contributors) != 2 || contributors[0].UserID != ana.ID || contributors[0].Score != 2 || contributors[0].Rank != 1 {
+		t.Errorf("weekly contributors are %+v", contributors)
+	}
+
+	if _, _, err := service.GetSongs(ctx, BoardRisingSongs, PeriodAll, 10); !errors.Is(err, ErrInvalidPeriod) {
+		t.Errorf("rising of all time: got %v, want %v", err, ErrInvalidPeriod)
+	}
+
+	// Trashed songs drop off without waiting for the next refresh
+	if err := st.Songs().Trash(ctx, second); err != nil {
+		t.Fatal(err)
+	}
+	entries, _, err = service.GetSongs(ctx, BoardTopSongs, PeriodAll, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := songIDs(entries); !equalIDs(got, []uuid.UUID{first.ID}) {
+		t.Errorf("after trashing got %v, want %v", got, []uuid.UUID{first.ID})
+	}
+}
+
+// TestRefreshSkipsHiddenSongs checks that hidden songs, and votes on them,
+// stay off every board
+func TestRefreshSkipsHiddenSongs(t *testing.T) {
+	st := newTestStore(t)
+	ana := createUser(t, st, "ana")
+	bob := createUser(t, st, "bob")
+	voters := []*db.User{createUser(t, st, "v1"), createUser(t, st, "v2")}
+	shown := createSong(t, st, ana, "Shown")
+	hidden := createSong(t, st, bob, "Hidden")
+	if err := st.Songs().Update(ctx, hidden, map[string]interface{}{"status": "hidden"}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	like(t, st, voters[0], shown, now)
+	like(t, st, voters[0], hidden, now)
+	like(t, st, voters[1], hidden, now)
+
+	service := NewLeaderboardService(st)
+	if err := service.Refresh(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, board := range []string{BoardTopSongs, BoardRisingSongs} {
+		entries, _, err := service.GetSongs(ctx, board, PeriodWeek, 10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := songIDs(entries); !equalIDs(got, []uuid.UUID{shown.ID}) {
+			t.Errorf("%s: got %v, want %v", board, got, []uuid.UUID{shown.ID})
+		}
+	}
+
+	contributors, _, err := service.GetContributors(ctx, PeriodWeek, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(contributors) != 1 || contributors[0].UserID != ana.ID {
+		t.Errorf("weekly contributors are %+v, want only ana", contributors)
+	}
+
+	// Songs hidden after the refresh drop off right away
+	if err := st.Songs().Update(ctx, shown, map[string]interface{}{"status": "hidden"}); err != nil {
+		t.Fatal(err)
+	}
+	entries, _, err := service.GetSongs(ctx, BoardTopSongs, PeriodWeek, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 {
+		t.Errorf("after hiding got %v, want an empty board", songIDs(entries))
+	}
+}
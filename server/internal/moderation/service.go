@@ -0,0 +1,194 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/apperr"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/songs"
+	"github.com/supercakecrumb/chordik/internal/store"
+)
+
+var (
+	ErrReportNotFound  = apperr.NotFound("report_not_found", "Report not found")
+	ErrSongNotFound    = apperr.NotFound("song_not_found", "Song not found")
+	ErrAlreadyReported = apperr.Conflict("already_reported", "You already reported this song")
+	ErrInvalidReason   = apperr.Invalid("invalid_reason", "Invalid report reason")
+	ErrInvalidAction   = apperr.Invalid("invalid_action", "Invalid moderation action")
+	ErrAlreadyResolved = apperr.Conflict("already_resolved", "Report already resolved")
+)
+
+// Report reasons
+const (
+	ReasonSpam      = "spam"
+	ReasonCopyright = "copyright"
+	ReasonAbuse     = "abuse"
+	ReasonOther     = "other"
+)
+
+// Report statuses
+const (
+	StatusOpen      = "open"
+	StatusResolved  = "resolved"
+	StatusDismissed = "dismissed"
+)
+
+// Moderation actions
+const (
+	ActionHide    = "hide"
+	ActionDelete  = "delete"
+	ActionWarn    = "warn"
+	ActionDismiss = "dismiss"
+)
+
+type ModerationService struct {
+	store       store.Store
+	songService *songs.SongService
+}
+
+func NewModerationService(st store.Store) *ModerationService {
+	return &ModerationService{store: st, songService: songs.NewSongService(st)}
+}
+
+func validReason(reason string) bool {
+	switch reason {
+	case ReasonSpam, ReasonCopyright, ReasonAbuse, ReasonOther:
+		return true
+	}
+	return false
+}
+
+// ReportSong files a report against a song the reporter can see. A user
+// can only have one open report per song.
+func (s *ModerationService) ReportSong(ctx context.Context, reporter songs.Viewer, songID uuid.UUID, reason, details string) (*db.Report, error) {
+	if !validReason(reason) {
+		return nil, ErrInvalidReason
+	}
+
+	if _, err := s.songService.GetSong(ctx, reporter, songID); err != nil {
+		return nil, err
+	}
+	reporterID := reporter.UserID
+
+	reported, err := s.store.Reports().HasOpen(ctx, songID, reporterID)
+	if err != nil {
+		return nil, err
+	}
+	if reported {
+		return nil, ErrAlreadyReported
+	}
+
+	report := db.Report{
+		SongID:     &songID,
+		ReporterID: reporterID,
+		Reason:     reason,
+		Details:    details,
+		Status:     StatusOpen,
+	}
+
+	if err := s.store.Reports().Create(ctx, &report); err != nil {
+		return nil, err
+	}
+
+	return &report, nil
+}
+
+// ListReports returns the moderation queue, oldest reports first
+func (s *ModerationService) ListReports(ctx context.Context, status string, offset, limit int) ([]db.Report, int64, error) {
+	return s.store.Reports().List(ctx, status, offset, limit)
+}
+
+// ResolveReport applies a moderation action to the reported song and closes
+// every open report against it
+func (s *ModerationService) ResolveReport(ctx context.Context, moderatorID, reportID uuid.UUID, action, note string) (*db.Report, error) {
+	status := StatusResolved
+	switch action {
+	case ActionHide, ActionDelete, ActionWarn:
+	case ActionDismiss:
+		status = StatusDismissed
+	default:
+		return nil, ErrInvalidAction
+	}
+
+	report, err := s.store.Reports().Get(ctx, reportID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrReportNotFound
+		}
+		return nil, err
+	}
+
+	if report.Status != StatusOpen {
+		return nil, ErrAlreadyResolved
+	}
+
+	// Reports of purged songs can only be dismissed
+	if report.SongID == nil && action != ActionDismiss {
+		return nil, ErrSongNotFound
+	}
+
+	err = s.store.Transaction(ctx, func(tx store.Store) error {
+		// Close the reports first, since purging a song detaches them
+		fields := map[string]interface{}{
+			"status":         status,
+			"action":         action,
+			"moderator_note": note,
+			"resolved_by_id": moderatorID,
+			"resolved_at":    time.Now(),
+		}
+		if report.SongID != nil {
+			if err := tx.Reports().UpdateOpenBySong(ctx, *report.SongID, fields); err != nil {
+				return err
+			}
+		} else if err := tx.Reports().Update(ctx, report.ID, fields); err != nil {
+			return err
+		}
+
+		songService := songs.NewSongService(tx)
+		switch action {
+		case ActionHide:
+			if err := songService.SetStatus(ctx, *report.SongID, songs.StatusHidden); err != nil && !errors.Is(err, songs.ErrSongNotFound) {
+				return err
+			}
+		case ActionDelete:
+			if err := songService.RemoveSong(ctx, *report.SongID); err != nil && !errors.Is(err, songs.ErrSongNotFound) {
+				return err
+			}
+		case ActionWarn:
+			return warnOwner(ctx, tx, moderatorID, report, note)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return s.store.Reports().Get(ctx, reportID)
+}
+
+// warnOwner records a warning against the owner of the reported song
+func warnOwner(ctx context.Context, tx store.Store, moderatorID uuid.UUID, report *db.Report, note string) error {
+	song, err := tx.Songs().Get(ctx, *report.SongID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrSongNotFound
+		}
+		return err
+	}
+
+	message := note
+	if message == "" {
+		message = fmt.Sprintf("Your song %q was reported for %s", song.Title, report.Reason)
+	}
+
+	return tx.Reports().CreateWarning(ctx, &db.UserWarning{
+		UserID:      song.CreatedByID,
+		ModeratorID: moderatorID,
+		ReportID:    &report.ID,
+		Message:     message,
+	})
+}
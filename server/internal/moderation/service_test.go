@@ -0,0 +1,111 @@
+package moderation
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/supercakecrumb/chordik/internal/badges"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/songs"
+	"github.com/supercakecrumb/chordik/internal/store"
+)
+
+var ctx = context.Background()
+
+// newTestStore returns a store on a fresh in-memory SQLite database
+func newTestStore(t *testing.T) store.Store {
+	t.Helper()
+
+	conn, err := db.NewSQLiteConnection(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if err := db.Migrate(conn.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	st := store.New(conn.DB)
+	if err := badges.NewBadgeService(st).InitializeBadges(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func createUser(t *testing.T, st store.Store, name string) *db.User {
+	t.Helper()
+
+	user := db.User{Email: name + "@example.com", PasswordHash: "x", DisplayName: name, Role: "user"}
+	if err := st.Users().Create(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+func TestResolveReport(t *testing.T) {
+	st := newTestStore(t)
+	owner := createUser(t, st, "owner")
+	ana := createUser(t, st, "ana")
+	bob := createUser(t, st, "bob")
+	moderator := createUser(t, st, "moderator")
+
+	song := db.Song{Title: "Song", Artist: "Artist", BodyChordPro: "[C]la", Status: songs.StatusVisible, CreatedByID: owner.ID}
+	if err := st.Songs().Create(ctx, &song); err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewModerationService(st)
+
+	report, err := service.ReportSong(ctx, songs.Viewer{UserID: ana.ID}, song.ID, ReasonSpam, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.ReportSong(ctx, songs.Viewer{UserID: ana.ID}, song.ID, ReasonAbuse, ""); !errors.Is(err, ErrAlreadyReported) {
+		t.Errorf("reporting twice: got %v, want %v", err, ErrAlreadyReported)
+	}
+	if _, err := service.ReportSong(ctx, songs.Viewer{UserID: bob.ID}, song.ID, ReasonCopyright, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	open, total, err := service.ListReports(ctx, StatusOpen, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != 2 || len(open) != 2 || open[0].Reporter.DisplayName != "ana" {
+		t.Fatalf("got %d of %d open reports, want ana's first of 2", len(open), total)
+	}
+
+	if _, err := service.ResolveReport(ctx, moderator.ID, report.ID, "ban", ""); !errors.Is(err, ErrInvalidAction) {
+		t.Errorf("an unknown action: got %v, want %v", err, ErrInvalidAction)
+	}
+
+	resolved, err := service.ResolveReport(ctx, moderator.ID, report.ID, ActionHide, "Spam")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resolved.Status != StatusResolved || resolved.Action != ActionHide || resolved.ResolvedByID == nil || *resolved.ResolvedByID != moderator.ID {
+		t.Errorf("resolved report is %+v", resolved)
+	}
+
+	// Every open report against the song is closed with it
+	if _, total, err := service.ListReports(ctx, StatusOpen, 0, 10); err != nil || total != 0 {
+		t.Errorf("%d reports still open, %v", total, err)
+	}
+	if _, err := service.ResolveReport(ctx, moderator.ID, open[1].ID, ActionDismiss, ""); !errors.Is(err, ErrAlreadyResolved) {
+		t.Errorf("resolving a closed report: got %v, want %v", err, ErrAlreadyResolved)
+	}
+
+	hidden, err := st.Songs().Get(ctx, song.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hidden.Status != songs.StatusHidden {
+		t.Errorf("song status is %q, want %q", hidden.Status, songs.StatusHidden)
+	}
+	// Once hidden, the song can't be reported by those who no longer see it
+	if _, err := service.ReportSong(ctx, songs.Viewer{UserID: ana.ID}, song.ID, ReasonSpam, ""); !errors.Is(err, ErrSongNotFound) {
+		t.Errorf("reporting a hidden song: got %v, want %v", err, ErrSongNotFound)
+	}
+}
@@ -0,0 +1,34 @@
+package ratelimit
+
+import "time"
+
+// Config holds the limits for each route group. A zero Limit disables
+// limiting for that group.
+type Config struct {
+	// Auth limits login, registration and account recovery per IP
+	Auth Limit
+	// Write limits mutating API requests per user
+	Write Limit
+	// Songs limits song creation per user
+	Songs Limit
+	// Votes limits voting per user
+	Votes Limit
+	// Lockout locks accounts after repeated failed logins
+	Lockout LockoutConfig
+}
+
+// DefaultConfig returns the limits used when nothing is configured
+func DefaultConfig() Config {
+	return Config{
+		Auth:  Limit{Requests: 20, Period: time.Minute},
+		Write: Limit{Requests: 120, Period: time.Minute},
+		Songs: Limit{Requests: 20, Period: time.Hour},
+		Votes: Limit{Requests: 60, Period: time.Minute},
+		Lockout: LockoutConfig{
+			Threshold: 5,
+			BaseDelay: 30 * time.Second,
+			MaxDelay:  time.Hour,
+			Window:    24 * time.Hour,
+		},
+	}
+}
@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit allows Requests requests per Period, refilled smoothly. A client
+// that has been idle can burst up to Requests at once.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+// Enabled reports whether the limit restricts anything
+func (l Limit) Enabled() bool {
+	return l.Requests > 0 && l.Period > 0
+}
+
+// rate is the number of tokens refilled per second
+func (l Limit) rate() float64 {
+	return float64(l.Requests) / l.Period.Seconds()
+}
+
+func (l Limit) String() string {
+	if !l.Enabled() {
+		return "off"
+	}
+	return fmt.Sprintf("%d/%s", l.Requests, l.Period)
+}
+
+// MarshalText writes the limit in the form ParseLimit reads
+func (l Limit) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+// UnmarshalText parses a limit such as "10/1m" from config
+func (l *Limit) UnmarshalText(text []byte) error {
+	limit, err := ParseLimit(string(text))
+	if err != nil {
+		return err
+	}
+	*l = limit
+	return nil
+}
+
+// ParseLimit parses limits written as "<requests>/<period>", e.g. "10/1m".
+// "off" and "0" disable the limit.
+func ParseLimit(value string) (Limit, error) {
+	value = strings.TrimSpace(value)
+	if value == "off" || value == "0" {
+		return Limit{}, nil
+	}
+
+	requests, period, ok := strings.Cut(value, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q: expected <requests>/<period>", value)
+	}
+
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q: bad request count", value)
+	}
+	d, err := time.ParseDuration(period)
+	if err != nil || d <= 0 {
+		return Limit{}, fmt.Errorf("invalid limit %q: bad period", value)
+	}
+
+	return Limit{Requests: n, Period: d}, nil
+}
+
+// Result is the outcome of taking a token from a bucket
+type Result struct {
+	Allowed bool
+	// RetryAfter is how long until a token is available when not allowed
+	RetryAfter time.Duration
+}
+
+// Failures tracks consecutive failed attempts for a key
+type Failures struct {
+	Count int
+	Last  time.Time
+}
+
+// Store keeps limiter state. Implementations must be safe for concurrent
+// use; a shared store lets several API instances enforce one limit.
+type Store interface {
+	// Take removes a token from the bucket for key, creating a full
+	// bucket if there is none
+	Take(key string, limit Limit) (Result, error)
+	// AddFailure records a failed attempt. Failures older than window
+	// are forgotten.
+	AddFailure(key string, window time.Duration) (Failures, error)
+	// Failures returns the failed attempts recorded within window
+	Failures(key string, window time.Duration) (Failures, error)
+	// ResetFailures forgets the failed attempts for key
+	ResetFailures(key string) error
+}
+
+// Limiter applies one limit to keys within a namespace, so limits for
+// different route groups don't share buckets
+type Limiter struct {
+	store Store
+	name  string
+	limit Limit
+}
+
+func NewLimiter(store Store, name string, limit Limit) *Limiter {
+	return &Limiter{store: store, name: name, limit: limit}
+}
+
+// Allow takes a token for key. Disabled limits always allow.
+func (l *Limiter) Allow(key string) (Result, error) {
+	if !l.limit.Enabled() {
+		return Result{Allowed: true}, nil
+	}
+	return l.store.Take(l.name+":"+key, l.limit)
+}
@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    Limit
+		wantErr bool
+	}{
+		{value: "10/1m", want: Limit{Requests: 10, Period: time.Minute}},
+		{value: " 5/30s ", want: Limit{Requests: 5, Period: 30 * time.Second}},
+		{value: "off", want: Limit{}},
+		{value: "0", want: Limit{}},
+		{value: "10", wantErr: true},
+		{value: "-1/1m", wantErr: true},
+		{value: "ten/1m", wantErr: true},
+		{value: "10/0s", wantErr: true},
+		{value: "10/soon", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseLimit(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseLimit(%q) error = %v, wantErr %v", tt.value, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseLimit(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestLimiterAllow(t *testing.T) {
+	store := NewMemoryStore()
+	limiter := NewLimiter(store, "auth", Limit{Requests: 3, Period: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		result, err := limiter.Allow("ip:203.0.113.1")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !result.Allowed {
+			t.Fatalf("request %d was limited", i+1)
+		}
+	}
+
+	result, err := limiter.Allow("ip:203.0.113.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Allowed {
+		t.Error("request over the limit was allowed")
+	}
+	if result.RetryAfter <= 0 || result.RetryAfter > 20*time.Second {
+		t.Errorf("RetryAfter = %v, want up to the 20s it takes to refill a token", result.RetryAfter)
+	}
+
+	// Other clients and other limiters have their own buckets
+	if result, _ := limiter.Allow("ip:203.0.113.2"); !result.Allowed {
+		t.Error("another client was limited")
+	}
+	if result, _ := NewLimiter(store, "votes", Limit{Requests: 1, Period: time.Minute}).Allow("ip:203.0.113.1"); !result.Allowed {
+		t.Error("another limiter shares the bucket")
+	}
+}
+
+func TestDisabledLimiter(t *testing.T) {
+	limiter := NewLimiter(NewMemoryStore(), "auth", Limit{})
+	for i := 0; i < 100; i++ {
+		if result, _ := limiter.Allow("ip:203.0.113.1"); !result.Allowed {
+			t.Fatalf("request %d was limited", i+1)
+		}
+	}
+}
+
+func TestMemoryStoreCleanup(t *testing.T) {
+	store := NewMemoryStore()
+	limit := Limit{Requests: 2, Period: time.Minute}
+	if _, err := store.Take("used", limit); err != nil {
+		t.Fatal(err)
+	}
+	store.buckets["idle"] = &bucket{tokens: 2, last: time.Now(), limit: limit}
+	if _, err := store.AddFailure("recent", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	store.failures["old"] = &failureEntry{Failures: Failures{Count: 3, Last: time.Now().Add(-2 * time.Hour)}, window: time.Hour}
+
+	if err := store.Cleanup(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := store.buckets["used"]; !ok {
+		t.Error("a bucket that is not full was dropped")
+	}
+	if _, ok := store.buckets["idle"]; ok {
+		t.Error("a full bucket was kept")
+	}
+	if _, ok := store.failures["recent"]; !ok {
+		t.Error("recent failures were dropped")
+	}
+	if _, ok := store.failures["old"]; ok {
+		t.Error("forgotten failures were kept")
+	}
+}
@@ -0,0 +1,91 @@
+package ratelimit
+
+import (
+	"strings"
+	"time"
+)
+
+// LockoutConfig controls progressive lockout after failed logins
+type LockoutConfig struct {
+	// Threshold is the number of failures allowed before locking.
+	// Zero disables lockout.
+	Threshold int
+	// BaseDelay is the first lockout. It doubles with every further
+	// failure up to MaxDelay.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// Window is how long failures are remembered after the last one
+	Window time.Duration
+}
+
+// Lockout locks accounts out for increasing periods after repeated failed
+// logins
+type Lockout struct {
+	store  Store
+	config LockoutConfig
+}
+
+func NewLockout(store Store, config LockoutConfig) *Lockout {
+	return &Lockout{store: store, config: config}
+}
+
+// Check returns how long the account is still locked, or zero if it may
+// attempt to log in
+func (l *Lockout) Check(account string) (time.Duration, error) {
+	if l.config.Threshold <= 0 {
+		return 0, nil
+	}
+
+	failures, err := l.store.Failures(lockoutKey(account), l.config.Window)
+	if err != nil {
+		return 0, err
+	}
+	return l.remaining(failures), nil
+}
+
+// Fail records a failed login and returns how long the account is now
+// locked
+func (l *Lockout) Fail(account string) (time.Duration, error) {
+	if l.config.Threshold <= 0 {
+		return 0, nil
+	}
+
+	failures, err := l.store.AddFailure(lockoutKey(account), l.config.Window)
+	if err != nil {
+		return 0, err
+	}
+	return l.remaining(failures), nil
+}
+
+// Succeed clears the failures of an account after a successful login
+func (l *Lockout) Succeed(account string) error {
+	if l.config.Threshold <= 0 {
+		return nil
+	}
+	return l.store.ResetFailures(lockoutKey(account))
+}
+
+func (l *Lockout) remaining(failures Failures) time.Duration {
+	if failures.Count < l.config.Threshold {
+		return 0
+	}
+
+	delay := l.config.BaseDelay
+	for i := l.config.Threshold; i < failures.Count && delay < l.config.MaxDelay; i++ {
+		delay *= 2
+	}
+	if delay > l.config.MaxDelay {
+		delay = l.config.MaxDelay
+	}
+
+	if remaining := time.Until(failures.Last.Add(delay)); remaining > 0 {
+		return remaining
+	}
+	return 0
+}
+
+// lockoutKey normalizes account identifiers so "A@x.com" and "a@x.com"
+// share a lockout
+func lockoutKey(account string) string {
+	return "lockout:" + strings.ToLower(strings.TrimSpace(account))
+}
@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockout(t *testing.T) {
+	lockout := NewLockout(NewMemoryStore(), LockoutConfig{
+		Threshold: 3,
+		BaseDelay: time.Minute,
+		MaxDelay:  5 * time.Minute,
+		Window:    time.Hour,
+	})
+
+	// Failures up to the threshold lock nothing, then the delay doubles
+	// up to the maximum
+	want := []time.Duration{0, 0, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, delay := range want {
+		locked, err := lockout.Fail("alice@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !near(locked, delay) {
+			t.Errorf("failure %d: locked for %v, want %v", i+1, locked, delay)
+		}
+	}
+
+	// Accounts are matched regardless of case and spacing
+	locked, err := lockout.Check(" Alice@Example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !near(locked, 5*time.Minute) {
+		t.Errorf("Check() = %v, want %v", locked, 5*time.Minute)
+	}
+	if locked, _ := lockout.Check("bob@example.com"); locked != 0 {
+		t.Errorf("another account is locked for %v", locked)
+	}
+
+	if err := lockout.Succeed("alice@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	if locked, _ := lockout.Check("alice@example.com"); locked != 0 {
+		t.Errorf("locked for %v after a successful login", locked)
+	}
+}
+
+func TestDisabledLockout(t *testing.T) {
+	lockout := NewLockout(NewMemoryStore(), LockoutConfig{})
+	for i := 0; i < 10; i++ {
+		if locked, _ := lockout.Fail("alice@example.com"); locked != 0 {
+			t.Fatalf("failure %d locked the account for %v", i+1, locked)
+		}
+	}
+	if locked, _ := lockout.Check("alice@example.com"); locked != 0 {
+		t.Errorf("Check() = %v, want 0", locked)
+	}
+}
+
+// near reports whether a remaining lockout matches a delay, allowing for
+// the time the test takes
+func near(remaining, delay time.Duration) bool {
+	return remaining <= delay && remaining > delay-time.Second
+}
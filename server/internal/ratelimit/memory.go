@@ -0,0 +1,120 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	limit  Limit
+}
+
+type failureEntry struct {
+	Failures
+	window time.Duration
+}
+
+// MemoryStore keeps limiter state in process memory. State is lost on
+// restart and not shared between instances.
+type MemoryStore struct {
+	mu       sync.Mutex
+	buckets  map[string]*bucket
+	failures map[string]*failureEntry
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		buckets:  make(map[string]*bucket),
+		failures: make(map[string]*failureEntry),
+	}
+}
+
+func (s *MemoryStore) Take(key string, limit Limit) (Result, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Requests), last: now}
+		s.buckets[key] = b
+	}
+	b.limit = limit
+	b.refill(now)
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return Result{Allowed: true}, nil
+	}
+
+	wait := (1 - b.tokens) / limit.rate()
+	return Result{RetryAfter: time.Duration(math.Ceil(wait * float64(time.Second)))}, nil
+}
+
+func (b *bucket) refill(now time.Time) {
+	elapsed := now.Sub(b.last).Seconds()
+	b.tokens = math.Min(float64(b.limit.Requests), b.tokens+elapsed*b.limit.rate())
+	b.last = now
+}
+
+func (s *MemoryStore) AddFailure(key string, window time.Duration) (Failures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	entry, ok := s.failures[key]
+	if !ok || now.Sub(entry.Last) > window {
+		entry = &failureEntry{}
+		s.failures[key] = entry
+	}
+	entry.Count++
+	entry.Last = now
+	entry.window = window
+
+	return entry.Failures, nil
+}
+
+func (s *MemoryStore) Failures(key string, window time.Duration) (Failures, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.failures[key]
+	if !ok || time.Since(entry.Last) > window {
+		return Failures{}, nil
+	}
+	return entry.Failures, nil
+}
+
+func (s *MemoryStore) ResetFailures(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.failures, key)
+	return nil
+}
+
+// Cleanup drops full buckets and forgotten failures so idle clients don't
+// hold memory. It is meant to run as a background job.
+func (s *MemoryStore) Cleanup(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, b := range s.buckets {
+		b.refill(now)
+		if b.tokens >= float64(b.limit.Requests) {
+			delete(s.buckets, key)
+		}
+	}
+	for key, entry := range s.failures {
+		if now.Sub(entry.Last) > entry.window {
+			delete(s.failures, key)
+		}
+	}
+
+	return nil
+}
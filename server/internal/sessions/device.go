@@ -0,0 +1,57 @@
+package sessions
+
+import "strings"
+
+type uaMarker struct {
+	markers []string
+	label   string
+}
+
+// Order matters: Edge and Opera also advertise Chrome, and Chrome also
+// advertises Safari
+var browsers = []uaMarker{
+	{markers: []string{"Edg/", "Edge/"}, label: "Edge"},
+	{markers: []string{"OPR/", "Opera"}, label: "Opera"},
+	{markers: []string{"Firefox/"}, label: "Firefox"},
+	{markers: []string{"Chrome/"}, label: "Chrome"},
+	{markers: []string{"Safari/"}, label: "Safari"},
+	{markers: []string{"curl/"}, label: "curl"},
+}
+
+// Android and iOS user agents also mention Linux and Mac OS X
+var systems = []uaMarker{
+	{markers: []string{"Android"}, label: "Android"},
+	{markers: []string{"iPhone", "iPad"}, label: "iOS"},
+	{markers: []string{"Windows"}, label: "Windows"},
+	{markers: []string{"Mac OS X", "Macintosh"}, label: "macOS"},
+	{markers: []string{"Linux"}, label: "Linux"},
+}
+
+// Describe turns a user agent into a short "Browser on OS" label for the
+// session list
+func Describe(userAgent string) string {
+	browser := match(userAgent, browsers)
+	system := match(userAgent, systems)
+
+	switch {
+	case browser != "" && system != "":
+		return browser + " on " + system
+	case browser != "":
+		return browser
+	case system != "":
+		return system
+	default:
+		return "Unknown device"
+	}
+}
+
+func match(userAgent string, candidates []uaMarker) string {
+	for _, candidate := range candidates {
+		for _, marker := range candidate.markers {
+			if strings.Contains(userAgent, marker) {
+				return candidate.label
+			}
+		}
+	}
+	return ""
+}
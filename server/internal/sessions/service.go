@@ -0,0 +1,231 @@
+package sessions
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/apperr"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/store"
+)
+
+var (
+	ErrSessionNotFound = apperr.NotFound("session_not_found", "Session not found")
+)
+
+// Config controls session lifetimes and the attributes of the session cookie
+type Config struct {
+	CookieName string
+	Domain     string
+	Path       string
+	Secure     bool
+	SameSite   http.SameSite
+	// IdleTTL is how long a session lives without being used. Every use
+	// slides the expiry forward by this much.
+	IdleTTL time.Duration
+	// MaxLifetime caps how long a session can be kept alive by sliding
+	MaxLifetime time.Duration
+}
+
+// DefaultConfig returns the settings used when nothing is configured
+func DefaultConfig() Config {
+	return Config{
+		CookieName:  "session",
+		Path:        "/",
+		SameSite:    http.SameSiteLaxMode,
+		IdleTTL:     7 * 24 * time.Hour,
+		MaxLifetime: 30 * 24 * time.Hour,
+	}
+}
+
+// Cookie builds the session cookie carrying a raw token. It lives as long
+// as the session, so it has to be set again whenever the session expiry
+// slides forward.
+func (c Config) Cookie(token string, expiresAt time.Time) *http.Cookie {
+	return &http.Cookie{
+		Name:     c.CookieName,
+		Value:    token,
+		Path:     c.Path,
+		Domain:   c.Domain,
+		MaxAge:   int(time.Until(expiresAt).Round(time.Second).Seconds()),
+		Secure:   c.Secure,
+		HttpOnly: true,
+		SameSite: c.SameSite,
+	}
+}
+
+// ExpiredCookie builds a cookie that clears the session cookie
+func (c Config) ExpiredCookie() *http.Cookie {
+	cookie := c.Cookie("", time.Time{})
+	cookie.MaxAge = -1
+	return cookie
+}
+
+// Metadata describes the client a session was created from
+type Metadata struct {
+	IP        string
+	UserAgent string
+}
+
+// touchInterval limits how often a session is written to on use
+const touchInterval = time.Minute
+
+type SessionService struct {
+	store  store.Store
+	config Config
+}
+
+func NewSessionService(store store.Store, config Config) *SessionService {
+	return &SessionService{store: store, config: config}
+}
+
+// Config returns the session settings
+func (s *SessionService) Config() Config {
+	return s.config
+}
+
+// Create starts a new session and returns it along with the opaque token
+// for the cookie. Only a hash of the token is stored. Every session gets a
+// fresh CSRF token, so logging in rotates it.
+func (s *SessionService) Create(ctx context.Context, userID uuid.UUID, meta Metadata) (*db.Session, string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	csrfToken, err := randomToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := db.Session{
+		UserID:     userID,
+		TokenHash:  hashToken(token),
+		CSRFToken:  csrfToken,
+		IP:         meta.IP,
+		UserAgent:  meta.UserAgent,
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(s.config.IdleTTL),
+	}
+
+	if err := s.store.Sessions().Create(ctx, &session); err != nil {
+		return nil, "", err
+	}
+
+	return &session, token, nil
+}
+
+// Lookup returns the active session for a token with its user preloaded,
+// sliding its expiry forward. extended reports whether the expiry moved,
+// in which case the cookie should be set again.
+func (s *SessionService) Lookup(ctx context.Context, token string) (session *db.Session, extended bool, err error) {
+	session, err = s.store.Sessions().GetActive(ctx, hashToken(token), time.Now())
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, false, ErrSessionNotFound
+		}
+		return nil, false, err
+	}
+
+	extended, err = s.touch(ctx, session)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return session, extended, nil
+}
+
+// touch records activity and extends the session, without outliving its
+// maximum lifetime. It reports whether the session was extended.
+func (s *SessionService) touch(ctx context.Context, session *db.Session) (bool, error) {
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) < touchInterval {
+		return false, nil
+	}
+
+	expiresAt := now.Add(s.config.IdleTTL)
+	if limit := session.CreatedAt.Add(s.config.MaxLifetime); expiresAt.After(limit) {
+		expiresAt = limit
+	}
+
+	if err := s.store.Sessions().Touch(ctx, session.ID, now, expiresAt); err != nil {
+		return false, err
+	}
+
+	session.LastSeenAt = now
+	session.ExpiresAt = expiresAt
+	return true, nil
+}
+
+// CSRFToken returns the CSRF token bound to the session for a token
+func (s *SessionService) CSRFToken(ctx context.Context, token string) (string, error) {
+	csrfToken, err := s.store.Sessions().CSRFToken(ctx, hashToken(token), time.Now())
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return "", ErrSessionNotFound
+		}
+		return "", err
+	}
+	return csrfToken, nil
+}
+
+// Delete ends the session for a token
+func (s *SessionService) Delete(ctx context.Context, token string) error {
+	return s.store.Sessions().DeleteByTokenHash(ctx, hashToken(token))
+}
+
+// List returns the active sessions of a user, most recently used first
+func (s *SessionService) List(ctx context.Context, userID uuid.UUID) ([]db.Session, error) {
+	return s.store.Sessions().ListActive(ctx, userID, time.Now())
+}
+
+// Revoke ends one of a user's sessions
+func (s *SessionService) Revoke(ctx context.Context, userID, sessionID uuid.UUID) error {
+	found, err := s.store.Sessions().Delete(ctx, userID, sessionID)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAll ends every session of a user, except the given one if set
+func (s *SessionService) RevokeAll(ctx context.Context, userID uuid.UUID, except *uuid.UUID) error {
+	return s.store.Sessions().DeleteForUser(ctx, userID, except)
+}
+
+// CountActive counts the sessions that have not expired
+func (s *SessionService) CountActive(ctx context.Context) (int64, error) {
+	return s.store.Sessions().CountActive(ctx, time.Now())
+}
+
+// CleanupExpired deletes expired sessions and sessions from before tokens
+// were hashed
+func (s *SessionService) CleanupExpired(ctx context.Context) error {
+	return s.store.Sessions().DeleteExpired(ctx, time.Now())
+}
+
+// hashToken returns the stored form of a session token
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// randomToken returns 32 bytes of randomness encoded for use in cookies and headers
+func randomToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
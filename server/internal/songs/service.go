@@ -1,34 +1,62 @@
 package songs
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/apperr"
 	"github.com/supercakecrumb/chordik/internal/badges"
 	"github.com/supercakecrumb/chordik/internal/db"
-	"gorm.io/gorm"
+	"github.com/supercakecrumb/chordik/internal/metrics"
+	"github.com/supercakecrumb/chordik/internal/store"
+	"go.opentelemetry.io/otel"
 )
 
 var (
-	ErrSongNotFound     = errors.New("song not found")
-	ErrPermissionDenied = errors.New("permission denied")
-	ErrInvalidChordPro  = errors.New("invalid chordpro format")
+	ErrSongNotFound     = apperr.NotFound("song_not_found", "Song not found")
+	ErrPermissionDenied = apperr.Forbidden("permission_denied", "Permission denied")
+	ErrInvalidChordPro  = apperr.Invalid("invalid_chordpro", "Invalid ChordPro")
 )
 
+// Song visibility statuses
+const (
+	StatusVisible = "visible"
+	StatusHidden  = "hidden"
+)
+
+// Viewer identifies who is looking at a song. The zero value is an
+// anonymous visitor.
+type Viewer struct {
+	UserID    uuid.UUID
+	Moderator bool
+}
+
+// canSee reports whether the viewer may see a song in its current status
+func (v Viewer) canSee(song *db.Song) bool {
+	return song.Status != StatusHidden || v.Moderator || (v.UserID != uuid.Nil && v.UserID == song.CreatedByID)
+}
+
+var tracer = otel.Tracer("github.com/supercakecrumb/chordik/internal/songs")
+
 type SongService struct {
-	db           *gorm.DB
+	store        store.Store
 	badgeService *badges.BadgeService
 }
 
-func NewSongService(db *gorm.DB) *SongService {
+func NewSongService(store store.Store) *SongService {
 	return &SongService{
-		db:           db,
-		badgeService: badges.NewBadgeService(db),
+		store:        store,
+		badgeService: badges.NewBadgeService(store),
 	}
 }
 
-func (s *SongService) CreateSong(userID uuid.UUID, title, artist, bodyChordPro, key string) (*db.Song, error) {
-	if !isValidChordPro(bodyChordPro) {
+func (s *SongService) CreateSong(ctx context.Context, userID uuid.UUID, title, artist, bodyChordPro, key string) (*db.Song, error) {
+	ctx, span := tracer.Start(ctx, "SongService.CreateSong")
+	defer span.End()
+
+	if !IsValidChordPro(bodyChordPro) {
 		return nil, ErrInvalidChordPro
 	}
 
@@ -37,36 +65,51 @@ func (s *SongService) CreateSong(userID uuid.UUID, title, artist, bodyChordPro,
 		Artist:       artist,
 		BodyChordPro: bodyChordPro,
 		Key:          key,
+		Status:       StatusVisible,
 		CreatedByID:  userID,
 	}
 
-	if err := s.db.Create(&song).Error; err != nil {
+	if err := s.store.Songs().Create(ctx, &song); err != nil {
 		return nil, err
 	}
+	metrics.SongsCreated.Inc()
 
 	// Evaluate contributor badges after song creation
-	if err := s.badgeService.EvaluateContributorBadges(userID); err != nil {
+	if err := s.badgeService.EvaluateContributorBadges(ctx, userID); err != nil {
 		return nil, err
 	}
 
 	return &song, nil
 }
 
-func (s *SongService) GetSong(id uuid.UUID) (*db.Song, error) {
-	var song db.Song
-	if err := s.db.Preload("CreatedBy").First(&song, "id = ?", id).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+// GetSong returns a song. Hidden songs are only visible to their owner
+// and moderators.
+func (s *SongService) GetSong(ctx context.Context, viewer Viewer, id uuid.UUID) (*db.Song, error) {
+	ctx, span := tracer.Start(ctx, "SongService.GetSong")
+	defer span.End()
+
+	song, err := s.store.Songs().GetWithCreator(ctx, id)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
 			return nil, ErrSongNotFound
 		}
 		return nil, err
 	}
-	return &song, nil
+
+	if !viewer.canSee(song) {
+		return nil, ErrSongNotFound
+	}
+
+	return song, nil
 }
 
-func (s *SongService) UpdateSong(userID, songID uuid.UUID, title, artist, bodyChordPro, key string) (*db.Song, error) {
-	var song db.Song
-	if err := s.db.First(&song, "id = ?", songID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+func (s *SongService) UpdateSong(ctx context.Context, userID, songID uuid.UUID, title, artist, bodyChordPro, key string) (*db.Song, error) {
+	ctx, span := tracer.Start(ctx, "SongService.UpdateSong")
+	defer span.End()
+
+	song, err := s.store.Songs().Get(ctx, songID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
 			return nil, ErrSongNotFound
 		}
 		return nil, err
@@ -77,7 +120,7 @@ func (s *SongService) UpdateSong(userID, songID uuid.UUID, title, artist, bodyCh
 		return nil, ErrPermissionDenied
 	}
 
-	if !isValidChordPro(bodyChordPro) {
+	if !IsValidChordPro(bodyChordPro) {
 		return nil, ErrInvalidChordPro
 	}
 
@@ -88,17 +131,22 @@ func (s *SongService) UpdateSong(userID, songID uuid.UUID, title, artist, bodyCh
 		"key":            key,
 	}
 
-	if err := s.db.Model(&song).Updates(updates).Error; err != nil {
+	if err := s.store.Songs().Update(ctx, song, updates); err != nil {
 		return nil, err
 	}
 
-	return &song, nil
+	return song, nil
 }
 
-func (s *SongService) DeleteSong(userID, songID uuid.UUID) error {
-	var song db.Song
-	if err := s.db.First(&song, "id = ?", songID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+// DeleteSong moves a song to its owner's trash. It can be restored until
+// it is purged.
+func (s *SongService) DeleteSong(ctx context.Context, userID, songID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "SongService.DeleteSong")
+	defer span.End()
+
+	song, err := s.store.Songs().Get(ctx, songID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
 			return ErrSongNotFound
 		}
 		return err
@@ -109,34 +157,168 @@ func (s *SongService) DeleteSong(userID, songID uuid.UUID) error {
 		return ErrPermissionDenied
 	}
 
-	return s.db.Delete(&song).Error
+	if err := s.store.Songs().Trash(ctx, song); err != nil {
+		return err
+	}
+
+	// Deleting a song may drop the owner below a badge threshold
+	return s.badgeService.EvaluateUserBadges(ctx, song.CreatedByID)
+}
+
+// RemoveSong permanently deletes a song regardless of ownership. It is
+// meant for moderators acting on reports, so the song skips the trash.
+func (s *SongService) RemoveSong(ctx context.Context, songID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "SongService.RemoveSong")
+	defer span.End()
+
+	song, err := s.store.Songs().GetAny(ctx, songID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return ErrSongNotFound
+		}
+		return err
+	}
+
+	return s.purge(ctx, song)
+}
+
+// ListTrash returns the deleted songs of a user, most recently deleted first
+func (s *SongService) ListTrash(ctx context.Context, userID uuid.UUID) ([]db.Song, error) {
+	ctx, span := tracer.Start(ctx, "SongService.ListTrash")
+	defer span.End()
+
+	return s.store.Songs().ListTrash(ctx, userID)
+}
+
+// RestoreSong moves a song out of the trash
+func (s *SongService) RestoreSong(ctx context.Context, userID, songID uuid.UUID) (*db.Song, error) {
+	ctx, span := tracer.Start(ctx, "SongService.RestoreSong")
+	defer span.End()
+
+	song, err := s.findTrashed(ctx, userID, songID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.store.Songs().Restore(ctx, song); err != nil {
+		return nil, err
+	}
+
+	// Restored songs count toward badges again
+	if err := s.badgeService.EvaluateUserBadges(ctx, song.CreatedByID); err != nil {
+		return nil, err
+	}
+
+	return song, nil
 }
 
-func (s *SongService) ListSongs(offset, limit int, search string) ([]db.Song, int64, error) {
-	var songs []db.Song
-	var total int64
+// PurgeSong permanently deletes a song from the trash
+func (s *SongService) PurgeSong(ctx context.Context, userID, songID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "SongService.PurgeSong")
+	defer span.End()
+
+	song, err := s.findTrashed(ctx, userID, songID)
+	if err != nil {
+		return err
+	}
+
+	return s.purge(ctx, song)
+}
 
-	query := s.db.Model(&db.Song{}).Preload("CreatedBy").Order("created_at DESC")
+// PurgeExpired permanently deletes songs that have been in the trash for
+// longer than the retention period
+func (s *SongService) PurgeExpired(ctx context.Context, retention time.Duration) error {
+	ctx, span := tracer.Start(ctx, "SongService.PurgeExpired")
+	defer span.End()
 
-	if search != "" {
-		query = query.Where("title ILIKE ? OR artist ILIKE ?", "%"+search+"%", "%"+search+"%")
+	expired, err := s.store.Songs().ListTrashedBefore(ctx, time.Now().Add(-retention))
+	if err != nil {
+		return err
 	}
 
-	// Get total count
-	if err := query.Count(&total).Error; err != nil {
-		return nil, 0, err
+	for i := range expired {
+		if err := s.purge(ctx, &expired[i]); err != nil {
+			return err
+		}
 	}
 
-	// Get paginated results
-	if err := query.Offset(offset).Limit(limit).Find(&songs).Error; err != nil {
-		return nil, 0, err
+	return nil
+}
+
+func (s *SongService) findTrashed(ctx context.Context, userID, songID uuid.UUID) (*db.Song, error) {
+	song, err := s.store.Songs().GetTrashed(ctx, songID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrSongNotFound
+		}
+		return nil, err
+	}
+
+	// Check ownership
+	if song.CreatedByID != userID {
+		return nil, ErrPermissionDenied
 	}
 
-	return songs, total, nil
+	return song, nil
+}
+
+// PurgeUserSongs permanently deletes every song of a user, including the
+// ones in the trash
+func (s *SongService) PurgeUserSongs(ctx context.Context, userID uuid.UUID) error {
+	ctx, span := tracer.Start(ctx, "SongService.PurgeUserSongs")
+	defer span.End()
+
+	owned, err := s.store.Songs().ListByCreator(ctx, userID)
+	if err != nil {
+		return err
+	}
+
+	for i := range owned {
+		if err := s.purge(ctx, &owned[i]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// purge removes a song together with its votes, comments, suggestions and
+// leaderboard entries. Reports are kept as a moderation record but detached
+// from the song.
+func (s *SongService) purge(ctx context.Context, song *db.Song) error {
+	if err := s.store.Songs().Purge(ctx, song); err != nil {
+		return err
+	}
+
+	// Purged votes no longer count toward the popular badge
+	return s.badgeService.EvaluateUserBadges(ctx, song.CreatedByID)
+}
+
+// SetStatus hides or reveals a song
+func (s *SongService) SetStatus(ctx context.Context, songID uuid.UUID, status string) error {
+	ctx, span := tracer.Start(ctx, "SongService.SetStatus")
+	defer span.End()
+
+	found, err := s.store.Songs().SetStatus(ctx, songID, status)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrSongNotFound
+	}
+	return nil
+}
+
+func (s *SongService) ListSongs(ctx context.Context, offset, limit int, search string) ([]db.Song, int64, error) {
+	ctx, span := tracer.Start(ctx, "SongService.ListSongs")
+	defer span.End()
+
+	return s.store.Songs().List(ctx, StatusVisible, offset, limit, search)
 }
 
-// Basic ChordPro format validation
-func isValidChordPro(body string) bool {
+// IsValidChordPro does basic ChordPro format validation. Edit suggestions
+// are checked the same way, so they can be accepted as they are.
+func IsValidChordPro(body string) bool {
 	// TODO: Implement more robust validation
 	return len(body) > 0 && len(body) < 65536 // Basic length check
 }
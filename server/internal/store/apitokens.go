@@ -0,0 +1,55 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"gorm.io/gorm"
+)
+
+type apiTokenRepository struct {
+	db *gorm.DB
+}
+
+func (r *apiTokenRepository) Create(ctx context.Context, token *db.APIToken) error {
+	return r.db.WithContext(ctx).Create(token).Error
+}
+
+func (r *apiTokenRepository) ListByUser(ctx context.Context, userID uuid.UUID) ([]db.APIToken, error) {
+	var tokens []db.APIToken
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).
+		Order("created_at DESC").
+		Find(&tokens).Error; err != nil {
+		return nil, err
+	}
+	return tokens, nil
+}
+
+func (r *apiTokenRepository) GetActive(ctx context.Context, tokenHash string, now time.Time) (*db.APIToken, error) {
+	var token db.APIToken
+	if err := r.db.WithContext(ctx).Preload("User").
+		Where("token_hash = ? AND expires_at > ?", tokenHash, now).
+		First(&token).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &token, nil
+}
+
+func (r *apiTokenRepository) Touch(ctx context.Context, id uuid.UUID, lastUsedAt time.Time) error {
+	return r.db.WithContext(ctx).Model(&db.APIToken{}).Where("id = ?", id).Update("last_used_at", lastUsedAt).Error
+}
+
+func (r *apiTokenRepository) Delete(ctx context.Context, userID, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&db.APIToken{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *apiTokenRepository) DeleteForUser(ctx context.Context, userID uuid.UUID) error {
+	return r.db.WithContext(ctx).Where("user_id = ?", userID).Delete(&db.APIToken{}).Error
+}
+
+func (r *apiTokenRepository) DeleteExpired(ctx context.Context, now time.Time) error {
+	return r.db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&db.APIToken{}).Error
+}
@@ -0,0 +1,76 @@
+package store
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"gorm.io/gorm"
+)
+
+type badgeRepository struct {
+	db *gorm.DB
+}
+
+func (r *badgeRepository) Upsert(ctx context.Context, badge *db.Badge) error {
+	attrs := db.Badge{
+		Name:        badge.Name,
+		Description: badge.Description,
+		Threshold:   badge.Threshold,
+		Revocable:   badge.Revocable,
+	}
+	// Assign keeps an existing badge in sync with the given definition
+	return r.db.WithContext(ctx).Where(db.Badge{Code: badge.Code}).Assign(attrs).FirstOrCreate(badge).Error
+}
+
+func (r *badgeRepository) GetByCode(ctx context.Context, code string) (*db.Badge, error) {
+	var badge db.Badge
+	if err := r.db.WithContext(ctx).First(&badge, "code = ?", code).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &badge, nil
+}
+
+func (r *badgeRepository) ListAwards(ctx context.Context, userID uuid.UUID) ([]db.UserBadge, error) {
+	var awards []db.UserBadge
+	if err := r.db.WithContext(ctx).Where("user_id = ?", userID).Find(&awards).Error; err != nil {
+		return nil, err
+	}
+	return awards, nil
+}
+
+func (r *badgeRepository) HasAward(ctx context.Context, userID, badgeID uuid.UUID) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&db.UserBadge{}).
+		Where("user_id = ? AND badge_id = ?", userID, badgeID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *badgeRepository) CreateAward(ctx context.Context, award *db.UserBadge) error {
+	return r.db.WithContext(ctx).Create(award).Error
+}
+
+func (r *badgeRepository) DeleteAward(ctx context.Context, userID, badgeID uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).Where("user_id = ? AND badge_id = ?", userID, badgeID).Delete(&db.UserBadge{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *badgeRepository) CreateEvent(ctx context.Context, event *db.BadgeEvent) error {
+	return r.db.WithContext(ctx).Create(event).Error
+}
+
+func (r *badgeRepository) History(ctx context.Context, userID uuid.UUID) ([]BadgeHistory, error) {
+	var history []BadgeHistory
+	if err := r.db.WithContext(ctx).Model(&db.BadgeEvent{}).
+		Select("badges.code, badges.name, badge_events.action, badge_events.created_at").
+		Joins("JOIN badges ON badges.id = badge_events.badge_id").
+		Where("badge_events.user_id = ?", userID).
+		Order("badge_events.created_at DESC").
+		Scan(&history).Error; err != nil {
+		return nil, err
+	}
+	return history, nil
+}
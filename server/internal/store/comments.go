@@ -0,0 +1,51 @@
+package store
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"gorm.io/gorm"
+)
+
+type commentRepository struct {
+	db *gorm.DB
+}
+
+func (r *commentRepository) Create(ctx context.Context, comment *db.Comment) error {
+	return r.db.WithContext(ctx).Create(comment).Error
+}
+
+func (r *commentRepository) Get(ctx context.Context, id uuid.UUID) (*db.Comment, error) {
+	var comment db.Comment
+	if err := r.db.WithContext(ctx).First(&comment, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &comment, nil
+}
+
+func (r *commentRepository) ListBySong(ctx context.Context, songID uuid.UUID) ([]db.Comment, error) {
+	var comments []db.Comment
+	if err := r.db.WithContext(ctx).Preload("User").
+		Where("song_id = ? AND suggestion_id IS NULL", songID).
+		Order("created_at ASC").
+		Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (r *commentRepository) ListBySuggestion(ctx context.Context, suggestionID uuid.UUID) ([]db.Comment, error) {
+	var comments []db.Comment
+	if err := r.db.WithContext(ctx).Preload("User").
+		Where("suggestion_id = ?", suggestionID).
+		Order("created_at ASC").
+		Find(&comments).Error; err != nil {
+		return nil, err
+	}
+	return comments, nil
+}
+
+func (r *commentRepository) Update(ctx context.Context, comment *db.Comment, fields map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(comment).Updates(fields).Error
+}
@@ -0,0 +1,110 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/supercakecrumb/chordik/internal/db"
+	"gorm.io/gorm"
+)
+
+type leaderboardRepository struct {
+	db *gorm.DB
+}
+
+func (r *leaderboardRepository) ScoreCreators(ctx context.Context, since time.Time, limit int) ([]Score, error) {
+	var rows []Score
+	err := r.db.WithContext(ctx).Model(&db.SongLike{}).
+		Select("songs.created_by_id AS subject_id, SUM(song_likes.value) AS score").
+		Joins("JOIN songs ON songs.id = song_likes.song_id AND songs.deleted_at IS NULL AND songs.status = 'visible'").
+		Where("song_likes.created_at >= ?", since).
+		Group("songs.created_by_id").
+		Order("score DESC").
+		Limit(limit).
+		Scan(&rows).Error
+	return rows, err
+}
+
+func (r *leaderboardRepository) ScoreSongs(ctx context.Context, since time.Time, limit int) ([]Score, error) {
+	var rows []Score
+	err := r.db.WithContext(ctx).Model(&db.SongLike{}).
+		Select("song_likes.song_id AS subject_id, SUM(song_likes.value) AS score").
+		Joins("JOIN songs ON songs.id = song_likes.song_id AND songs.deleted_at IS NULL AND songs.status = 'visible'").
+		Where("song_likes.created_at >= ?", since).
+		Group("song_likes.song_id").
+		Order("score DESC").
+		Limit(limit).
+		Scan(&rows).Error
+	return rows, err
+}
+
+// ScoreRisingSongs only ranks songs that gained votes
+func (r *leaderboardRepository) ScoreRisingSongs(ctx context.Context, since, previous time.Time, limit int) ([]Score, error) {
+	var rows []Score
+	err := r.db.WithContext(ctx).Model(&db.SongLike{}).
+		Select(`song_likes.song_id AS subject_id,
+			SUM(CASE WHEN song_likes.created_at >= ? THEN song_likes.value ELSE -song_likes.value END) AS score`, since).
+		Joins("JOIN songs ON songs.id = song_likes.song_id AND songs.deleted_at IS NULL AND songs.status = 'visible'").
+		Where("song_likes.created_at >= ?", previous).
+		Group("song_likes.song_id").
+		Having(`SUM(CASE WHEN song_likes.created_at >= ? THEN song_likes.value ELSE -song_likes.value END) > 0`, since).
+		Order("score DESC").
+		Limit(limit).
+		Scan(&rows).Error
+	return rows, err
+}
+
+func (r *leaderboardRepository) Replace(ctx context.Context, board, period string, entries []db.LeaderboardEntry) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("board = ? AND period = ?", board, period).Delete(&db.LeaderboardEntry{}).Error; err != nil {
+			return err
+		}
+
+		if len(entries) == 0 {
+			return nil
+		}
+
+		return tx.Create(&entries).Error
+	})
+}
+
+func (r *leaderboardRepository) ListContributors(ctx context.Context, board, period string, limit int) ([]ContributorStanding, error) {
+	var standings []ContributorStanding
+	if err := r.db.WithContext(ctx).Model(&db.LeaderboardEntry{}).
+		Select(`leaderboard_entries.rank, leaderboard_entries.score, users.id AS user_id, users.display_name,
+			(SELECT COUNT(*) FROM edit_suggestions
+				WHERE edit_suggestions.author_id = users.id AND edit_suggestions.status = 'accepted') AS accepted_suggestions`).
+		Joins("JOIN users ON users.id = leaderboard_entries.subject_id").
+		Where("leaderboard_entries.board = ? AND leaderboard_entries.period = ?", board, period).
+		Order("leaderboard_entries.rank").
+		Limit(limit).
+		Scan(&standings).Error; err != nil {
+		return nil, err
+	}
+	return standings, nil
+}
+
+func (r *leaderboardRepository) ListSongs(ctx context.Context, board, period string, limit int) ([]SongStanding, error) {
+	var standings []SongStanding
+	if err := r.db.WithContext(ctx).Model(&db.LeaderboardEntry{}).
+		Select("leaderboard_entries.rank, leaderboard_entries.score, songs.id AS song_id, songs.title, songs.artist").
+		Joins("JOIN songs ON songs.id = leaderboard_entries.subject_id AND songs.deleted_at IS NULL AND songs.status = 'visible'").
+		Where("leaderboard_entries.board = ? AND leaderboard_entries.period = ?", board, period).
+		Order("leaderboard_entries.rank").
+		Limit(limit).
+		Scan(&standings).Error; err != nil {
+		return nil, err
+	}
+	return standings, nil
+}
+
+func (r *leaderboardRepository) RefreshedAt(ctx context.Context, board, period string) (*time.Time, error) {
+	var entry db.LeaderboardEntry
+	if err := r.db.WithContext(ctx).Where("board = ? AND period = ?", board, period).First(&entry).Error; err != nil {
+		if err := notFound(err); err != ErrNotFound {
+			return nil, err
+		}
+		return nil, nil
+	}
+	return &entry.RefreshedAt, nil
+}
@@ -0,0 +1,50 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/supercakecrumb/chordik/internal/db"
+)
+
+func TestScoreRisingSongs(t *testing.T) {
+	st := newTestStore(t)
+	owner := createUser(t, st, "ana")
+	voters := []*db.User{createUser(t, st, "v1"), createUser(t, st, "v2"), createUser(t, st, "v3")}
+	rising := createSong(t, st, owner, "Rising")
+	falling := createSong(t, st, owner, "Falling")
+	old := createSong(t, st, owner, "Old")
+
+	now := time.Now()
+	since, previous := now.AddDate(0, 0, -7), now.AddDate(0, 0, -14)
+	votes := []struct {
+		song  *db.Song
+		voter *db.User
+		value int16
+		at    time.Time
+	}{
+		// Two likes this week against a dislike the week before: +3
+		{rising, voters[0], 1, now},
+		{rising, voters[1], 1, now},
+		{rising, voters[2], -1, now.AddDate(0, 0, -10)},
+		// One like this week against two the week before: -1
+		{falling, voters[0], 1, now},
+		{falling, voters[1], 1, now.AddDate(0, 0, -10)},
+		{falling, voters[2], 1, now.AddDate(0, 0, -10)},
+		// Votes from before the previous week don't count
+		{old, voters[0], 1, now.AddDate(0, 0, -30)},
+	}
+	for _, v := range votes {
+		if err := st.Votes().Create(ctx, &db.SongLike{SongID: v.song.ID, UserID: v.voter.ID, Value: v.value, CreatedAt: v.at}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scores, err := st.Leaderboards().ScoreRisingSongs(ctx, since, previous, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(scores) != 1 || scores[0].SubjectID != rising.ID || scores[0].Score != 3 {
+		t.Errorf("got %+v, want only the rising song with a score of 3", scores)
+	}
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"gorm.io/gorm"
+)
+
+type reportRepository struct {
+	db *gorm.DB
+}
+
+func (r *reportRepository) Create(ctx context.Context, report *db.Report) error {
+	return r.db.WithContext(ctx).Create(report).Error
+}
+
+func (r *reportRepository) Get(ctx context.Context, id uuid.UUID) (*db.Report, error) {
+	var report db.Report
+	if err := r.db.WithContext(ctx).First(&report, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &report, nil
+}
+
+func (r *reportRepository) HasOpen(ctx context.Context, songID, reporterID uuid.UUID) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&db.Report{}).
+		Where("song_id = ? AND reporter_id = ? AND status = ?", songID, reporterID, "open").
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func (r *reportRepository) List(ctx context.Context, status string, offset, limit int) ([]db.Report, int64, error) {
+	var reports []db.Report
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&db.Report{}).
+		Preload("Song").
+		Preload("Reporter").
+		Order("created_at ASC")
+
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	if err := query.Offset(offset).Limit(limit).Find(&reports).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return reports, total, nil
+}
+
+func (r *reportRepository) Update(ctx context.Context, id uuid.UUID, fields map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(&db.Report{}).Where("id = ?", id).Updates(fields).Error
+}
+
+func (r *reportRepository) UpdateOpenBySong(ctx context.Context, songID uuid.UUID, fields map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(&db.Report{}).
+		Where("song_id = ? AND status = ?", songID, "open").
+		Updates(fields).Error
+}
+
+func (r *reportRepository) CreateWarning(ctx context.Context, warning *db.UserWarning) error {
+	return r.db.WithContext(ctx).Create(warning).Error
+}
@@ -0,0 +1,89 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"gorm.io/gorm"
+)
+
+type sessionRepository struct {
+	db *gorm.DB
+}
+
+func (r *sessionRepository) Create(ctx context.Context, session *db.Session) error {
+	return r.db.WithContext(ctx).Create(session).Error
+}
+
+func (r *sessionRepository) GetActive(ctx context.Context, tokenHash string, now time.Time) (*db.Session, error) {
+	var session db.Session
+	if err := r.db.WithContext(ctx).Preload("User").
+		Where("token_hash = ? AND expires_at > ?", tokenHash, now).
+		First(&session).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &session, nil
+}
+
+func (r *sessionRepository) CSRFToken(ctx context.Context, tokenHash string, now time.Time) (string, error) {
+	var session db.Session
+	if err := r.db.WithContext(ctx).Select("csrf_token").
+		Where("token_hash = ? AND expires_at > ?", tokenHash, now).
+		First(&session).Error; err != nil {
+		return "", notFound(err)
+	}
+	return session.CSRFToken, nil
+}
+
+func (r *sessionRepository) Touch(ctx context.Context, id uuid.UUID, lastSeenAt, expiresAt time.Time) error {
+	return r.db.WithContext(ctx).Model(&db.Session{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"last_seen_at": lastSeenAt,
+		"expires_at":   expiresAt,
+	}).Error
+}
+
+func (r *sessionRepository) ListActive(ctx context.Context, userID uuid.UUID, now time.Time) ([]db.Session, error) {
+	var sessions []db.Session
+	if err := r.db.WithContext(ctx).Where("user_id = ? AND token_hash IS NOT NULL AND expires_at > ?", userID, now).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error; err != nil {
+		return nil, err
+	}
+	return sessions, nil
+}
+
+func (r *sessionRepository) DeleteByTokenHash(ctx context.Context, tokenHash string) error {
+	return r.db.WithContext(ctx).Where("token_hash = ?", tokenHash).Delete(&db.Session{}).Error
+}
+
+func (r *sessionRepository) Delete(ctx context.Context, userID, id uuid.UUID) (bool, error) {
+	result := r.db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&db.Session{})
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *sessionRepository) DeleteForUser(ctx context.Context, userID uuid.UUID, except *uuid.UUID) error {
+	query := r.db.WithContext(ctx).Where("user_id = ?", userID)
+	if except != nil {
+		query = query.Where("id <> ?", *except)
+	}
+	return query.Delete(&db.Session{}).Error
+}
+
+func (r *sessionRepository) CountActive(ctx context.Context, now time.Time) (int64, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&db.Session{}).
+		Where("token_hash IS NOT NULL AND expires_at > ?", now).
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// DeleteExpired also removes sessions from before tokens were hashed
+func (r *sessionRepository) DeleteExpired(ctx context.Context, now time.Time) error {
+	return r.db.WithContext(ctx).
+		Where("expires_at <= ? OR token_hash IS NULL", now).
+		Delete(&db.Session{}).Error
+}
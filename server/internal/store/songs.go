@@ -0,0 +1,170 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"gorm.io/gorm"
+)
+
+type songRepository struct {
+	db *gorm.DB
+}
+
+func (r *songRepository) Create(ctx context.Context, song *db.Song) error {
+	return r.db.WithContext(ctx).Create(song).Error
+}
+
+func (r *songRepository) Get(ctx context.Context, id uuid.UUID) (*db.Song, error) {
+	var song db.Song
+	if err := r.db.WithContext(ctx).First(&song, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &song, nil
+}
+
+func (r *songRepository) GetWithCreator(ctx context.Context, id uuid.UUID) (*db.Song, error) {
+	var song db.Song
+	if err := r.db.WithContext(ctx).Preload("CreatedBy").First(&song, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &song, nil
+}
+
+func (r *songRepository) GetAny(ctx context.Context, id uuid.UUID) (*db.Song, error) {
+	var song db.Song
+	if err := r.db.WithContext(ctx).Unscoped().First(&song, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &song, nil
+}
+
+func (r *songRepository) GetTrashed(ctx context.Context, id uuid.UUID) (*db.Song, error) {
+	var song db.Song
+	if err := r.db.WithContext(ctx).Unscoped().
+		Where("deleted_at IS NOT NULL").
+		First(&song, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &song, nil
+}
+
+func (r *songRepository) Update(ctx context.Context, song *db.Song, fields map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(song).Updates(fields).Error
+}
+
+func (r *songRepository) SetStatus(ctx context.Context, id uuid.UUID, status string) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&db.Song{}).Where("id = ?", id).Update("status", status)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *songRepository) Trash(ctx context.Context, song *db.Song) error {
+	return r.db.WithContext(ctx).Delete(song).Error
+}
+
+func (r *songRepository) Restore(ctx context.Context, song *db.Song) error {
+	return r.db.WithContext(ctx).Unscoped().Model(song).Update("deleted_at", nil).Error
+}
+
+// Purge removes the song's votes, comments, suggestions and leaderboard
+// entries with it. Reports are kept as a moderation record but detached
+// from the song.
+func (r *songRepository) Purge(ctx context.Context, song *db.Song) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		dependents := []interface{}{
+			&db.SongLike{},
+			&db.Comment{},
+			&db.EditSuggestion{},
+		}
+		for _, model := range dependents {
+			if err := tx.Where("song_id = ?", song.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("subject_id = ?", song.ID).Delete(&db.LeaderboardEntry{}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&db.Report{}).Where("song_id = ?", song.ID).Update("song_id", nil).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(song).Error
+	})
+}
+
+func (r *songRepository) List(ctx context.Context, status string, offset, limit int, search string) ([]db.Song, int64, error) {
+	var songs []db.Song
+	var total int64
+
+	query := r.db.WithContext(ctx).Model(&db.Song{}).Preload("CreatedBy").
+		Where("status = ?", status).
+		Order("created_at DESC")
+
+	if search != "" {
+		pattern := "%" + search + "%"
+		query = query.Where("("+containsFold(r.db, "title")+" OR "+containsFold(r.db, "artist")+")", pattern, pattern)
+	}
+
+	// Get total count
+	if err := query.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+
+	// Get paginated results
+	if err := query.Offset(offset).Limit(limit).Find(&songs).Error; err != nil {
+		return nil, 0, err
+	}
+
+	return songs, total, nil
+}
+
+func (r *songRepository) ListTrash(ctx context.Context, userID uuid.UUID) ([]db.Song, error) {
+	var songs []db.Song
+	if err := r.db.WithContext(ctx).Unscoped().
+		Where("created_by_id = ? AND deleted_at IS NOT NULL", userID).
+		Order("deleted_at DESC").
+		Find(&songs).Error; err != nil {
+		return nil, err
+	}
+	return songs, nil
+}
+
+func (r *songRepository) ListTrashedBefore(ctx context.Context, before time.Time) ([]db.Song, error) {
+	var songs []db.Song
+	if err := r.db.WithContext(ctx).Unscoped().
+		Where("deleted_at IS NOT NULL AND deleted_at < ?", before).
+		Find(&songs).Error; err != nil {
+		return nil, err
+	}
+	return songs, nil
+}
+
+func (r *songRepository) ListByCreator(ctx context.Context, userID uuid.UUID) ([]db.Song, error) {
+	var songs []db.Song
+	if err := r.db.WithContext(ctx).Unscoped().Where("created_by_id = ?", userID).Find(&songs).Error; err != nil {
+		return nil, err
+	}
+	return songs, nil
+}
+
+func (r *songRepository) CountByCreator(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&db.Song{}).Where("created_by_id = ?", userID).Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *songRepository) CountAcceptedSuggestions(ctx context.Context, authorID uuid.UUID) (int64, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&db.EditSuggestion{}).
+		Where("author_id = ? AND status = ?", authorID, "accepted").
+		Count(&count).Error; err != nil {
+		return 0, err
+	}
+	return count, nil
+}
@@ -0,0 +1,29 @@
+package store
+
+import "testing"
+
+func TestListSearchIgnoresCase(t *testing.T) {
+	st := newTestStore(t)
+	owner := createUser(t, st, "ana")
+	createSong(t, st, owner, "Hello Again")
+	createSong(t, st, owner, "Goodbye")
+
+	tests := []struct {
+		search string
+		want   int64
+	}{
+		{search: "hello", want: 1},
+		{search: "AGAIN", want: 1},
+		{search: "ARTIST", want: 2}, // matches the artist as well
+		{search: "nowhere", want: 0},
+	}
+	for _, tt := range tests {
+		songs, total, err := st.Songs().List(ctx, "visible", 0, 10, tt.search)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != tt.want || int64(len(songs)) != tt.want {
+			t.Errorf("search %q: got %d of %d songs, want %d", tt.search, len(songs), total, tt.want)
+		}
+	}
+}
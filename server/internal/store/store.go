@@ -0,0 +1,320 @@
+// Package store holds the repositories the services read and write
+// through, so they don't depend on a particular database. The repositories
+// are backed by GORM and work on both Postgres and SQLite; the few queries
+// that differ between the two check the dialect.
+package store
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"gorm.io/gorm"
+)
+
+var (
+	ErrNotFound = errors.New("record not found")
+)
+
+// Store gives access to every repository of one database, or of one
+// transaction on it
+type Store interface {
+	Users() UserRepository
+	Sessions() SessionRepository
+	Songs() SongRepository
+	Votes() VoteRepository
+	Badges() BadgeRepository
+	Comments() CommentRepository
+	Suggestions() SuggestionRepository
+	Reports() ReportRepository
+	Leaderboards() LeaderboardRepository
+	APITokens() APITokenRepository
+	UserTokens() UserTokenRepository
+	Identities() IdentityRepository
+	RecoveryCodes() RecoveryCodeRepository
+
+	// Transaction runs fn with a store whose repositories share one
+	// transaction, which is committed if fn returns nil
+	Transaction(ctx context.Context, fn func(tx Store) error) error
+}
+
+type UserRepository interface {
+	Get(ctx context.Context, id uuid.UUID) (*db.User, error)
+	GetByEmail(ctx context.Context, email string) (*db.User, error)
+	Create(ctx context.Context, user *db.User) error
+	// Update sets columns of a user
+	Update(ctx context.Context, id uuid.UUID, fields map[string]interface{}) error
+	// ReplacePasswordHash swaps a user's password hash for a new one,
+	// unless it changed in the meantime
+	ReplacePasswordHash(ctx context.Context, id uuid.UUID, oldHash, newHash string) error
+	// AdvanceTOTPCounter records the last accepted TOTP time step. It
+	// reports false when the step is not newer than the recorded one.
+	AdvanceTOTPCounter(ctx context.Context, id uuid.UUID, counter int64) (bool, error)
+	DisplayNameTaken(ctx context.Context, displayName string) (bool, error)
+	// Purge permanently deletes a user and everything they own, except
+	// their comments, which stay as deleted placeholders without an
+	// author. Their songs have to be purged first.
+	Purge(ctx context.Context, id uuid.UUID) error
+}
+
+type SessionRepository interface {
+	Create(ctx context.Context, session *db.Session) error
+	// GetActive finds an unexpired session by token hash, with its user
+	GetActive(ctx context.Context, tokenHash string, now time.Time) (*db.Session, error)
+	// CSRFToken returns the CSRF token of an unexpired session by token hash
+	CSRFToken(ctx context.Context, tokenHash string, now time.Time) (string, error)
+	Touch(ctx context.Context, id uuid.UUID, lastSeenAt, expiresAt time.Time) error
+	ListActive(ctx context.Context, userID uuid.UUID, now time.Time) ([]db.Session, error)
+	DeleteByTokenHash(ctx context.Context, tokenHash string) error
+	// Delete ends one session of a user and reports whether it existed
+	Delete(ctx context.Context, userID, id uuid.UUID) (bool, error)
+	// DeleteForUser ends every session of a user, except one if given
+	DeleteForUser(ctx context.Context, userID uuid.UUID, except *uuid.UUID) error
+	DeleteExpired(ctx context.Context, now time.Time) error
+	// CountActive counts the unexpired sessions of every user
+	CountActive(ctx context.Context, now time.Time) (int64, error)
+}
+
+type SongRepository interface {
+	Create(ctx context.Context, song *db.Song) error
+	// Get finds a song outside the trash
+	Get(ctx context.Context, id uuid.UUID) (*db.Song, error)
+	// GetWithCreator finds a song outside the trash, with its creator
+	GetWithCreator(ctx context.Context, id uuid.UUID) (*db.Song, error)
+	// GetAny finds a song whether or not it is in the trash
+	GetAny(ctx context.Context, id uuid.UUID) (*db.Song, error)
+	// GetTrashed finds a song in the trash
+	GetTrashed(ctx context.Context, id uuid.UUID) (*db.Song, error)
+	Update(ctx context.Context, song *db.Song, fields map[string]interface{}) error
+	// SetStatus changes a song's visibility and reports whether it exists
+	SetStatus(ctx context.Context, id uuid.UUID, status string) (bool, error)
+	Trash(ctx context.Context, song *db.Song) error
+	Restore(ctx context.Context, song *db.Song) error
+	// Purge permanently deletes a song and everything attached to it
+	Purge(ctx context.Context, song *db.Song) error
+	// List pages through the songs with the given status, newest
+	// first, optionally matching a case-insensitive search on title or artist
+	List(ctx context.Context, status string, offset, limit int, search string) ([]db.Song, int64, error)
+	ListTrash(ctx context.Context, userID uuid.UUID) ([]db.Song, error)
+	ListTrashedBefore(ctx context.Context, before time.Time) ([]db.Song, error)
+	// ListByCreator returns every song of a user, including the trashed ones
+	ListByCreator(ctx context.Context, userID uuid.UUID) ([]db.Song, error)
+	// CountByCreator counts the songs of a user outside the trash
+	CountByCreator(ctx context.Context, userID uuid.UUID) (int64, error)
+	// CountAcceptedSuggestions counts the edit suggestions by a user that
+	// song owners accepted
+	CountAcceptedSuggestions(ctx context.Context, authorID uuid.UUID) (int64, error)
+}
+
+type VoteRepository interface {
+	Get(ctx context.Context, songID, userID uuid.UUID) (*db.SongLike, error)
+	Create(ctx context.Context, vote *db.SongLike) error
+	SetValue(ctx context.Context, vote *db.SongLike, value int16) error
+	Delete(ctx context.Context, vote *db.SongLike) error
+	// Score sums the votes of a song
+	Score(ctx context.Context, songID uuid.UUID) (int64, error)
+	// BestScoreByCreator returns the highest score among a user's songs
+	// outside the trash
+	BestScoreByCreator(ctx context.Context, userID uuid.UUID) (int64, error)
+	// VotedCreators returns the other users whose songs a user voted on
+	VotedCreators(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error)
+}
+
+// BadgeHistory is a single award or revocation with its badge
+type BadgeHistory struct {
+	Code      string
+	Name      string
+	Action    string
+	CreatedAt time.Time
+}
+
+type BadgeRepository interface {
+	// Upsert creates a badge by code or updates its definition
+	Upsert(ctx context.Context, badge *db.Badge) error
+	GetByCode(ctx context.Context, code string) (*db.Badge, error)
+	ListAwards(ctx context.Context, userID uuid.UUID) ([]db.UserBadge, error)
+	HasAward(ctx context.Context, userID, badgeID uuid.UUID) (bool, error)
+	CreateAward(ctx context.Context, award *db.UserBadge) error
+	// DeleteAward takes a badge away and reports whether the user had it
+	DeleteAward(ctx context.Context, userID, badgeID uuid.UUID) (bool, error)
+	CreateEvent(ctx context.Context, event *db.BadgeEvent) error
+	// History returns a user's badge events, newest first
+	History(ctx context.Context, userID uuid.UUID) ([]BadgeHistory, error)
+}
+
+type CommentRepository interface {
+	Create(ctx context.Context, comment *db.Comment) error
+	Get(ctx context.Context, id uuid.UUID) (*db.Comment, error)
+	// ListBySong returns the comments on a song outside suggestion
+	// discussions, oldest first, with their authors
+	ListBySong(ctx context.Context, songID uuid.UUID) ([]db.Comment, error)
+	// ListBySuggestion returns the discussion of a suggestion, oldest
+	// first, with the authors
+	ListBySuggestion(ctx context.Context, suggestionID uuid.UUID) ([]db.Comment, error)
+	Update(ctx context.Context, comment *db.Comment, fields map[string]interface{}) error
+}
+
+type SuggestionRepository interface {
+	Create(ctx context.Context, suggestion *db.EditSuggestion) error
+	// Get finds a suggestion with its author
+	Get(ctx context.Context, id uuid.UUID) (*db.EditSuggestion, error)
+	// ListBySong returns the suggestions for a song, newest first, with
+	// their authors. An empty status lists all of them.
+	ListBySong(ctx context.Context, songID uuid.UUID, status string) ([]db.EditSuggestion, error)
+	// Review updates a suggestion that is still pending and reports
+	// whether it was. Of two concurrent reviews only one succeeds.
+	Review(ctx context.Context, id uuid.UUID, fields map[string]interface{}) (bool, error)
+}
+
+type ReportRepository interface {
+	Create(ctx context.Context, report *db.Report) error
+	Get(ctx context.Context, id uuid.UUID) (*db.Report, error)
+	// HasOpen reports whether a user has an open report against a song
+	HasOpen(ctx context.Context, songID, reporterID uuid.UUID) (bool, error)
+	// List pages through the reports with the given status, or all of
+	// them, oldest first, with their songs and reporters
+	List(ctx context.Context, status string, offset, limit int) ([]db.Report, int64, error)
+	Update(ctx context.Context, id uuid.UUID, fields map[string]interface{}) error
+	// UpdateOpenBySong updates every open report against a song
+	UpdateOpenBySong(ctx context.Context, songID uuid.UUID, fields map[string]interface{}) error
+	CreateWarning(ctx context.Context, warning *db.UserWarning) error
+}
+
+// Score is the net votes of a user or song
+type Score struct {
+	SubjectID uuid.UUID
+	Score     int64
+}
+
+// ContributorStanding is a ranked user on a leaderboard
+type ContributorStanding struct {
+	Rank                int
+	Score               int64
+	UserID              uuid.UUID
+	DisplayName         string
+	AcceptedSuggestions int64
+}
+
+// SongStanding is a ranked song on a leaderboard
+type SongStanding struct {
+	Rank   int
+	Score  int64
+	SongID uuid.UUID
+	Title  string
+	Artist string
+}
+
+type LeaderboardRepository interface {
+	// ScoreCreators sums the votes cast since a time on each user's
+	// visible songs, highest first
+	ScoreCreators(ctx context.Context, since time.Time, limit int) ([]Score, error)
+	// ScoreSongs sums the votes cast since a time on each visible song,
+	// highest first
+	ScoreSongs(ctx context.Context, since time.Time, limit int) ([]Score, error)
+	// ScoreRisingSongs ranks visible songs by how many more net votes they got
+	// since a time than in the period from previous up to it
+	ScoreRisingSongs(ctx context.Context, since, previous time.Time, limit int) ([]Score, error)
+	// Replace swaps the entries of a board and period in one transaction
+	Replace(ctx context.Context, board, period string, entries []db.LeaderboardEntry) error
+	ListContributors(ctx context.Context, board, period string, limit int) ([]ContributorStanding, error)
+	// ListSongs skips songs that have been trashed or hidden since the
+	// refresh
+	ListSongs(ctx context.Context, board, period string, limit int) ([]SongStanding, error)
+	// RefreshedAt returns when a board was last refreshed, or nil if never
+	RefreshedAt(ctx context.Context, board, period string) (*time.Time, error)
+}
+
+type APITokenRepository interface {
+	Create(ctx context.Context, token *db.APIToken) error
+	// ListByUser returns a user's tokens, newest first
+	ListByUser(ctx context.Context, userID uuid.UUID) ([]db.APIToken, error)
+	// GetActive finds an unexpired token by hash, with its user
+	GetActive(ctx context.Context, tokenHash string, now time.Time) (*db.APIToken, error)
+	Touch(ctx context.Context, id uuid.UUID, lastUsedAt time.Time) error
+	// Delete revokes one token of a user and reports whether it existed
+	Delete(ctx context.Context, userID, id uuid.UUID) (bool, error)
+	DeleteForUser(ctx context.Context, userID uuid.UUID) error
+	DeleteExpired(ctx context.Context, now time.Time) error
+}
+
+// UserTokenRepository keeps the single-use tokens sent by email or handed
+// out between login steps
+type UserTokenRepository interface {
+	Create(ctx context.Context, token *db.UserToken) error
+	// GetUnused finds an unused, unexpired token by hash and purpose
+	GetUnused(ctx context.Context, tokenHash, purpose string, now time.Time) (*db.UserToken, error)
+	// GetByHash finds a token by hash and purpose, used or not
+	GetByHash(ctx context.Context, tokenHash, purpose string) (*db.UserToken, error)
+	// Use marks an unused, unexpired token used and reports whether it was
+	Use(ctx context.Context, id uuid.UUID, now time.Time) (bool, error)
+	// UseAll marks a user's unused tokens for a purpose used
+	UseAll(ctx context.Context, userID uuid.UUID, purpose string, now time.Time) error
+	// CountSince counts the tokens issued to a user for a purpose since a
+	// time, used or not
+	CountSince(ctx context.Context, userID uuid.UUID, purpose string, since time.Time) (int64, error)
+	DeleteForUser(ctx context.Context, userID uuid.UUID) error
+}
+
+// IdentityRepository links users to their OpenID Connect identities
+type IdentityRepository interface {
+	Get(ctx context.Context, issuer, subject string) (*db.UserIdentity, error)
+	Create(ctx context.Context, identity *db.UserIdentity) error
+	DeleteForUser(ctx context.Context, userID uuid.UUID) error
+}
+
+type RecoveryCodeRepository interface {
+	// Replace deletes a user's recovery codes and stores new ones
+	Replace(ctx context.Context, userID uuid.UUID, codes []db.RecoveryCode) error
+	// Use marks an unused code of a user used and reports whether it was
+	Use(ctx context.Context, userID uuid.UUID, codeHash string, now time.Time) (bool, error)
+	DeleteForUser(ctx context.Context, userID uuid.UUID) error
+}
+
+type gormStore struct {
+	db *gorm.DB
+}
+
+// New returns a store backed by a GORM connection or transaction
+func New(db *gorm.DB) Store {
+	return &gormStore{db: db}
+}
+
+func (s *gormStore) Users() UserRepository                 { return &userRepository{db: s.db} }
+func (s *gormStore) Sessions() SessionRepository           { return &sessionRepository{db: s.db} }
+func (s *gormStore) Songs() SongRepository                 { return &songRepository{db: s.db} }
+func (s *gormStore) Votes() VoteRepository                 { return &voteRepository{db: s.db} }
+func (s *gormStore) Badges() BadgeRepository               { return &badgeRepository{db: s.db} }
+func (s *gormStore) Comments() CommentRepository           { return &commentRepository{db: s.db} }
+func (s *gormStore) Suggestions() SuggestionRepository     { return &suggestionRepository{db: s.db} }
+func (s *gormStore) Reports() ReportRepository             { return &reportRepository{db: s.db} }
+func (s *gormStore) Leaderboards() LeaderboardRepository   { return &leaderboardRepository{db: s.db} }
+func (s *gormStore) APITokens() APITokenRepository         { return &apiTokenRepository{db: s.db} }
+func (s *gormStore) UserTokens() UserTokenRepository       { return &userTokenRepository{db: s.db} }
+func (s *gormStore) Identities() IdentityRepository        { return &identityRepository{db: s.db} }
+func (s *gormStore) RecoveryCodes() RecoveryCodeRepository { return &recoveryCodeRepository{db: s.db} }
+
+func (s *gormStore) Transaction(ctx context.Context, fn func(tx Store) error) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		return fn(&gormStore{db: tx})
+	})
+}
+
+// notFound turns GORM's missing record error into ErrNotFound
+func notFound(err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return ErrNotFound
+	}
+	return err
+}
+
+// containsFold builds a case-insensitive substring match on a column.
+// SQLite's LIKE already ignores case, though only for ASCII letters;
+// Postgres needs ILIKE.
+func containsFold(conn *gorm.DB, column string) string {
+	if conn.Dialector.Name() == db.DriverPostgres {
+		return column + " ILIKE ?"
+	}
+	return column + " LIKE ?"
+}
@@ -0,0 +1,66 @@
+package store
+
+import (
+	"context"
+	"testing"
+
+	"github.com/glebarez/sqlite"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+var ctx = context.Background()
+
+// newTestStore returns a store on a fresh in-memory SQLite database
+func newTestStore(t *testing.T) Store {
+	t.Helper()
+
+	conn, err := db.NewSQLiteConnection(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if err := db.Migrate(conn.DB); err != nil {
+		t.Fatal(err)
+	}
+	return New(conn.DB)
+}
+
+func createUser(t *testing.T, st Store, name string) *db.User {
+	t.Helper()
+
+	user := db.User{Email: name + "@example.com", PasswordHash: "x", DisplayName: name, Role: "user"}
+	if err := st.Users().Create(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+func createSong(t *testing.T, st Store, owner *db.User, title string) *db.Song {
+	t.Helper()
+
+	song := db.Song{Title: title, Artist: "Artist", BodyChordPro: "[C]la", Status: "visible", CreatedByID: owner.ID}
+	if err := st.Songs().Create(ctx, &song); err != nil {
+		t.Fatal(err)
+	}
+	return &song
+}
+
+func TestContainsFold(t *testing.T) {
+	tests := []struct {
+		name      string
+		dialector gorm.Dialector
+		want      string
+	}{
+		{name: "postgres", dialector: postgres.New(postgres.Config{}), want: "title ILIKE ?"},
+		{name: "sqlite", dialector: sqlite.Open(":memory:"), want: "title LIKE ?"},
+	}
+	for _, tt := range tests {
+		conn := &gorm.DB{Config: &gorm.Config{Dialector: tt.dialector}}
+		if got := containsFold(conn, "title"); got != tt.want {
+			t.Errorf("%s: got %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
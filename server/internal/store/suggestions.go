@@ -0,0 +1,47 @@
+package store
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"gorm.io/gorm"
+)
+
+type suggestionRepository struct {
+	db *gorm.DB
+}
+
+func (r *suggestionRepository) Create(ctx context.Context, suggestion *db.EditSuggestion) error {
+	return r.db.WithContext(ctx).Create(suggestion).Error
+}
+
+func (r *suggestionRepository) Get(ctx context.Context, id uuid.UUID) (*db.EditSuggestion, error) {
+	var suggestion db.EditSuggestion
+	if err := r.db.WithContext(ctx).Preload("Author").First(&suggestion, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &suggestion, nil
+}
+
+func (r *suggestionRepository) ListBySong(ctx context.Context, songID uuid.UUID, status string) ([]db.EditSuggestion, error) {
+	query := r.db.WithContext(ctx).Preload("Author").Where("song_id = ?", songID).Order("created_at DESC")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var suggestions []db.EditSuggestion
+	if err := query.Find(&suggestions).Error; err != nil {
+		return nil, err
+	}
+	return suggestions, nil
+}
+
+// Review checks the status in the update itself, so it holds up without
+// locking the row first
+func (r *suggestionRepository) Review(ctx context.Context, id uuid.UUID, fields map[string]interface{}) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&db.EditSuggestion{}).
+		Where("id = ? AND status = ?", id, "pending").
+		Updates(fields)
+	return result.RowsAffected > 0, result.Error
+}
@@ -0,0 +1,39 @@
+package store
+
+import (
+	"testing"
+	"time"
+
+	"github.com/supercakecrumb/chordik/internal/db"
+)
+
+// TestReviewOnlyOnce checks that a suggestion can't be reviewed again once
+// it left the pending status, e.g. by two owners racing
+func TestReviewOnlyOnce(t *testing.T) {
+	st := newTestStore(t)
+	owner := createUser(t, st, "ana")
+	author := createUser(t, st, "bob")
+	song := createSong(t, st, owner, "Song")
+
+	suggestion := db.EditSuggestion{SongID: song.ID, AuthorID: author.ID, Title: "Song", Artist: "Artist", BodyChordPro: "[G]la"}
+	if err := st.Suggestions().Create(ctx, &suggestion); err != nil {
+		t.Fatal(err)
+	}
+
+	reviewed, err := st.Suggestions().Review(ctx, suggestion.ID, map[string]interface{}{"status": "accepted", "reviewed_at": time.Now()})
+	if err != nil || !reviewed {
+		t.Fatalf("first review = %v, %v; want true", reviewed, err)
+	}
+	reviewed, err = st.Suggestions().Review(ctx, suggestion.ID, map[string]interface{}{"status": "rejected", "reject_reason": "late"})
+	if err != nil || reviewed {
+		t.Fatalf("second review = %v, %v; want false", reviewed, err)
+	}
+
+	got, err := st.Suggestions().Get(ctx, suggestion.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != "accepted" || got.RejectReason != "" {
+		t.Errorf("got status %q with reason %q, want the first review kept", got.Status, got.RejectReason)
+	}
+}
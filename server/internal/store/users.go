@@ -0,0 +1,105 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"gorm.io/gorm"
+)
+
+type userRepository struct {
+	db *gorm.DB
+}
+
+func (r *userRepository) Get(ctx context.Context, id uuid.UUID) (*db.User, error) {
+	var user db.User
+	if err := r.db.WithContext(ctx).First(&user, "id = ?", id).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *userRepository) GetByEmail(ctx context.Context, email string) (*db.User, error) {
+	var user db.User
+	if err := r.db.WithContext(ctx).Where("email = ?", email).First(&user).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &user, nil
+}
+
+func (r *userRepository) Create(ctx context.Context, user *db.User) error {
+	return r.db.WithContext(ctx).Create(user).Error
+}
+
+func (r *userRepository) Update(ctx context.Context, id uuid.UUID, fields map[string]interface{}) error {
+	return r.db.WithContext(ctx).Model(&db.User{}).Where("id = ?", id).Updates(fields).Error
+}
+
+func (r *userRepository) ReplacePasswordHash(ctx context.Context, id uuid.UUID, oldHash, newHash string) error {
+	return r.db.WithContext(ctx).Model(&db.User{}).
+		Where("id = ? AND password_hash = ?", id, oldHash).
+		Update("password_hash", newHash).Error
+}
+
+func (r *userRepository) AdvanceTOTPCounter(ctx context.Context, id uuid.UUID, counter int64) (bool, error) {
+	result := r.db.WithContext(ctx).Model(&db.User{}).
+		Where("id = ? AND totp_last_counter < ?", id, counter).
+		Update("totp_last_counter", counter)
+	return result.RowsAffected > 0, result.Error
+}
+
+func (r *userRepository) DisplayNameTaken(ctx context.Context, displayName string) (bool, error) {
+	var count int64
+	if err := r.db.WithContext(ctx).Model(&db.User{}).Where("display_name = ?", displayName).Count(&count).Error; err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// Purge removes the user's votes, badges, suggestions, the reports they
+// filed and their credentials with them. Their comments become deleted
+// placeholders without an author, so replies keep their parent, and
+// reports they resolved are kept but no longer name them.
+func (r *userRepository) Purge(ctx context.Context, id uuid.UUID) error {
+	return r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		owned := []struct {
+			column string
+			model  interface{}
+		}{
+			{"user_id", &db.SongLike{}},
+			{"user_id", &db.UserBadge{}},
+			{"user_id", &db.BadgeEvent{}},
+			{"user_id", &db.UserWarning{}},
+			{"user_id", &db.UserToken{}},
+			{"user_id", &db.Session{}},
+			{"user_id", &db.UserIdentity{}},
+			{"user_id", &db.APIToken{}},
+			{"user_id", &db.RecoveryCode{}},
+			{"author_id", &db.EditSuggestion{}},
+			{"reporter_id", &db.Report{}}, // reports filed by the user, not about their songs
+			{"subject_id", &db.LeaderboardEntry{}},
+		}
+		for _, o := range owned {
+			if err := tx.Where(o.column+" = ?", id).Delete(o.model).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Model(&db.Comment{}).Where("user_id = ? AND deleted_at IS NULL", id).
+			Update("deleted_at", time.Now()).Error; err != nil {
+			return err
+		}
+		if err := tx.Model(&db.Comment{}).Where("user_id = ?", id).
+			Updates(map[string]interface{}{"user_id": nil, "body": ""}).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&db.Report{}).Where("resolved_by_id = ?", id).Update("resolved_by_id", nil).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(&db.User{}, "id = ?", id).Error
+	})
+}
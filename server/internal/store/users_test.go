@@ -0,0 +1,48 @@
+package store
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/supercakecrumb/chordik/internal/db"
+)
+
+func TestPurgeKeepsCommentThreads(t *testing.T) {
+	st := newTestStore(t)
+	owner := createUser(t, st, "ana")
+	purged := createUser(t, st, "bob")
+	song := createSong(t, st, owner, "Song")
+
+	parent := db.Comment{SongID: song.ID, UserID: &purged.ID, Body: "first"}
+	if err := st.Comments().Create(ctx, &parent); err != nil {
+		t.Fatal(err)
+	}
+	reply := db.Comment{SongID: song.ID, UserID: &owner.ID, ParentID: &parent.ID, Body: "reply"}
+	if err := st.Comments().Create(ctx, &reply); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := st.Users().Purge(ctx, purged.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := st.Users().Get(ctx, purged.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("the purged user: got %v, want %v", err, ErrNotFound)
+	}
+
+	got, err := st.Comments().Get(ctx, parent.ID)
+	if err != nil {
+		t.Fatalf("the purged user's comment is gone: %v", err)
+	}
+	if got.DeletedAt == nil || got.UserID != nil || got.Body != "" {
+		t.Errorf("the purged user's comment: got deleted_at %v, user %v, body %q, want a deleted placeholder", got.DeletedAt, got.UserID, got.Body)
+	}
+
+	comments, err := st.Comments().ListBySong(ctx, song.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(comments) != 2 {
+		t.Errorf("got %d comments on the song, want the placeholder and the reply", len(comments))
+	}
+}
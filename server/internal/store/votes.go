@@ -0,0 +1,71 @@
+package store
+
+import (
+	"context"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"gorm.io/gorm"
+)
+
+type voteRepository struct {
+	db *gorm.DB
+}
+
+func (r *voteRepository) Get(ctx context.Context, songID, userID uuid.UUID) (*db.SongLike, error) {
+	var vote db.SongLike
+	if err := r.db.WithContext(ctx).Where("song_id = ? AND user_id = ?", songID, userID).First(&vote).Error; err != nil {
+		return nil, notFound(err)
+	}
+	return &vote, nil
+}
+
+func (r *voteRepository) Create(ctx context.Context, vote *db.SongLike) error {
+	return r.db.WithContext(ctx).Create(vote).Error
+}
+
+func (r *voteRepository) SetValue(ctx context.Context, vote *db.SongLike, value int16) error {
+	vote.Value = value
+	return r.db.WithContext(ctx).Save(vote).Error
+}
+
+func (r *voteRepository) Delete(ctx context.Context, vote *db.SongLike) error {
+	return r.db.WithContext(ctx).Delete(vote).Error
+}
+
+func (r *voteRepository) Score(ctx context.Context, songID uuid.UUID) (int64, error) {
+	var score int64
+	if err := r.db.WithContext(ctx).Model(&db.SongLike{}).
+		Select("COALESCE(SUM(value), 0)").
+		Where("song_id = ?", songID).
+		Scan(&score).Error; err != nil {
+		return 0, err
+	}
+	return score, nil
+}
+
+func (r *voteRepository) BestScoreByCreator(ctx context.Context, userID uuid.UUID) (int64, error) {
+	var score int64
+	if err := r.db.WithContext(ctx).Table("(?) AS scores", r.db.WithContext(ctx).Model(&db.SongLike{}).
+		Select("SUM(song_likes.value) AS score").
+		Joins("JOIN songs ON songs.id = song_likes.song_id AND songs.deleted_at IS NULL").
+		Where("songs.created_by_id = ?", userID).
+		Group("song_likes.song_id")).
+		Select("COALESCE(MAX(score), 0)").
+		Scan(&score).Error; err != nil {
+		return 0, err
+	}
+	return score, nil
+}
+
+func (r *voteRepository) VotedCreators(ctx context.Context, userID uuid.UUID) ([]uuid.UUID, error) {
+	var creators []uuid.UUID
+	if err := r.db.WithContext(ctx).Model(&db.SongLike{}).
+		Distinct("songs.created_by_id").
+		Joins("JOIN songs ON songs.id = song_likes.song_id").
+		Where("song_likes.user_id = ? AND songs.created_by_id <> ?", userID, userID).
+		Pluck("songs.created_by_id", &creators).Error; err != nil {
+		return nil, err
+	}
+	return creators, nil
+}
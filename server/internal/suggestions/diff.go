@@ -0,0 +1,99 @@
+package suggestions
+
+import "strings"
+
+// Diff operations
+const (
+	OpEqual  = "equal"
+	OpAdd    = "add"
+	OpRemove = "remove"
+)
+
+// DiffLine is a single line of a line-based diff
+type DiffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// maxDiffCells bounds the LCS table of a diff. Bodies are limited to
+// 64 KiB, which can still be thousands of lines on each side; when the
+// changed lines don't fit, they are shown as removed and added as a whole.
+const maxDiffCells = 1 << 20
+
+// Diff computes a line-based diff between two texts using the longest
+// common subsequence of their lines
+func Diff(before, after string) []DiffLine {
+	a := strings.Split(before, "\n")
+	b := strings.Split(after, "\n")
+
+	// Lines shared at the start and the end need no table
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	diff := make([]DiffLine, 0, len(a)+len(b))
+	for _, line := range a[:prefix] {
+		diff = append(diff, DiffLine{Op: OpEqual, Text: line})
+	}
+	diff = diffLines(diff, a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])
+	for _, line := range a[len(a)-suffix:] {
+		diff = append(diff, DiffLine{Op: OpEqual, Text: line})
+	}
+
+	return diff
+}
+
+// diffLines appends the diff of two runs of lines to diff
+func diffLines(diff []DiffLine, a, b []string) []DiffLine {
+	if len(a)*len(b) > maxDiffCells {
+		for _, line := range a {
+			diff = append(diff, DiffLine{Op: OpRemove, Text: line})
+		}
+		for _, line := range b {
+			diff = append(diff, DiffLine{Op: OpAdd, Text: line})
+		}
+		return diff
+	}
+
+	// lcs[i*width+j] is the length of the LCS of a[i:] and b[j:]
+	width := len(b) + 1
+	lcs := make([]int32, (len(a)+1)*width)
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i*width+j] = lcs[(i+1)*width+j+1] + 1
+			} else {
+				lcs[i*width+j] = max(lcs[(i+1)*width+j], lcs[i*width+j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, DiffLine{Op: OpEqual, Text: a[i]})
+			i++
+			j++
+		case lcs[(i+1)*width+j] >= lcs[i*width+j+1]:
+			diff = append(diff, DiffLine{Op: OpRemove, Text: a[i]})
+			i++
+		default:
+			diff = append(diff, DiffLine{Op: OpAdd, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, DiffLine{Op: OpRemove, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, DiffLine{Op: OpAdd, Text: b[j]})
+	}
+
+	return diff
+}
@@ -0,0 +1,91 @@
+package suggestions
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		name   string
+		before string
+		after  string
+		want   []DiffLine
+	}{
+		{
+			name:   "unchanged",
+			before: "[C]one\n[G]two",
+			after:  "[C]one\n[G]two",
+			want:   []DiffLine{{OpEqual, "[C]one"}, {OpEqual, "[G]two"}},
+		},
+		{
+			name:   "line added",
+			before: "[C]one\n[G]three",
+			after:  "[C]one\n[Am]two\n[G]three",
+			want:   []DiffLine{{OpEqual, "[C]one"}, {OpAdd, "[Am]two"}, {OpEqual, "[G]three"}},
+		},
+		{
+			name:   "line removed",
+			before: "[C]one\n[Am]two\n[G]three",
+			after:  "[C]one\n[G]three",
+			want:   []DiffLine{{OpEqual, "[C]one"}, {OpRemove, "[Am]two"}, {OpEqual, "[G]three"}},
+		},
+		{
+			name:   "line changed",
+			before: "[C]one\n[Am]two\n[G]three",
+			after:  "[C]one\n[Em]two\n[G]three",
+			want:   []DiffLine{{OpEqual, "[C]one"}, {OpRemove, "[Am]two"}, {OpAdd, "[Em]two"}, {OpEqual, "[G]three"}},
+		},
+		{
+			name:   "common lines in the middle",
+			before: "a\nx\nb",
+			after:  "c\nx\nd",
+			want:   []DiffLine{{OpRemove, "a"}, {OpAdd, "c"}, {OpEqual, "x"}, {OpRemove, "b"}, {OpAdd, "d"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Diff(tt.before, tt.after); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("Diff() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// lines returns n distinct lines starting with prefix
+func lines(prefix string, n int) []string {
+	out := make([]string, n)
+	for i := range out {
+		out[i] = fmt.Sprintf("%s %d", prefix, i)
+	}
+	return out
+}
+
+// TestDiffFallback checks that a diff too large for the LCS table still
+// keeps the common start and end and covers every line
+func TestDiffFallback(t *testing.T) {
+	before := append(append([]string{"intro"}, lines("old", 2000)...), "outro")
+	after := append(append([]string{"intro"}, lines("new", 2000)...), "outro")
+
+	diff := Diff(strings.Join(before, "\n"), strings.Join(after, "\n"))
+
+	if len(diff) != 4002 {
+		t.Fatalf("got %d lines, want 4002", len(diff))
+	}
+	if diff[0] != (DiffLine{OpEqual, "intro"}) || diff[len(diff)-1] != (DiffLine{OpEqual, "outro"}) {
+		t.Errorf("common lines are not kept: first %v, last %v", diff[0], diff[len(diff)-1])
+	}
+	for i, line := range diff[1:2001] {
+		if line.Op != OpRemove || line.Text != before[i+1] {
+			t.Fatalf("line %d is %v, want the removal of %q", i+1, line, before[i+1])
+		}
+	}
+	for i, line := range diff[2001:4001] {
+		if line.Op != OpAdd || line.Text != after[i+1] {
+			t.Fatalf("line %d is %v, want the addition of %q", i+2001, line, after[i+1])
+		}
+	}
+}
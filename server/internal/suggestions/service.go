@@ -0,0 +1,287 @@
+package suggestions
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/apperr"
+	"github.com/supercakecrumb/chordik/internal/badges"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/songs"
+	"github.com/supercakecrumb/chordik/internal/store"
+)
+
+var (
+	ErrSuggestionNotFound = apperr.NotFound("suggestion_not_found", "Suggestion not found")
+	ErrPermissionDenied   = apperr.Forbidden("permission_denied", "Permission denied")
+	ErrOwnSong            = apperr.Invalid("own_song", "Edit your own song directly")
+	ErrNotPending         = apperr.Conflict("not_pending", "Suggestion is no longer pending")
+)
+
+// Suggestion statuses
+const (
+	StatusPending  = "pending"
+	StatusAccepted = "accepted"
+	StatusRejected = "rejected"
+)
+
+type SuggestionService struct {
+	store        store.Store
+	songService  *songs.SongService
+	badgeService *badges.BadgeService
+}
+
+func NewSuggestionService(st store.Store) *SuggestionService {
+	return &SuggestionService{
+		store:        st,
+		songService:  songs.NewSongService(st),
+		badgeService: badges.NewBadgeService(st),
+	}
+}
+
+// FieldChange describes a changed single-line field
+type FieldChange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// Review is a suggestion together with its diff against the current song
+// and the discussion around it
+type Review struct {
+	Suggestion db.EditSuggestion      `json:"suggestion"`
+	Changes    map[string]FieldChange `json:"changes"`
+	BodyDiff   []DiffLine             `json:"bodyDiff"`
+	Comments   []db.Comment           `json:"comments"`
+}
+
+// CreateSuggestion proposes changes to a song the viewer can see
+func (s *SuggestionService) CreateSuggestion(ctx context.Context, viewer songs.Viewer, songID uuid.UUID, title, artist, bodyChordPro, key, message string) (*db.EditSuggestion, error) {
+	song, err := s.songService.GetSong(ctx, viewer, songID)
+	if err != nil {
+		return nil, err
+	}
+
+	// Owners edit their songs directly
+	if song.CreatedByID == viewer.UserID {
+		return nil, ErrOwnSong
+	}
+
+	if !songs.IsValidChordPro(bodyChordPro) {
+		return nil, songs.ErrInvalidChordPro
+	}
+
+	suggestion := db.EditSuggestion{
+		SongID:       songID,
+		AuthorID:     viewer.UserID,
+		Title:        title,
+		Artist:       artist,
+		BodyChordPro: bodyChordPro,
+		Key:          key,
+		Message:      message,
+		Status:       StatusPending,
+	}
+
+	if err := s.store.Suggestions().Create(ctx, &suggestion); err != nil {
+		return nil, err
+	}
+
+	return &suggestion, nil
+}
+
+func (s *SuggestionService) ListSuggestions(ctx context.Context, viewer songs.Viewer, songID uuid.UUID, status string) ([]db.EditSuggestion, error) {
+	if _, err := s.songService.GetSong(ctx, viewer, songID); err != nil {
+		return nil, err
+	}
+
+	return s.store.Suggestions().ListBySong(ctx, songID, status)
+}
+
+// GetReview returns a suggestion with its diff against the current song.
+// Suggestions to hidden songs are only shown to those who can see the song.
+func (s *SuggestionService) GetReview(ctx context.Context, viewer songs.Viewer, suggestionID uuid.UUID) (*Review, error) {
+	suggestion, err := s.findSuggestion(ctx, suggestionID)
+	if err != nil {
+		return nil, err
+	}
+
+	song, err := s.songService.GetSong(ctx, viewer, suggestion.SongID)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]FieldChange{}
+	for field, change := range map[string]FieldChange{
+		"title":  {From: song.Title, To: suggestion.Title},
+		"artist": {From: song.Artist, To: suggestion.Artist},
+		"key":    {From: song.Key, To: suggestion.Key},
+	} {
+		if change.From != change.To {
+			changes[field] = change
+		}
+	}
+
+	comments, err := s.store.Comments().ListBySuggestion(ctx, suggestionID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range comments {
+		comments[i].Redact()
+	}
+
+	return &Review{
+		Suggestion: *suggestion,
+		Changes:    changes,
+		BodyDiff:   Diff(song.BodyChordPro, suggestion.BodyChordPro),
+		Comments:   comments,
+	}, nil
+}
+
+// AcceptSuggestion applies a suggestion to the song as a regular update.
+// Only the song owner may accept.
+func (s *SuggestionService) AcceptSuggestion(ctx context.Context, userID, suggestionID uuid.UUID) (*db.Song, error) {
+	suggestion, err := s.findPendingForOwner(ctx, userID, suggestionID)
+	if err != nil {
+		return nil, err
+	}
+
+	song, err := s.accept(ctx, userID, suggestion)
+	if err != nil {
+		return nil, err
+	}
+
+	// Accepted suggestions count toward the author's contributor badges
+	if err := s.badgeService.EvaluateEditorBadges(ctx, suggestion.AuthorID); err != nil {
+		return nil, err
+	}
+
+	return song, nil
+}
+
+// accept closes a suggestion and updates the song in one transaction, so
+// the song is left alone when the suggestion was reviewed in the meantime
+func (s *SuggestionService) accept(ctx context.Context, userID uuid.UUID, suggestion *db.EditSuggestion) (*db.Song, error) {
+	var song *db.Song
+	err := s.store.Transaction(ctx, func(tx store.Store) error {
+		if err := review(ctx, tx, suggestion, map[string]interface{}{
+			"status":      StatusAccepted,
+			"reviewed_at": time.Now(),
+		}); err != nil {
+			return err
+		}
+
+		var err error
+		song, err = songs.NewSongService(tx).UpdateSong(ctx,
+			userID,
+			suggestion.SongID,
+			suggestion.Title,
+			suggestion.Artist,
+			suggestion.BodyChordPro,
+			suggestion.Key,
+		)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return song, nil
+}
+
+// RejectSuggestion closes a suggestion without applying it. Only the song
+// owner may reject.
+func (s *SuggestionService) RejectSuggestion(ctx context.Context, userID, suggestionID uuid.UUID, reason string) (*db.EditSuggestion, error) {
+	suggestion, err := s.findPendingForOwner(ctx, userID, suggestionID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := review(ctx, s.store, suggestion, map[string]interface{}{
+		"status":        StatusRejected,
+		"reject_reason": reason,
+		"reviewed_at":   time.Now(),
+	}); err != nil {
+		return nil, err
+	}
+
+	return s.findSuggestion(ctx, suggestionID)
+}
+
+// review closes a suggestion that is still pending. The status is checked
+// in the update itself, so of two concurrent reviews only one succeeds.
+func review(ctx context.Context, tx store.Store, suggestion *db.EditSuggestion, fields map[string]interface{}) error {
+	reviewed, err := tx.Suggestions().Review(ctx, suggestion.ID, fields)
+	if err != nil {
+		return err
+	}
+	if !reviewed {
+		return ErrNotPending
+	}
+	return nil
+}
+
+// AddComment adds a comment to the discussion of a suggestion. The song
+// owner and the suggestion author may comment, as long as they can see
+// the song.
+func (s *SuggestionService) AddComment(ctx context.Context, viewer songs.Viewer, suggestionID uuid.UUID, body string) (*db.Comment, error) {
+	suggestion, err := s.findSuggestion(ctx, suggestionID)
+	if err != nil {
+		return nil, err
+	}
+
+	song, err := s.songService.GetSong(ctx, viewer, suggestion.SongID)
+	if err != nil {
+		return nil, err
+	}
+
+	if viewer.UserID != song.CreatedByID && viewer.UserID != suggestion.AuthorID {
+		return nil, ErrPermissionDenied
+	}
+
+	comment := db.Comment{
+		SongID:       suggestion.SongID,
+		SuggestionID: &suggestion.ID,
+		UserID:       &viewer.UserID,
+		Body:         body,
+	}
+
+	if err := s.store.Comments().Create(ctx, &comment); err != nil {
+		return nil, err
+	}
+
+	return &comment, nil
+}
+
+func (s *SuggestionService) findPendingForOwner(ctx context.Context, userID, suggestionID uuid.UUID) (*db.EditSuggestion, error) {
+	suggestion, err := s.findSuggestion(ctx, suggestionID)
+	if err != nil {
+		return nil, err
+	}
+
+	song, err := s.songService.GetSong(ctx, songs.Viewer{UserID: userID}, suggestion.SongID)
+	if err != nil {
+		return nil, err
+	}
+
+	if song.CreatedByID != userID {
+		return nil, ErrPermissionDenied
+	}
+
+	if suggestion.Status != StatusPending {
+		return nil, ErrNotPending
+	}
+
+	return suggestion, nil
+}
+
+func (s *SuggestionService) findSuggestion(ctx context.Context, suggestionID uuid.UUID) (*db.EditSuggestion, error) {
+	suggestion, err := s.store.Suggestions().Get(ctx, suggestionID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
+			return nil, ErrSuggestionNotFound
+		}
+		return nil, err
+	}
+	return suggestion, nil
+}
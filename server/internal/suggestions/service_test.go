@@ -0,0 +1,216 @@
+package suggestions
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/supercakecrumb/chordik/internal/badges"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/songs"
+	"github.com/supercakecrumb/chordik/internal/store"
+)
+
+var ctx = context.Background()
+
+// newTestStore returns a store on a fresh in-memory SQLite database
+func newTestStore(t *testing.T) store.Store {
+	t.Helper()
+
+	conn, err := db.NewSQLiteConnection(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if err := db.Migrate(conn.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	st := store.New(conn.DB)
+	if err := badges.NewBadgeService(st).InitializeBadges(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func createUser(t *testing.T, st store.Store, name string) *db.User {
+	t.Helper()
+
+	user := db.User{Email: name + "@example.com", PasswordHash: "x", DisplayName: name, Role: "user"}
+	if err := st.Users().Create(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+func createSong(t *testing.T, st store.Store, owner *db.User) *db.Song {
+	t.Helper()
+
+	song := db.Song{Title: "Song", Artist: "Artist", BodyChordPro: "[C]la", Status: songs.StatusVisible, CreatedByID: owner.ID}
+	if err := st.Songs().Create(ctx, &song); err != nil {
+		t.Fatal(err)
+	}
+	return &song
+}
+
+func TestCreateSuggestionValidatesBody(t *testing.T) {
+	st := newTestStore(t)
+	owner := createUser(t, st, "owner")
+	author := createUser(t, st, "author")
+	song := createSong(t, st, owner)
+	service := NewSuggestionService(st)
+
+	for _, body := range []string{"", strings.Repeat("[C]la\n", 11000)} {
+		_, err := service.CreateSuggestion(ctx, songs.Viewer{UserID: author.ID}, song.ID, "Song", "Artist", body, "", "")
+		if !errors.Is(err, songs.ErrInvalidChordPro) {
+			t.Errorf("a %d byte body: got %v, want %v", len(body), err, songs.ErrInvalidChordPro)
+		}
+	}
+
+	if _, err := service.CreateSuggestion(ctx, songs.Viewer{UserID: owner.ID}, song.ID, "Song", "Artist", "[G]la", "", ""); !errors.Is(err, ErrOwnSong) {
+		t.Errorf("suggesting on an own song: got %v, want %v", err, ErrOwnSong)
+	}
+	if _, err := service.CreateSuggestion(ctx, songs.Viewer{UserID: author.ID}, song.ID, "Song", "Artist", "[G]la", "", ""); err != nil {
+		t.Errorf("a valid suggestion: %v", err)
+	}
+}
+
+// suggest creates a pending suggestion to change a song's body
+func suggest(t *testing.T, service *SuggestionService, author *db.User, song *db.Song, body string) *db.EditSuggestion {
+	t.Helper()
+
+	suggestion, err := service.CreateSuggestion(ctx, songs.Viewer{UserID: author.ID}, song.ID, song.Title, song.Artist, body, song.Key, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return suggestion
+}
+
+// assertState checks the status of a suggestion and the body of its song
+func assertState(t *testing.T, st store.Store, suggestion *db.EditSuggestion, status, body string) {
+	t.Helper()
+
+	stored, err := st.Suggestions().Get(ctx, suggestion.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != status {
+		t.Errorf("suggestion status is %q, want %q", stored.Status, status)
+	}
+
+	song, err := st.Songs().GetAny(ctx, suggestion.SongID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if song.BodyChordPro != body {
+		t.Errorf("song body is %q, want %q", song.BodyChordPro, body)
+	}
+}
+
+func TestAcceptSuggestion(t *testing.T) {
+	st := newTestStore(t)
+	owner := createUser(t, st, "owner")
+	author := createUser(t, st, "author")
+	song := createSong(t, st, owner)
+	service := NewSuggestionService(st)
+	suggestion := suggest(t, service, author, song, "[G]la")
+
+	if _, err := service.AcceptSuggestion(ctx, author.ID, suggestion.ID); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("accepting as the author: got %v, want %v", err, ErrPermissionDenied)
+	}
+	assertState(t, st, suggestion, StatusPending, "[C]la")
+
+	updated, err := service.AcceptSuggestion(ctx, owner.ID, suggestion.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if updated.BodyChordPro != "[G]la" {
+		t.Errorf("accepted song body is %q, want %q", updated.BodyChordPro, "[G]la")
+	}
+	assertState(t, st, suggestion, StatusAccepted, "[G]la")
+
+	if _, err := service.AcceptSuggestion(ctx, owner.ID, suggestion.ID); !errors.Is(err, ErrNotPending) {
+		t.Errorf("accepting twice: got %v, want %v", err, ErrNotPending)
+	}
+	if _, err := service.RejectSuggestion(ctx, owner.ID, suggestion.ID, "Changed my mind"); !errors.Is(err, ErrNotPending) {
+		t.Errorf("rejecting an accepted suggestion: got %v, want %v", err, ErrNotPending)
+	}
+	assertState(t, st, suggestion, StatusAccepted, "[G]la")
+}
+
+func TestRejectSuggestion(t *testing.T) {
+	st := newTestStore(t)
+	owner := createUser(t, st, "owner")
+	author := createUser(t, st, "author")
+	song := createSong(t, st, owner)
+	service := NewSuggestionService(st)
+	suggestion := suggest(t, service, author, song, "[G]la")
+
+	if _, err := service.RejectSuggestion(ctx, author.ID, suggestion.ID, "No"); !errors.Is(err, ErrPermissionDenied) {
+		t.Errorf("rejecting as the author: got %v, want %v", err, ErrPermissionDenied)
+	}
+
+	rejected, err := service.RejectSuggestion(ctx, owner.ID, suggestion.ID, "Wrong chords")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rejected.Status != StatusRejected || rejected.RejectReason != "Wrong chords" || rejected.ReviewedAt == nil {
+		t.Errorf("rejected suggestion is %+v", rejected)
+	}
+	assertState(t, st, suggestion, StatusRejected, "[C]la")
+
+	if _, err := service.AcceptSuggestion(ctx, owner.ID, suggestion.ID); !errors.Is(err, ErrNotPending) {
+		t.Errorf("accepting a rejected suggestion: got %v, want %v", err, ErrNotPending)
+	}
+	assertState(t, st, suggestion, StatusRejected, "[C]la")
+}
+
+// TestAcceptReviewedSuggestion accepts a suggestion that was rejected after
+// the owner loaded it, as when an accept races a reject
+func TestAcceptReviewedSuggestion(t *testing.T) {
+	st := newTestStore(t)
+	owner := createUser(t, st, "owner")
+	author := createUser(t, st, "author")
+	song := createSong(t, st, owner)
+	service := NewSuggestionService(st)
+	suggestion := suggest(t, service, author, song, "[G]la")
+
+	stale, err := service.findPendingForOwner(ctx, owner.ID, suggestion.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := service.RejectSuggestion(ctx, owner.ID, suggestion.ID, "Wrong chords"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.accept(ctx, owner.ID, stale); !errors.Is(err, ErrNotPending) {
+		t.Errorf("got %v, want %v", err, ErrNotPending)
+	}
+	assertState(t, st, suggestion, StatusRejected, "[C]la")
+}
+
+// TestAcceptRollsBack checks that a suggestion stays pending when the song
+// can't be updated
+func TestAcceptRollsBack(t *testing.T) {
+	st := newTestStore(t)
+	owner := createUser(t, st, "owner")
+	author := createUser(t, st, "author")
+	song := createSong(t, st, owner)
+	service := NewSuggestionService(st)
+	suggestion := suggest(t, service, author, song, "[G]la")
+
+	pending, err := service.findPendingForOwner(ctx, owner.ID, suggestion.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Songs().Trash(ctx, song); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := service.accept(ctx, owner.ID, pending); !errors.Is(err, songs.ErrSongNotFound) {
+		t.Errorf("got %v, want %v", err, songs.ErrSongNotFound)
+	}
+	assertState(t, st, suggestion, StatusPending, "[C]la")
+}
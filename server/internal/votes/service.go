@@ -1,27 +1,36 @@
 package votes
 
 import (
+	"context"
 	"errors"
 
 	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/apperr"
 	"github.com/supercakecrumb/chordik/internal/badges"
 	"github.com/supercakecrumb/chordik/internal/db"
-	"gorm.io/gorm"
+	"github.com/supercakecrumb/chordik/internal/metrics"
+	"github.com/supercakecrumb/chordik/internal/songs"
+	"github.com/supercakecrumb/chordik/internal/store"
+	"go.opentelemetry.io/otel"
 )
 
 var (
-	ErrSongNotFound = errors.New("song not found")
+	ErrSongNotFound = apperr.NotFound("song_not_found", "Song not found")
 )
 
+var tracer = otel.Tracer("github.com/supercakecrumb/chordik/internal/votes")
+
 type VoteService struct {
-	db           *gorm.DB
+	store        store.Store
+	songService  *songs.SongService
 	badgeService *badges.BadgeService
 }
 
-func NewVoteService(db *gorm.DB) *VoteService {
+func NewVoteService(store store.Store) *VoteService {
 	return &VoteService{
-		db:           db,
-		badgeService: badges.NewBadgeService(db),
+		store:        store,
+		songService:  songs.NewSongService(store),
+		badgeService: badges.NewBadgeService(store),
 	}
 }
 
@@ -34,21 +43,32 @@ const (
 	VoteRemove  VoteValue = 0
 )
 
-func (s *VoteService) Vote(userID, songID uuid.UUID, value VoteValue) (int64, error) {
-	// Check if song exists
-	var song db.Song
-	if err := s.db.First(&song, "id = ?", songID).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
-			return 0, ErrSongNotFound
-		}
+func (v VoteValue) String() string {
+	switch v {
+	case VoteLike:
+		return "like"
+	case VoteDislike:
+		return "dislike"
+	default:
+		return "none"
+	}
+}
+
+// Vote records the viewer's vote on a song they can see and returns the
+// song's new score
+func (s *VoteService) Vote(ctx context.Context, viewer songs.Viewer, songID uuid.UUID, value VoteValue) (int64, error) {
+	ctx, span := tracer.Start(ctx, "VoteService.Vote")
+	defer span.End()
+
+	if _, err := s.songService.GetSong(ctx, viewer, songID); err != nil {
 		return 0, err
 	}
+	userID := viewer.UserID
 
 	// Check if user already voted
-	var existingVote db.SongLike
-	err := s.db.Where("song_id = ? AND user_id = ?", songID, userID).First(&existingVote).Error
+	existingVote, err := s.store.Votes().Get(ctx, songID, userID)
 
-	if errors.Is(err, gorm.ErrRecordNotFound) {
+	if errors.Is(err, store.ErrNotFound) {
 		// New vote
 		if value == VoteRemove {
 			return 0, nil
@@ -60,20 +80,19 @@ func (s *VoteService) Vote(userID, songID uuid.UUID, value VoteValue) (int64, er
 			Value:  int16(value),
 		}
 
-		if err := s.db.Create(&vote).Error; err != nil {
+		if err := s.store.Votes().Create(ctx, &vote); err != nil {
 			return 0, err
 		}
 	} else if err == nil {
 		// Existing vote
 		if value == VoteRemove {
 			// Remove vote
-			if err := s.db.Delete(&existingVote).Error; err != nil {
+			if err := s.store.Votes().Delete(ctx, existingVote); err != nil {
 				return 0, err
 			}
 		} else {
 			// Update vote
-			existingVote.Value = int16(value)
-			if err := s.db.Save(&existingVote).Error; err != nil {
+			if err := s.store.Votes().SetValue(ctx, existingVote, int16(value)); err != nil {
 				return 0, err
 			}
 		}
@@ -81,29 +100,29 @@ func (s *VoteService) Vote(userID, songID uuid.UUID, value VoteValue) (int64, er
 		return 0, err
 	}
 
+	metrics.VotesCast.WithLabelValues(value.String()).Inc()
+
 	// Calculate new score
-	var score int64
-	if err := s.db.Model(&db.SongLike{}).
-		Select("COALESCE(SUM(value), 0)").
-		Where("song_id = ?", songID).
-		Scan(&score).Error; err != nil {
+	score, err := s.store.Votes().Score(ctx, songID)
+	if err != nil {
 		return 0, err
 	}
 
-	// Evaluate popular badge if score reaches threshold
-	if score >= 100 || score <= -100 {
-		if err := s.badgeService.EvaluatePopularBadge(songID); err != nil {
-			return 0, err
-		}
+	// Re-evaluate the popular badge so it is awarded or revoked as the score moves
+	if err := s.badgeService.EvaluatePopularBadge(ctx, songID); err != nil {
+		return 0, err
 	}
 
 	return score, nil
 }
 
-func (s *VoteService) GetUserVote(userID, songID uuid.UUID) (VoteValue, error) {
-	var vote db.SongLike
-	if err := s.db.Where("song_id = ? AND user_id = ?", songID, userID).First(&vote).Error; err != nil {
-		if errors.Is(err, gorm.ErrRecordNotFound) {
+func (s *VoteService) GetUserVote(ctx context.Context, userID, songID uuid.UUID) (VoteValue, error) {
+	ctx, span := tracer.Start(ctx, "VoteService.GetUserVote")
+	defer span.End()
+
+	vote, err := s.store.Votes().Get(ctx, songID, userID)
+	if err != nil {
+		if errors.Is(err, store.ErrNotFound) {
 			return VoteRemove, nil
 		}
 		return VoteRemove, err
@@ -111,13 +130,14 @@ func (s *VoteService) GetUserVote(userID, songID uuid.UUID) (VoteValue, error) {
 	return VoteValue(vote.Value), nil
 }
 
-func (s *VoteService) GetSongScore(songID uuid.UUID) (int64, error) {
-	var score int64
-	if err := s.db.Model(&db.SongLike{}).
-		Select("COALESCE(SUM(value), 0)").
-		Where("song_id = ?", songID).
-		Scan(&score).Error; err != nil {
+// GetSongScore returns the score of a song the viewer can see
+func (s *VoteService) GetSongScore(ctx context.Context, viewer songs.Viewer, songID uuid.UUID) (int64, error) {
+	ctx, span := tracer.Start(ctx, "VoteService.GetSongScore")
+	defer span.End()
+
+	if _, err := s.songService.GetSong(ctx, viewer, songID); err != nil {
 		return 0, err
 	}
-	return score, nil
+
+	return s.store.Votes().Score(ctx, songID)
 }
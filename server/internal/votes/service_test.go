@@ -0,0 +1,127 @@
+package votes
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/google/uuid"
+	"github.com/supercakecrumb/chordik/internal/badges"
+	"github.com/supercakecrumb/chordik/internal/db"
+	"github.com/supercakecrumb/chordik/internal/songs"
+	"github.com/supercakecrumb/chordik/internal/store"
+)
+
+var ctx = context.Background()
+
+// newTestStore returns a store on a fresh in-memory SQLite database
+func newTestStore(t *testing.T) store.Store {
+	t.Helper()
+
+	conn, err := db.NewSQLiteConnection(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	if err := db.Migrate(conn.DB); err != nil {
+		t.Fatal(err)
+	}
+
+	st := store.New(conn.DB)
+	if err := badges.NewBadgeService(st).InitializeBadges(ctx); err != nil {
+		t.Fatal(err)
+	}
+	return st
+}
+
+func createUser(t *testing.T, st store.Store, name string) *db.User {
+	t.Helper()
+
+	user := db.User{Email: name + "@example.com", PasswordHash: "x", DisplayName: name, Role: "user"}
+	if err := st.Users().Create(ctx, &user); err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+func TestVote(t *testing.T) {
+	st := newTestStore(t)
+	owner := createUser(t, st, "owner")
+	voter := createUser(t, st, "voter")
+
+	song := db.Song{Title: "Song", Artist: "Artist", BodyChordPro: "[C]la", Status: "visible", CreatedByID: owner.ID}
+	if err := st.Songs().Create(ctx, &song); err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewVoteService(st)
+
+	steps := []struct {
+		name      string
+		userID    uuid.UUID
+		value     VoteValue
+		wantScore int64
+	}{
+		{name: "like", userID: voter.ID, value: VoteLike, wantScore: 1},
+		{name: "like again", userID: voter.ID, value: VoteLike, wantScore: 1},
+		{name: "owner likes", userID: owner.ID, value: VoteLike, wantScore: 2},
+		{name: "change to dislike", userID: voter.ID, value: VoteDislike, wantScore: 0},
+		{name: "remove", userID: voter.ID, value: VoteRemove, wantScore: 1},
+		{name: "remove without vote", userID: voter.ID, value: VoteRemove, wantScore: 0},
+	}
+
+	for _, step := range steps {
+		score, err := service.Vote(ctx, songs.Viewer{UserID: step.userID}, song.ID, step.value)
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if score != step.wantScore {
+			t.Errorf("%s: got score %d, want %d", step.name, score, step.wantScore)
+		}
+	}
+
+	if got, err := service.GetUserVote(ctx, voter.ID, song.ID); err != nil || got != VoteRemove {
+		t.Errorf("GetUserVote = %d, %v; want %d", got, err, VoteRemove)
+	}
+	if got, err := service.GetSongScore(ctx, songs.Viewer{}, song.ID); err != nil || got != 1 {
+		t.Errorf("GetSongScore = %d, %v; want 1", got, err)
+	}
+}
+
+func TestVoteUnknownSong(t *testing.T) {
+	st := newTestStore(t)
+	voter := createUser(t, st, "voter")
+
+	if _, err := NewVoteService(st).Vote(ctx, songs.Viewer{UserID: voter.ID}, uuid.New(), VoteLike); !errors.Is(err, ErrSongNotFound) {
+		t.Errorf("got error %v, want %v", err, ErrSongNotFound)
+	}
+}
+
+// TestVoteHiddenSong checks that a hidden song can't be voted on or scored
+// by anyone but its owner and moderators
+func TestVoteHiddenSong(t *testing.T) {
+	st := newTestStore(t)
+	owner := createUser(t, st, "owner")
+	voter := createUser(t, st, "voter")
+
+	song := db.Song{Title: "Song", Artist: "Artist", BodyChordPro: "[C]la", Status: songs.StatusHidden, CreatedByID: owner.ID}
+	if err := st.Songs().Create(ctx, &song); err != nil {
+		t.Fatal(err)
+	}
+
+	service := NewVoteService(st)
+	if _, err := service.Vote(ctx, songs.Viewer{UserID: voter.ID}, song.ID, VoteLike); !errors.Is(err, ErrSongNotFound) {
+		t.Errorf("vote on a hidden song: got %v, want %v", err, ErrSongNotFound)
+	}
+	if _, err := service.GetSongScore(ctx, songs.Viewer{UserID: voter.ID}, song.ID); !errors.Is(err, ErrSongNotFound) {
+		t.Errorf("score of a hidden song: got %v, want %v", err, ErrSongNotFound)
+	}
+
+	if _, err := service.Vote(ctx, songs.Viewer{UserID: owner.ID}, song.ID, VoteLike); err != nil {
+		t.Errorf("the owner's vote on their hidden song: %v", err)
+	}
+	if score, err := service.GetSongScore(ctx, songs.Viewer{UserID: voter.ID, Moderator: true}, song.ID); err != nil || score != 1 {
+		t.Errorf("a moderator's view of the score = %d, %v; want 1", score, err)
+	}
+}
@@ -38,6 +38,7 @@ func main() {
 			Email:        "admin@example.com",
 			PasswordHash: string(hashedPassword),
 			DisplayName:  "Administrator",
+			Role:         "admin",
 		}
 		if err := database.DB.Create(&adminUser).Error; err != nil {
 			log.Fatal("Failed to create user:", err)
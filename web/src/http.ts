@@ -1,10 +1,44 @@
 import axios from 'axios'
 import { API_BASE } from './config'
 
-export default axios.create({
+const http = axios.create({
   baseURL: API_BASE,
   withCredentials: true,
   headers: {
     'X-Requested-With': 'XMLHttpRequest'
   }
-})
\ No newline at end of file
+})
+
+// The server issues a per-session CSRF token on login and /auth/me and
+// expects it back on every mutating request
+let csrfToken: string | null = null
+
+http.interceptors.response.use((response) => {
+  const token = response.headers['x-csrf-token']
+  if (token) {
+    csrfToken = token
+  }
+  return response
+}, async (error) => {
+  // A rejected CSRF token means our copy is stale, or the session behind
+  // the cookie is gone and the server cleared it. Either way one retry
+  // after refreshing the token goes through.
+  const config = error.config
+  if (error.response?.data?.code === 'csrf_invalid_token' && config && !config._csrfRetry) {
+    config._csrfRetry = true
+    csrfToken = null
+    await http.get('/auth/me').catch(() => undefined)
+    return http.request(config)
+  }
+  return Promise.reject(error)
+})
+
+http.interceptors.request.use((config) => {
+  const method = (config.method ?? 'get').toLowerCase()
+  if (csrfToken && !['get', 'head', 'options'].includes(method)) {
+    config.headers.set('X-CSRF-Token', csrfToken)
+  }
+  return config
+})
+
+export default http
@@ -1,6 +1,5 @@
 export interface User {
   ID: string
-  Email: string
   DisplayName: string
   CreatedAt: string
   UpdatedAt: string